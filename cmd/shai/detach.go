@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/colony-2/shai/pkg/shai"
+	"github.com/spf13/cobra"
+)
+
+// detachedNameEnv carries the session name to the background shai process
+// that --detach starts; its presence marks that process as the detached one.
+const detachedNameEnv = "SHAI_DETACHED_NAME"
+
+// logPollInterval is how often startup and log following check for progress.
+const logPollInterval = 250 * time.Millisecond
+
+// sessionLogPath returns where the output of the detached session name is
+// kept.
+func sessionLogPath(name string) (string, error) {
+	if err := shai.ValidateSessionName(name); err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "shai", "logs", name+".log"), nil
+}
+
+// logLockWait bounds how long a new background process waits for the
+// previous one of the same name to finish writing its log.
+const logLockWait = 5 * time.Second
+
+// startDetached starts the sandbox in the background, prints its name and
+// returns once it is running.
+func startDetached(ctx context.Context, name string, out, errOut io.Writer) error {
+	if name == "" {
+		name = shai.NewSessionName()
+	}
+	if err := launchDetached(ctx, name, errOut); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, name)
+	fmt.Fprintf(errOut, "shai: %s is running in the background; follow it with \"shai logs -f %s\" and stop it with \"shai stop %s\"\n", name, name, name)
+	return nil
+}
+
+// launchDetached re-runs this command in the background with its output in
+// the session log, and returns once the sandbox called name is running. The
+// background process holds a lock on the log until it exits, which is how
+// "shai logs -f" knows the output is complete.
+func launchDetached(ctx context.Context, name string, errOut io.Writer) error {
+	logPath, err := sessionLogPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o700); err != nil {
+		return fmt.Errorf("create log directory: %w", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open session log: %w", err)
+	}
+	defer logFile.Close()
+	if !lockLog(logFile, logLockWait) {
+		return fmt.Errorf("session %s is already running", name)
+	}
+	if err := logFile.Truncate(0); err != nil {
+		return fmt.Errorf("truncate session log: %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate shai executable: %w", err)
+	}
+	child := exec.Command(exe, os.Args[1:]...)
+	child.Env = append(os.Environ(), detachedNameEnv+"="+name)
+	child.Stdout = logFile
+	child.Stderr = logFile
+	child.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("start detached session: %w", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = child.Wait()
+		close(exited)
+	}()
+
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			if data, err := os.ReadFile(logPath); err == nil {
+				_, _ = errOut.Write(data)
+			}
+			return &shai.ExitError{
+				Code:  shai.ExitCodeSetup,
+				Phase: shai.ExitPhaseSetup,
+				Err:   fmt.Errorf("detached session %s exited during startup (log: %s)", name, logPath),
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		sessions, err := shai.ListSessions(ctx)
+		if err != nil {
+			continue
+		}
+		for _, s := range sessions {
+			if s.Name == name {
+				return nil
+			}
+		}
+	}
+}
+
+// lockLog takes the writer's lock on f, waiting up to wait for a previous
+// writer to exit.
+func lockLog(f *os.File, wait time.Duration) bool {
+	deadline := time.Now().Add(wait)
+	for {
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(logPollInterval)
+	}
+}
+
+func newLogsCmd() *cobra.Command {
+	var follow bool
+	cmd := &cobra.Command{
+		Use:   "logs [-f] <name>",
+		Short: "Print the output of a shai session started with --detach",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logPath, err := sessionLogPath(args[0])
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(logPath)
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("no log for session %q (only sessions started with --detach are logged)", args[0])
+			}
+			if err != nil {
+				return fmt.Errorf("open session log: %w", err)
+			}
+			defer f.Close()
+			return copyLog(cmd.Context(), cmd.OutOrStdout(), f, follow, logPollInterval)
+		},
+	}
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing output until the session's shai process exits")
+	return cmd
+}
+
+// copyLog writes f to out. When follow is set it keeps polling for new output
+// until the process writing f has exited or ctx is done.
+func copyLog(ctx context.Context, out io.Writer, f *os.File, follow bool, poll time.Duration) error {
+	for {
+		if _, err := io.Copy(out, f); err != nil {
+			return err
+		}
+		if !follow {
+			return nil
+		}
+		if logWriterDone(f) {
+			_, err := io.Copy(out, f)
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(poll):
+		}
+	}
+}
+
+// logWriterDone reports whether the detached process has released its lock
+// on the log, i.e. exited.
+func logWriterDone(f *os.File) bool {
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return false
+	}
+	_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+
+	"github.com/colony-2/shai/pkg/shai"
+	"github.com/moby/term"
+	"github.com/spf13/cobra"
+)
+
+func newExecCmd() *cobra.Command {
+	var (
+		workdir  string
+		envPairs []string
+		noTTY    bool
+	)
+	cmd := &cobra.Command{
+		Use:   "exec <name> [-- command [args...]]",
+		Short: "Run a command in a running shai session as the sandbox user",
+		Long: `Run a command in a running shai session as the sandbox user, with the
+session's proxy settings, resource variables and workspace. Without a command
+it starts the user's login shell. The command's exit status is returned.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			env, err := parseTemplateVars(envPairs)
+			if err != nil {
+				return err
+			}
+			return shai.ExecSession(cmd.Context(), args[0], shai.SandboxExec{
+				Command: args[1:],
+				Env:     env,
+				Workdir: workdir,
+				UseTTY:  !noTTY && term.IsTerminal(os.Stdin.Fd()),
+				Stdin:   os.Stdin,
+			})
+		},
+	}
+	cmd.Flags().StringVarP(&workdir, "workdir", "w", "", "Working directory inside the sandbox (defaults to the workspace)")
+	cmd.Flags().StringArrayVarP(&envPairs, "env", "e", nil, "Set an environment variable for the command (KEY=VALUE)")
+	cmd.Flags().BoolVarP(&noTTY, "no-tty", "T", false, "Do not allocate a TTY even when stdin is a terminal")
+	return cmd
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/colony-2/shai/pkg/shai"
+	"github.com/spf13/cobra"
+)
+
+func newExplainCmd() *cobra.Command {
+	var (
+		readWritePaths []string
+		configPath     string
+		templatePairs  []string
+		resourceSets   []string
+		publishSpecs   []string
+		imageOverride  string
+		userOverride   string
+		privileged     bool
+		rwMode         string
+		asJSON         bool
+	)
+	cmd := &cobra.Command{
+		Use:   "explain [--read-write <path>] [--resource-set <set>] [--json]",
+		Short: "Show the sandbox a run with these flags would start, without starting it",
+		Long: "Resolve the shai config for the given flags and print the image and why it was chosen, " +
+			"the resource sets and the apply rules that activated them, mounts, variable names (never values), " +
+			"network allowlists, calls, root commands and privilege. Docker is not contacted.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			varMap, err := parseTemplateVars(templatePairs)
+			if err != nil {
+				return err
+			}
+			published, err := parsePublishSpecs(publishSpecs)
+			if err != nil {
+				return err
+			}
+			workingDir, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
+			plan, err := shai.Plan(shai.SandboxConfig{
+				WorkingDir:     workingDir,
+				ConfigFile:     configPath,
+				UserConfig:     true,
+				TemplateVars:   varMap,
+				ReadWritePaths: readWritePaths,
+				ResourceSets:   resourceSets,
+				ImageOverride:  imageOverride,
+				UserOverride:   userOverride,
+				Privileged:     privileged,
+				PublishedPorts: published,
+				RWMode:         rwMode,
+			})
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(plan)
+			}
+			return printPlan(cmd.OutOrStdout(), plan)
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringArrayVar(&readWritePaths, "read-write", nil, "Path to mount read-write (repeatable, alias: -rw)")
+	flags.StringVarP(&configPath, "config", "c", "", fmt.Sprintf("Path to Shai config (default: <workspace>/%s)", shai.DefaultConfigRelPath))
+	flags.StringArrayVar(&resourceSets, "resource-set", nil, "Resource set to activate (repeatable, alias: -rs)")
+	flags.StringArrayVarP(&templatePairs, "var", "v", nil, fmt.Sprintf("Template variable for %s (key=value)", shai.DefaultConfigRelPath))
+	flags.StringVarP(&imageOverride, "image", "i", "", "Override container image (highest precedence)")
+	flags.StringVarP(&userOverride, "user", "u", "", "Override target user (highest precedence)")
+	flags.StringArrayVarP(&publishSpecs, "publish", "p", nil, "Publish a sandbox port on host loopback ([hostPort:]port, repeatable)")
+	flags.BoolVar(&privileged, "privileged", false, "Run container in privileged mode")
+	flags.StringVar(&rwMode, "rw-mode", shai.RWModeBind, "How read-write paths are mounted: bind or overlay")
+	flags.BoolVar(&asJSON, "json", false, "Print the plan as JSON")
+	return cmd
+}
+
+// printPlan writes plan for people; --json is the stable format for tools.
+func printPlan(out io.Writer, plan *shai.SandboxPlan) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	config := plan.ConfigFile
+	switch {
+	case plan.DefaultConfig:
+		config += " (not found; using the built-in default)"
+	case plan.Trust != "":
+		config += " (" + plan.Trust + ")"
+	}
+	fmt.Fprintf(tw, "Config:\t%s\n", config)
+	for _, inc := range plan.Includes {
+		fmt.Fprintf(tw, "Includes:\t%s\n", inc)
+	}
+	if plan.Overlay != "" {
+		overlay := plan.Overlay
+		if len(plan.OverlayIgnored) > 0 {
+			overlay += " (locked by the config, not applied: " + strings.Join(plan.OverlayIgnored, ", ") + ")"
+		}
+		fmt.Fprintf(tw, "User config:\t%s\n", overlay)
+	}
+	image := imageReason(plan)
+	if from := otherFile(plan, plan.ImageFile); from != "" {
+		image += ", from " + from
+	}
+	fmt.Fprintf(tw, "Image:\t%s (%s)\n", plan.Image, image)
+	user := plan.User
+	if from := otherFile(plan, plan.UserFile); from != "" {
+		user += " (from " + from + ")"
+	}
+	fmt.Fprintf(tw, "User:\t%s\n", user)
+	fmt.Fprintf(tw, "Workspace:\t%s\n", plan.Workspace)
+	rw := listOrDash(plan.ReadWritePaths)
+	if len(plan.ReadWritePaths) > 0 {
+		rw += " (" + plan.RWMode + ")"
+	}
+	fmt.Fprintf(tw, "Read-write:\t%s\n", rw)
+	privileged := "no"
+	if plan.Privileged {
+		privileged = "yes, requested by " + strings.Join(plan.PrivilegedBy, ", ")
+	}
+	fmt.Fprintf(tw, "Privileged:\t%s\n", privileged)
+	fmt.Fprintf(tw, "Hardened:\t%s\n", yesNo(plan.Hardened))
+	fmt.Fprintf(tw, "SSH agent:\t%s\n", yesNo(plan.SSHAgent))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	section(out, "Resource sets", len(plan.ResourceSets), func(tw *tabwriter.Writer) {
+		for _, rs := range plan.ResourceSets {
+			var why []string
+			if rs.Requested {
+				why = append(why, "--resource-set")
+			}
+			for _, m := range rs.Matches {
+				match := fmt.Sprintf("apply rule %q matched %s", m.Rule, m.Path)
+				if from := otherFile(plan, m.File); from != "" {
+					match += " (in " + from + ")"
+				}
+				why = append(why, match)
+			}
+			if len(rs.Files) > 1 || otherFile(plan, firstOr(rs.Files)) != "" {
+				why = append(why, "defined in "+strings.Join(rs.Files, " and "))
+			}
+			fmt.Fprintf(tw, "  %s\t%s\n", rs.Name, strings.Join(why, "; "))
+		}
+	})
+	section(out, "Mounts", len(plan.Mounts), func(tw *tabwriter.Writer) {
+		for _, m := range plan.Mounts {
+			source := m.Source
+			if source == "" {
+				source = "-"
+			}
+			origin := m.Origin
+			if m.Missing {
+				origin += " (source missing, skipped)"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", m.Target, m.Mode, source, origin)
+		}
+	})
+	section(out, "Variables", len(plan.Env), func(tw *tabwriter.Writer) {
+		for _, v := range plan.Env {
+			from := "from host " + v.From
+			if v.AsFile {
+				from += ", as a file"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", v.Name, from, v.Resource)
+		}
+	})
+	section(out, "HTTP allowlist", len(plan.HTTP), func(tw *tabwriter.Writer) {
+		for _, host := range plan.HTTP {
+			fmt.Fprintf(tw, "  %s\n", host)
+		}
+	})
+	section(out, "Port allowlist", len(plan.Ports), func(tw *tabwriter.Writer) {
+		for _, p := range plan.Ports {
+			fmt.Fprintf(tw, "  %s\n", p)
+		}
+	})
+	section(out, "Host ports", len(plan.HostPorts), func(tw *tabwriter.Writer) {
+		for _, hp := range plan.HostPorts {
+			fmt.Fprintf(tw, "  localhost:%d\t-> host port %d\n", hp.Target, hp.Port)
+		}
+	})
+	section(out, "Published ports", len(plan.PublishedPorts), func(tw *tabwriter.Writer) {
+		for _, pp := range plan.PublishedPorts {
+			host := "any free port"
+			if pp.HostPort != 0 {
+				host = fmt.Sprintf("127.0.0.1:%d", pp.HostPort)
+			}
+			fmt.Fprintf(tw, "  %d\t-> %s\n", pp.Port, host)
+		}
+	})
+	section(out, "Calls", len(plan.Calls), func(tw *tabwriter.Writer) {
+		for _, c := range plan.Calls {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", c.Name, c.Command, c.Resource)
+		}
+	})
+	section(out, "Root commands", len(plan.RootCommands), func(tw *tabwriter.Writer) {
+		for _, c := range plan.RootCommands {
+			fmt.Fprintf(tw, "  %s\n", c)
+		}
+	})
+	return nil
+}
+
+// section prints a titled block of rows, or nothing when it has none.
+func section(out io.Writer, title string, n int, rows func(*tabwriter.Writer)) {
+	if n == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\n%s:\n", title)
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	rows(tw)
+	_ = tw.Flush()
+}
+
+func imageReason(plan *shai.SandboxPlan) string {
+	switch plan.ImageSource {
+	case "cli":
+		return "--image"
+	case "apply":
+		return fmt.Sprintf("apply rule %q matched %s", plan.ImageRule, plan.ImagePath)
+	}
+	return "config image"
+}
+
+// otherFile returns file when a value came from somewhere other than the
+// workspace config itself: an included file or the user overlay.
+func otherFile(plan *shai.SandboxPlan, file string) string {
+	if file == plan.ConfigFile {
+		return ""
+	}
+	return file
+}
+
+func firstOr(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	return files[0]
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/colony-2/shai/pkg/shai"
+)
+
+// keptSessionName names the kept sandbox of workingDir when --name is not
+// given, so later runs from the same directory find it again.
+func keptSessionName(workingDir string) string {
+	sum := sha256.Sum256([]byte(workingDir))
+	return "shai-keep-" + hex.EncodeToString(sum[:4])
+}
+
+// runKept runs command in the kept sandbox for cfg, starting it in the
+// background first when it is missing or was created from a different
+// fingerprint. An empty command opens a login shell.
+func runKept(ctx context.Context, cfg shai.SandboxConfig, command []string, useTTY bool, errOut io.Writer) error {
+	if cfg.Worktree || cfg.RWMode == shai.RWModeOverlay {
+		return errors.New("--keep cannot be combined with --worktree or --rw-mode overlay")
+	}
+	cfg.RequireTrust = true
+	cfg.ConfirmTrust = trustPrompter()
+	fingerprint, err := shai.SandboxFingerprint(cfg)
+	if err != nil {
+		return err
+	}
+	name := cfg.ContainerName
+	if name == "" {
+		name = keptSessionName(cfg.WorkingDir)
+	}
+
+	sessions, err := shai.ListSessions(ctx)
+	if err != nil {
+		return err
+	}
+	reuse := false
+	for _, s := range sessions {
+		if s.Name != name {
+			continue
+		}
+		if s.Fingerprint == fingerprint {
+			reuse = true
+			break
+		}
+		fmt.Fprintf(errOut, "shai: %s was created from a different config, image or read-write set; recreating it\n", name)
+		if err := shai.RemoveSession(ctx, name); err != nil {
+			return err
+		}
+	}
+	if !reuse {
+		if err := launchDetached(ctx, name, errOut); err != nil {
+			return err
+		}
+		fmt.Fprintf(errOut, "shai: keeping sandbox %s for later runs; stop it with \"shai stop %s\"\n", name, name)
+	}
+
+	if err := shai.WaitSessionReady(ctx, name); err != nil {
+		return err
+	}
+	return shai.ExecSession(ctx, name, shai.SandboxExec{
+		Command: command,
+		UseTTY:  useTTY,
+		Stdin:   os.Stdin,
+	})
+}
@@ -2,20 +2,21 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/colony-2/shai/internal/shai/runtime/config"
 	"github.com/colony-2/shai/pkg/shai"
+	"github.com/moby/term"
 	"github.com/spf13/cobra"
 )
 
-const workspacePath = "/src"
-
 // Version information set by GoReleaser at build time
 var (
 	version = "dev"
@@ -26,9 +27,24 @@ var (
 func main() {
 	os.Args = normalizeLegacyArgs(os.Args)
 	if err := newRootCmd().Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		// A failing command has already reported its own error.
+		var exitErr *shai.ExitError
+		if !errors.As(err, &exitErr) || exitErr.Phase != shai.ExitPhaseCommand || exitErr.Err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode maps err to the process exit status. Errors that carry their own
+// code, such as the sandboxed command's status or session time limits, keep
+// it; everything else exits 1.
+func exitCode(err error) int {
+	var coded interface{ ExitCode() int }
+	if errors.As(err, &coded) {
+		return coded.ExitCode()
 	}
+	return 1
 }
 
 func newRootCmd() *cobra.Command {
@@ -37,12 +53,22 @@ func newRootCmd() *cobra.Command {
 		configPath     string
 		templatePairs  []string
 		resourceSets   []string
+		publishSpecs   []string
 		imageOverride  string
 		userOverride   string
 		containerName  string
 		privileged     bool
+		cpus           float64
+		memory         string
+		maxDuration    time.Duration
+		idleTimeout    time.Duration
+		rwMode         string
+		worktreeBranch string
+		branch         string
 		verbose        bool
 		noTTY          bool
+		detach         bool
+		keep           bool
 	)
 
 	cmd := &cobra.Command{
@@ -55,30 +81,74 @@ func newRootCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			published, err := parsePublishSpecs(publishSpecs)
+			if err != nil {
+				return err
+			}
 
 			workingDir, err := os.Getwd()
 			if err != nil {
 				return fmt.Errorf("failed to get working directory: %w", err)
 			}
 
+			background := os.Getenv(detachedNameEnv)
+			if background != "" {
+				// This is the background process started by --detach or
+				// --keep; a kept sandbox idles in its shell between commands.
+				os.Unsetenv(detachedNameEnv)
+				containerName = background
+				if keep {
+					args = nil
+				}
+			} else if keep && detach {
+				return errors.New("--keep already runs the sandbox in the background; drop --detach")
+			} else if detach {
+				return startDetached(cmd.Context(), containerName, cmd.OutOrStdout(), cmd.ErrOrStderr())
+			}
+
 			var postExec *shai.SandboxExec
 			if len(args) > 0 {
 				postExec = &shai.SandboxExec{
 					Command: args,
-					Workdir: workspacePath,
 					UseTTY:  !noTTY,
 				}
 			}
 
-			ctx, cancel := setupSignals()
-			defer cancel()
-
-			if err := runEphemeral(ctx, workingDir, readWritePaths, verbose, postExec, configPath, varMap, resourceSets, imageOverride, userOverride, privileged); err != nil {
+			wtBranch, err := resolveWorktreeBranch(worktreeBranch, branch)
+			if err != nil {
 				return err
 			}
+			sandboxCfg := shai.SandboxConfig{
+				WorkingDir:     workingDir,
+				ConfigFile:     configPath,
+				UserConfig:     true,
+				TemplateVars:   varMap,
+				ReadWritePaths: readWritePaths,
+				ResourceSets:   resourceSets,
+				Verbose:        verbose,
+				PostSetupExec:  postExec,
+				ImageOverride:  imageOverride,
+				UserOverride:   userOverride,
+				Privileged:     privileged,
+				PublishedPorts: published,
+				CPUs:           cpus,
+				Memory:         memory,
+				MaxDuration:    maxDuration,
+				IdleTimeout:    idleTimeout,
+				RWMode:         rwMode,
+				Worktree:       cmd.Flags().Changed("worktree") || branch != "",
+				WorktreeBranch: wtBranch,
+				ContainerName:  containerName,
+			}
+			if keep && background == "" {
+				useTTY := !noTTY && term.IsTerminal(os.Stdin.Fd())
+				return runKept(cmd.Context(), sandboxCfg, args, useTTY, cmd.ErrOrStderr())
+			}
+
+			ctx, cancel := setupSignals()
+			defer cancel()
 
-			_ = containerName // Flag retained for future naming support.
-			return nil
+			return runEphemeral(ctx, sandboxCfg)
 		},
 	}
 
@@ -89,13 +159,37 @@ func newRootCmd() *cobra.Command {
 	flags.StringArrayVarP(&templatePairs, "var", "v", nil, fmt.Sprintf("Template variable for %s (key=value)", shai.DefaultConfigRelPath))
 	flags.StringVarP(&imageOverride, "image", "i", "", "Override container image (highest precedence)")
 	flags.StringVarP(&userOverride, "user", "u", "", "Override target user (highest precedence)")
-	flags.StringVarP(&containerName, "name", "n", "", "Container name (optional)")
+	flags.StringArrayVarP(&publishSpecs, "publish", "p", nil, "Publish a sandbox port on host loopback ([hostPort:]port, repeatable)")
+	flags.StringVarP(&containerName, "name", "n", "", "Container name shown by shai ps (default: shai-<random>)")
 	flags.BoolVar(&privileged, "privileged", false, "Run container in privileged mode")
+	flags.Float64Var(&cpus, "cpus", 0, "Limit the sandbox to this many CPUs (most restrictive of flag and config wins)")
+	flags.StringVar(&memory, "memory", "", "Limit sandbox memory, e.g. 4g (most restrictive of flag and config wins)")
+	flags.DurationVar(&maxDuration, "max-duration", 0, "Stop the sandbox after this long, e.g. 2h (exit code 124)")
+	flags.DurationVar(&idleTimeout, "idle-timeout", 0, "Stop the sandbox after this long without terminal input or output or a running exec (exit code 124)")
+	flags.StringVar(&rwMode, "rw-mode", shai.RWModeBind, "How read-write paths are mounted: bind (write to the workspace) or overlay (review changes with shai apply/discard)")
+	flags.StringVar(&worktreeBranch, "worktree", "", "Run in a fresh clone of the repository on a new branch (--worktree[=branch]); the branch is left in the repository for review")
+	flags.Lookup("worktree").NoOptDefVal = worktreeAutoBranch
+	flags.StringVar(&branch, "branch", "", "Branch for --worktree; implies --worktree")
 	flags.BoolVarP(&verbose, "verbose", "V", false, "Enable verbose logging")
 	flags.BoolVarP(&noTTY, "no-tty", "T", false, "Disable TTY for post-setup command")
+	flags.BoolVarP(&detach, "detach", "d", false, "Start the sandbox in the background, print its name and return (see shai logs)")
+	flags.BoolVar(&keep, "keep", false, "Run the command in a sandbox kept alive for later runs; it is recreated when the config, image or read-write set changes")
 
 	cmd.AddCommand(newVersionCmd())
 	cmd.AddCommand(newGenerateCmd())
+	cmd.AddCommand(newTrustCmd())
+	cmd.AddCommand(newUntrustCmd())
+	cmd.AddCommand(newApplyCmd())
+	cmd.AddCommand(newDiscardCmd())
+	cmd.AddCommand(newWorktreeCmd())
+	cmd.AddCommand(newPsCmd())
+	cmd.AddCommand(newAttachCmd())
+	cmd.AddCommand(newStopCmd())
+	cmd.AddCommand(newExecCmd())
+	cmd.AddCommand(newLogsCmd())
+	cmd.AddCommand(newExplainCmd())
+	cmd.AddCommand(newValidateCmd())
+	cmd.AddCommand(newSchemaCmd())
 
 	return cmd
 }
@@ -140,6 +234,21 @@ func parseTemplateVars(pairs []string) (map[string]string, error) {
 	return vars, nil
 }
 
+func parsePublishSpecs(specs []string) ([]shai.PublishedPort, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	ports := make([]shai.PublishedPort, 0, len(specs))
+	for _, spec := range specs {
+		pp, err := shai.ParsePublishedPort(spec)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, pp)
+	}
+	return ports, nil
+}
+
 func normalizeLegacyArgs(args []string) []string {
 	const (
 		rwAlias = "-rw"
@@ -164,26 +273,32 @@ func normalizeLegacyArgs(args []string) []string {
 	return out
 }
 
-func runEphemeral(ctx context.Context, workingDir string, rwPaths []string, verbose bool, postExec *shai.SandboxExec, configPath string, vars map[string]string, resourceSets []string, imageOverride, userOverride string, privileged bool) error {
-	sandbox, err := shai.NewSandbox(shai.SandboxConfig{
-		WorkingDir:     workingDir,
-		ConfigFile:     configPath,
-		TemplateVars:   vars,
-		ReadWritePaths: rwPaths,
-		ResourceSets:   resourceSets,
-		Verbose:        verbose,
-		PostSetupExec:  postExec,
-		ImageOverride:  imageOverride,
-		UserOverride:   userOverride,
-		Privileged:     privileged,
-		ShowProgress:   true,
-	})
+func runEphemeral(ctx context.Context, cfg shai.SandboxConfig) error {
+	cfg.ShowProgress = true
+	cfg.RequireTrust = true
+	cfg.ConfirmTrust = trustPrompter()
+	sandbox, err := shai.NewSandbox(cfg)
 	if err != nil {
 		return err
 	}
 	defer sandbox.Close()
 
-	return sandbox.Run(ctx)
+	runErr := sandbox.Run(ctx)
+	if ov, ok := sandbox.(shai.OverlaySandbox); ok {
+		if session := ov.Overlay(); session != nil {
+			if err := reportOverlay(os.Stderr, session); err != nil && runErr == nil {
+				runErr = err
+			}
+		}
+	}
+	if ws, ok := sandbox.(shai.WorktreeSandbox); ok {
+		if wt := ws.Worktree(); wt != nil {
+			if err := reportWorktree(os.Stderr, wt); err != nil && runErr == nil {
+				runErr = err
+			}
+		}
+	}
+	return runErr
 }
 
 func generateDefaultConfig() error {
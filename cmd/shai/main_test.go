@@ -1,8 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/colony-2/shai/internal/shai/runtime/overlay"
+	"github.com/colony-2/shai/pkg/shai"
 )
 
 func TestParseTemplateVars(t *testing.T) {
@@ -33,3 +45,299 @@ func TestNormalizeLegacyArgs(t *testing.T) {
 		t.Fatalf("expected %v, got %v", expected, got)
 	}
 }
+
+func TestPromptTrust(t *testing.T) {
+	var out strings.Builder
+	ok, err := promptTrust(strings.NewReader("y\n"), &out, shai.TrustRequest{
+		ConfigPath:   "/repo/.shai/config.yaml",
+		Capabilities: []string{"[global] runs the container privileged"},
+	})
+	if err != nil || !ok {
+		t.Fatalf("expected approval, got %v %v", ok, err)
+	}
+	if !strings.Contains(out.String(), "runs the container privileged") {
+		t.Fatalf("expected capabilities in prompt, got %q", out.String())
+	}
+
+	ok, err = promptTrust(strings.NewReader(""), &out, shai.TrustRequest{ConfigPath: "/repo/.shai/config.yaml", Changed: true})
+	if err != nil || ok {
+		t.Fatalf("expected refusal on empty answer, got %v %v", ok, err)
+	}
+	if !strings.Contains(out.String(), "has changed") {
+		t.Fatalf("expected changed notice, got %q", out.String())
+	}
+}
+
+func TestExitCodeUsesErrorCode(t *testing.T) {
+	if got := exitCode(errors.New("boom")); got != 1 {
+		t.Fatalf("expected 1 for plain errors, got %d", got)
+	}
+	err := fmt.Errorf("run: %w", &shai.SessionLimitError{Limit: "idle-timeout", Duration: time.Minute})
+	if got := exitCode(err); got != shai.ExitCodeSessionLimit {
+		t.Fatalf("expected %d for session limits, got %d", shai.ExitCodeSessionLimit, got)
+	}
+	if got := exitCode(fmt.Errorf("run: %w", &shai.ExitError{Code: 42, Phase: shai.ExitPhaseCommand})); got != 42 {
+		t.Fatalf("expected command status 42, got %d", got)
+	}
+}
+
+func TestReportOverlay(t *testing.T) {
+	workspace := t.TempDir()
+	root := t.TempDir()
+
+	empty, err := overlay.Create(root, workspace, []string{"."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := reportOverlay(&out, empty); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected no output for an unchanged session, got %q", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, empty.ID)); !os.IsNotExist(err) {
+		t.Fatalf("expected unchanged session to be discarded, got %v", err)
+	}
+
+	session, err := overlay.Create(root, workspace, []string{"."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(session.UpperDir(0), "new.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reportOverlay(&out, session); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"1 added", "new.txt", "shai apply " + session.ID, "shai discard " + session.ID} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in summary, got %q", want, out.String())
+		}
+	}
+}
+
+func TestWorktreeFlag(t *testing.T) {
+	cmd := newRootCmd()
+	if err := cmd.Flags().Parse([]string{"--worktree", "--", "echo"}); err != nil {
+		t.Fatal(err)
+	}
+	if !cmd.Flags().Changed("worktree") {
+		t.Fatal("expected --worktree to be set")
+	}
+	value, _ := cmd.Flags().GetString("worktree")
+	if got := worktreeBranchName(value); got != "" {
+		t.Fatalf("expected bare --worktree to pick a branch, got %q", got)
+	}
+	if got := cmd.Flags().Args(); !reflect.DeepEqual(got, []string{"echo"}) {
+		t.Fatalf("expected command args to be kept, got %v", got)
+	}
+
+	cmd = newRootCmd()
+	if err := cmd.Flags().Parse([]string{"--worktree=agent/a"}); err != nil {
+		t.Fatal(err)
+	}
+	value, _ = cmd.Flags().GetString("worktree")
+	if got := worktreeBranchName(value); got != "agent/a" {
+		t.Fatalf("expected branch agent/a, got %q", got)
+	}
+
+	cmd = newRootCmd()
+	if err := cmd.Flags().Parse([]string{"--branch", "agent/b", "--", "echo"}); err != nil {
+		t.Fatal(err)
+	}
+	value, _ = cmd.Flags().GetString("worktree")
+	branch, _ := cmd.Flags().GetString("branch")
+	if got, err := resolveWorktreeBranch(value, branch); err != nil || got != "agent/b" {
+		t.Fatalf("expected branch agent/b, got %q (%v)", got, err)
+	}
+	if got := cmd.Flags().Args(); !reflect.DeepEqual(got, []string{"echo"}) {
+		t.Fatalf("expected command args to be kept, got %v", got)
+	}
+	if _, err := resolveWorktreeBranch("agent/a", "agent/b"); err == nil {
+		t.Fatal("expected conflicting branch names to fail")
+	}
+	if got, err := resolveWorktreeBranch(worktreeAutoBranch, "agent/b"); err != nil || got != "agent/b" {
+		t.Fatalf("expected bare --worktree with --branch to use agent/b, got %q (%v)", got, err)
+	}
+}
+
+func TestPrintSessions(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)
+	var out strings.Builder
+	if err := printSessions(&out, []shai.SessionInfo{{
+		Name:           "agent-1",
+		Workspace:      "/repo",
+		ReadWritePaths: []string{"app"},
+		ResourceSets:   []string{"base", "go"},
+		Started:        now.Add(-90 * time.Second),
+		HostPID:        4242,
+	}}, now); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"NAME", "agent-1", "/repo", "app", "base,go", "1m30s", "4242"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in output, got %q", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := printSessions(&out, nil, now); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "No running shai sessions") {
+		t.Fatalf("expected empty notice, got %q", out.String())
+	}
+}
+
+func TestCopyLogFollowsUntilWriterExits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.log")
+	writer, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Flock(int(writer.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(writer, "starting")
+
+	reader, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var out bytes.Buffer
+	if err := copyLog(context.Background(), &out, reader, false, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "starting\n" {
+		t.Fatalf("unexpected log output %q", out.String())
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprintln(writer, "done")
+		writer.Close()
+	}()
+	if err := copyLog(context.Background(), &out, reader, true, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "starting\ndone\n" {
+		t.Fatalf("expected follow to read until the writer exits, got %q", out.String())
+	}
+}
+
+func TestKeptSessionName(t *testing.T) {
+	name := keptSessionName("/work/repo")
+	if name != keptSessionName("/work/repo") {
+		t.Fatal("expected the kept name to be stable for a directory")
+	}
+	if name == keptSessionName("/work/other") {
+		t.Fatal("expected different directories to get different kept sandboxes")
+	}
+	if err := shai.ValidateSessionName(name); err != nil {
+		t.Fatalf("kept name %q is not a valid session name: %v", name, err)
+	}
+}
+
+func TestPrintPlan(t *testing.T) {
+	var out strings.Builder
+	err := printPlan(&out, &shai.SandboxPlan{
+		ConfigFile:     "/repo/.shai/config.yaml",
+		Overlay:        "/home/dev/.config/shai/config.yaml",
+		OverlayIgnored: []string{"image"},
+		Trust:          "trusted",
+		Image:          "example/node:20",
+		ImageSource:    "apply",
+		ImageRule:      "web",
+		ImagePath:      "web",
+		ImageFile:      "/repo/.shai/config.yaml",
+		User:           "dev",
+		UserFile:       "/home/dev/.config/shai/config.yaml",
+		Workspace:      "/src/web",
+		ReadWritePaths: []string{"web"},
+		RWMode:         shai.RWModeBind,
+		ResourceSets: []shai.PlanResourceSet{
+			{Name: "web", Requested: true, Matches: []shai.PlanApplyMatch{{Rule: "web", Path: "web"}}},
+			{
+				Name:    "agents",
+				Files:   []string{"/home/dev/.config/shai/config.yaml"},
+				Matches: []shai.PlanApplyMatch{{Rule: "./", Path: ".", File: "/home/dev/.config/shai/config.yaml"}},
+			},
+		},
+		Mounts:   []shai.PlanMount{{Source: "/repo", Target: "/src", Mode: "ro", Origin: "workspace"}},
+		Env:      []shai.PlanVar{{Name: "NPM_TOKEN", Resource: "web", From: "command", AsFile: true}},
+		Hardened: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"/repo/.shai/config.yaml (trusted)",
+		`example/node:20 (apply rule "web" matched web)`,
+		`--resource-set; apply rule "web" matched web`,
+		"/home/dev/.config/shai/config.yaml (locked by the config, not applied: image)",
+		"dev (from /home/dev/.config/shai/config.yaml)",
+		`apply rule "./" matched . (in /home/dev/.config/shai/config.yaml); defined in /home/dev/.config/shai/config.yaml`,
+		"NPM_TOKEN",
+		"from host command, as a file",
+		"Privileged:   no",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in output, got %q", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Calls:") {
+		t.Fatalf("expected empty sections to be omitted, got %q", out.String())
+	}
+}
+
+func TestValidateSchemaOnly(t *testing.T) {
+	t.Setenv("CI", "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := `type: shai-sandbox
+version: 1
+image: ${{ env.SHAI_TEST_UNSET_IMAGE }}
+resources:
+  web:
+    http: [example.com]
+apply:
+  - path: ./
+    resources: [web]
+`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) (string, error) {
+		cmd := newValidateCmd()
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(&out)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	if out, err := run(path); err == nil || !strings.Contains(out, "SHAI_TEST_UNSET_IMAGE") {
+		t.Fatalf("expected a full check to need the env var, got %v: %s", err, out)
+	}
+	if out, err := run("--schema-only", path); err != nil {
+		t.Fatalf("expected schema-only check to pass, got %v: %s", err, out)
+	}
+
+	t.Setenv("CI", "true")
+	if out, err := run(path); err != nil {
+		t.Fatalf("expected schema-only to be the CI default, got %v: %s", err, out)
+	}
+	if _, err := run("--schema-only=false", path); err == nil {
+		t.Fatal("expected --schema-only=false to run the full check in CI")
+	}
+
+	if err := os.WriteFile(path, []byte(config+"colour: blue\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := run("--schema-only", path); err == nil || !strings.Contains(out, `unknown field "colour"`) {
+		t.Fatalf("expected schema-only check to report unknown keys, got %v: %s", err, out)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/colony-2/shai/pkg/shai"
+	"github.com/spf13/cobra"
+)
+
+func newApplyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "apply <session>",
+		Short: "Write the pending changes of an overlay session into the workspace",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := shai.OpenOverlaySession(args[0])
+			if err != nil {
+				return err
+			}
+			changes, err := session.Changes()
+			if err != nil {
+				return err
+			}
+			if err := session.Apply(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Applied %d change(s) from session %s to %s\n", len(changes), session.ID, session.WorkingDir)
+			return nil
+		},
+	}
+}
+
+func newDiscardCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "discard <session>",
+		Short: "Drop the pending changes of an overlay session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, err := shai.OpenOverlaySession(args[0])
+			if err != nil {
+				return err
+			}
+			if err := session.Discard(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Discarded session %s\n", session.ID)
+			return nil
+		},
+	}
+}
+
+// reportOverlay prints the pending changes of session and how to apply or
+// discard them. A session without changes is discarded silently.
+func reportOverlay(out io.Writer, session *shai.OverlaySession) error {
+	changes, err := session.Changes()
+	if err != nil {
+		return fmt.Errorf("read pending changes of session %s: %w", session.ID, err)
+	}
+	if len(changes) == 0 {
+		return session.Discard()
+	}
+	counts := map[shai.ChangeKind]int{}
+	for _, c := range changes {
+		counts[c.Kind]++
+	}
+	fmt.Fprintf(out, "\nshai: session %s has pending changes (%d modified, %d added, %d deleted):\n",
+		session.ID, counts[shai.ChangeModified], counts[shai.ChangeAdded], counts[shai.ChangeDeleted])
+	for _, c := range changes {
+		fmt.Fprintf(out, "  %-8s  %s\n", c.Kind, c.Path)
+	}
+	fmt.Fprintf(out, "Run \"shai apply %s\" to write them to the workspace or \"shai discard %s\" to drop them.\n", session.ID, session.ID)
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/colony-2/shai/pkg/shai"
+	"github.com/spf13/cobra"
+)
+
+func newPsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ps",
+		Short: "List running shai sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sessions, err := shai.ListSessions(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return printSessions(cmd.OutOrStdout(), sessions, time.Now())
+		},
+	}
+}
+
+func printSessions(out io.Writer, sessions []shai.SessionInfo, now time.Time) error {
+	if len(sessions) == 0 {
+		fmt.Fprintln(out, "No running shai sessions")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tWORKSPACE\tREAD-WRITE\tRESOURCE SETS\tUP\tPID")
+	for _, s := range sessions {
+		up := "-"
+		if !s.Started.IsZero() {
+			up = now.Sub(s.Started).Round(time.Second).String()
+		}
+		pid := "-"
+		if s.HostPID > 0 {
+			pid = fmt.Sprint(s.HostPID)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.Workspace,
+			listOrDash(s.ReadWritePaths), listOrDash(s.ResourceSets), up, pid)
+	}
+	return tw.Flush()
+}
+
+func listOrDash(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ",")
+}
+
+func newAttachCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "attach <name>",
+		Short: "Re-attach the terminal to a running shai session (detach with ctrl-p ctrl-q)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return shai.AttachSession(cmd.Context(), args[0])
+		},
+	}
+}
+
+func newStopCmd() *cobra.Command {
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "stop <name>...",
+		Short: "Stop running shai sessions gracefully",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range args {
+				if err := shai.StopSession(cmd.Context(), name, timeout); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Stopped %s\n", name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVarP(&timeout, "timeout", "t", 10*time.Second, "Time to wait for the sandbox to exit before killing it")
+	return cmd
+}
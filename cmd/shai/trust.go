@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/colony-2/shai/internal/shai/runtime/trust"
+	"github.com/colony-2/shai/pkg/shai"
+	"github.com/moby/term"
+	"github.com/spf13/cobra"
+)
+
+func newTrustCmd() *cobra.Command {
+	var templatePairs []string
+	cmd := &cobra.Command{
+		Use:   "trust [config]",
+		Short: "Approve a shai config so its resources can be used",
+		Long:  "Approve the current contents of a shai config (default: ./" + shai.DefaultConfigRelPath + "). Any later change requires approval again.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := trustConfigPath(args)
+			if err != nil {
+				return err
+			}
+			vars, err := parseTemplateVars(templatePairs)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("read shai config: %w", err)
+			}
+			out := cmd.OutOrStdout()
+			if cfg, err := config.Load(path, hostEnv(), vars); err != nil {
+				fmt.Fprintf(out, "Warning: unable to summarize %s: %v\n", path, err)
+			} else {
+				printCapabilities(out, trust.Summary(cfg))
+				if data, err = trust.Content(data, cfg.Includes()); err != nil {
+					return err
+				}
+			}
+			store, err := defaultTrustStore()
+			if err != nil {
+				return err
+			}
+			if err := store.Trust(path, data); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Trusted %s\n", path)
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVarP(&templatePairs, "var", "v", nil, "Template variable used to render the summary (key=value)")
+	return cmd
+}
+
+func newUntrustCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "untrust [config]",
+		Short: "Revoke approval of a shai config",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := trustConfigPath(args)
+			if err != nil {
+				return err
+			}
+			store, err := defaultTrustStore()
+			if err != nil {
+				return err
+			}
+			removed, err := store.Untrust(path)
+			if err != nil {
+				return err
+			}
+			if removed {
+				fmt.Fprintf(cmd.OutOrStdout(), "Untrusted %s\n", path)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s was not trusted\n", path)
+			}
+			return nil
+		},
+	}
+}
+
+func trustConfigPath(args []string) (string, error) {
+	path := shai.DefaultConfigRelPath
+	if len(args) > 0 {
+		path = args[0]
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("resolve config path: %w", err)
+	}
+	return abs, nil
+}
+
+func defaultTrustStore() (*trust.Store, error) {
+	dir, err := trust.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return trust.NewStore(dir), nil
+}
+
+func hostEnv() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// trustPrompter returns an interactive approval callback when stdin is a
+// terminal; without one, untrusted configs fail with instructions instead.
+func trustPrompter() func(shai.TrustRequest) (bool, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return nil
+	}
+	return func(req shai.TrustRequest) (bool, error) {
+		return promptTrust(os.Stdin, os.Stderr, req)
+	}
+}
+
+func promptTrust(in io.Reader, out io.Writer, req shai.TrustRequest) (bool, error) {
+	if req.Changed {
+		fmt.Fprintf(out, "shai: %s has changed since it was trusted.\n", req.ConfigPath)
+	} else {
+		fmt.Fprintf(out, "shai: %s has not been trusted yet.\n", req.ConfigPath)
+	}
+	printCapabilities(out, req.Capabilities)
+	fmt.Fprint(out, "Trust this config? [y/N] ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func printCapabilities(out io.Writer, capabilities []string) {
+	if len(capabilities) == 0 {
+		fmt.Fprintln(out, "It requests no host mounts, commands or privileges.")
+		return
+	}
+	fmt.Fprintln(out, "It requests:")
+	for _, c := range capabilities {
+		fmt.Fprintf(out, "  - %s\n", c)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/colony-2/shai/pkg/shai"
+	"github.com/spf13/cobra"
+)
+
+func newValidateCmd() *cobra.Command {
+	var templatePairs []string
+	var schemaOnly bool
+	cmd := &cobra.Command{
+		Use:   "validate [config...]",
+		Short: "Check shai configs without starting a sandbox",
+		Long: "Load each config (default: ./" + shai.DefaultConfigRelPath + ") the way a run would, rendering templates and " +
+			"applying host policy, and report every problem, including unknown keys with their line and column. " +
+			"With --schema-only, check structure and unknown keys alone, which gives the same answer on every host; " +
+			"it is the default when the CI environment variable is set. " +
+			"Exits non-zero when any config is invalid, for use in CI and pre-commit hooks.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vars, err := parseTemplateVars(templatePairs)
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				args = []string{shai.DefaultConfigRelPath}
+			}
+			check := func(path string) error {
+				_, err := config.Load(path, hostEnv(), vars)
+				return err
+			}
+			if schemaOnly {
+				check = config.CheckSchema
+			}
+			invalid := validateConfigs(cmd.OutOrStdout(), cmd.ErrOrStderr(), args, check)
+			if invalid > 0 {
+				return fmt.Errorf("%d of %d config(s) invalid", invalid, len(args))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVarP(&templatePairs, "var", "v", nil, "Template variable used to render the config (key=value)")
+	cmd.Flags().BoolVar(&schemaOnly, "schema-only", inCI(), "Check structure and unknown keys only, without templates or host policy; on by default when $CI is set")
+	return cmd
+}
+
+// inCI reports whether shai runs under a CI system, which sets CI to a
+// non-empty value other than false.
+func inCI() bool {
+	v := strings.TrimSpace(os.Getenv("CI"))
+	return v != "" && !strings.EqualFold(v, "false") && v != "0"
+}
+
+// validateConfigs runs check on each path, reporting success on out and
+// problems on errOut, and returns how many failed.
+func validateConfigs(out, errOut io.Writer, paths []string, check func(path string) error) int {
+	invalid := 0
+	for _, path := range paths {
+		if err := check(path); err != nil {
+			fmt.Fprintf(errOut, "%s: invalid\n%v\n", path, err)
+			invalid++
+			continue
+		}
+		fmt.Fprintf(out, "%s: ok\n", path)
+	}
+	return invalid
+}
+
+func newSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema for " + shai.DefaultConfigRelPath,
+		Long:  "Print the JSON Schema for shai configs, for editor completion and validation. It is also published at " + config.SchemaID + ".",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := config.Schema()
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(data)
+			return err
+		},
+	}
+}
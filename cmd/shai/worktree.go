@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/colony-2/shai/pkg/shai"
+	"github.com/spf13/cobra"
+)
+
+// worktreeAutoBranch is the --worktree value used when no branch is given;
+// it is not a valid branch name, so it cannot clash with a real one.
+const worktreeAutoBranch = "shai/<timestamp>"
+
+// worktreeBranchName maps the --worktree value to a branch name, where empty
+// lets shai pick one.
+func worktreeBranchName(flag string) string {
+	if flag == worktreeAutoBranch {
+		return ""
+	}
+	return flag
+}
+
+// resolveWorktreeBranch combines --worktree[=branch] and --branch into the
+// branch name, where empty lets shai pick one.
+func resolveWorktreeBranch(worktreeFlag, branchFlag string) (string, error) {
+	name := worktreeBranchName(worktreeFlag)
+	if branchFlag == "" {
+		return name, nil
+	}
+	if name != "" && name != branchFlag {
+		return "", fmt.Errorf("--worktree=%s and --branch %s name different branches", name, branchFlag)
+	}
+	return branchFlag, nil
+}
+
+func newWorktreeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "worktree",
+		Short: "Manage checkouts created with --worktree",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List shai worktrees",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			worktrees, err := shai.ListWorktrees()
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if len(worktrees) == 0 {
+				fmt.Fprintln(out, "No shai worktrees")
+				return nil
+			}
+			tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tBRANCH\tREPOSITORY\tCREATED")
+			for _, w := range worktrees {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", w.ID, w.Branch, w.Repo, w.Created.Local().Format("2006-01-02 15:04"))
+			}
+			return tw.Flush()
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "remove <id>...",
+		Short: "Delete shai worktrees; their branches stay in the source repository",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, id := range args {
+				w, err := shai.OpenWorktree(id)
+				if err != nil {
+					return err
+				}
+				if err := w.Remove(); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Removed worktree %s\n", w.ID)
+			}
+			return nil
+		},
+	})
+	return cmd
+}
+
+// reportWorktree copies the session's branch back into the source repository
+// and tells the user where to review it.
+func reportWorktree(out io.Writer, w *shai.Worktree) error {
+	if err := w.FetchBranch(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nshai: branch %s is ready for review in %s\n", w.Branch, w.Repo)
+	if dirty, err := w.Dirty(); err == nil && dirty {
+		fmt.Fprintf(out, "shai: %s has uncommitted changes that are not on the branch\n", w.Dir())
+	}
+	fmt.Fprintf(out, "Run \"shai worktree remove %s\" to delete the checkout.\n", w.ID)
+	return nil
+}
@@ -0,0 +1,154 @@
+package alias
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/colony-2/shai/internal/shai/runtime/alias/mcp"
+)
+
+const (
+	defaultCredentialTimeout = 30 * time.Second
+	defaultGitUsername       = "x-access-token"
+)
+
+// GitCredentialRule grants credentials produced by a host command to git
+// remotes matching Remote for the listed operations ("fetch", "push").
+type GitCredentialRule struct {
+	Remote     string
+	Operations []string
+	Username   string
+	Command    string
+}
+
+func (r GitCredentialRule) allows(op string) bool {
+	ops := r.Operations
+	if len(ops) == 0 {
+		ops = []string{"fetch"}
+	}
+	for _, allowed := range ops {
+		if strings.EqualFold(strings.TrimSpace(allowed), op) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the rule's remote pattern covers the requested
+// remote. Patterns use path.Match globbing per URL segment; a pattern
+// without a scheme matches any protocol.
+func (r GitCredentialRule) matches(req mcp.CredentialRequest) bool {
+	pattern := strings.TrimSuffix(strings.TrimSpace(r.Remote), ".git")
+	if pattern == "" {
+		return false
+	}
+	remote := strings.ToLower(strings.TrimSpace(req.Host))
+	if p := strings.Trim(strings.TrimSuffix(req.Path, ".git"), "/"); p != "" {
+		remote += "/" + p
+	}
+	if strings.Contains(pattern, "://") {
+		remote = strings.ToLower(req.Protocol) + "://" + remote
+	}
+	ok, err := path.Match(pattern, remote)
+	return err == nil && ok
+}
+
+// gitCredentialProvider resolves credentials by running the first matching
+// rule's command on the host. Tokens are fetched on demand and never stored.
+//
+// The operation and remote come from the sandbox's git, so a rule's
+// operations only pick the rule; the command sees them in SHAI_GIT_OPERATION
+// and SHAI_GIT_REMOTE and must check them itself to enforce anything.
+type gitCredentialProvider struct {
+	exec  *Executor
+	rules []GitCredentialRule
+	// log receives the output of failed commands, which stays on the host.
+	log io.Writer
+}
+
+func newGitCredentialProvider(exec *Executor, rules []GitCredentialRule) *gitCredentialProvider {
+	credExec := &Executor{
+		WorkingDir: exec.WorkingDir,
+		ShellPath:  exec.ShellPath,
+		Timeout:    defaultCredentialTimeout,
+	}
+	return &gitCredentialProvider{exec: credExec, rules: rules, log: os.Stderr}
+}
+
+func (p *gitCredentialProvider) Credential(ctx context.Context, req mcp.CredentialRequest) (*mcp.Credential, error) {
+	op := strings.ToLower(strings.TrimSpace(req.Operation))
+	if op == "" {
+		op = "fetch"
+	}
+	for _, rule := range p.rules {
+		if !rule.matches(req) || !rule.allows(op) {
+			continue
+		}
+		var stdout, stderr bytes.Buffer
+		entry := &Entry{Name: "git-credential", Command: rule.Command}
+		exec := *p.exec
+		exec.Env = []string{"SHAI_GIT_OPERATION=" + op, "SHAI_GIT_REMOTE=" + credentialRemote(req)}
+		result, err := exec.Run(ctx, entry, nil, Streams{Stdout: &stdout, Stderr: &stderr})
+		if err != nil {
+			fmt.Fprintf(p.log, "shai: git credential command for %s: %v\n", rule.Remote, err)
+			return nil, fmt.Errorf("git credential command for %s failed; see the shai output on the host", rule.Remote)
+		}
+		if result.ExitCode != 0 {
+			fmt.Fprintf(p.log, "shai: git credential command for %s exited %d: %s\n", rule.Remote, result.ExitCode, strings.TrimSpace(stderr.String()))
+			return nil, fmt.Errorf("git credential command for %s failed; see the shai output on the host", rule.Remote)
+		}
+		cred := parseCredentialOutput(stdout.String())
+		if cred.Password == "" {
+			return nil, fmt.Errorf("git credential command for %s produced no token", rule.Remote)
+		}
+		switch {
+		case strings.TrimSpace(rule.Username) != "":
+			cred.Username = strings.TrimSpace(rule.Username)
+		case cred.Username != "":
+		case strings.TrimSpace(req.Username) != "":
+			cred.Username = strings.TrimSpace(req.Username)
+		default:
+			cred.Username = defaultGitUsername
+		}
+		return cred, nil
+	}
+	return nil, nil
+}
+
+// credentialRemote formats the requested remote as a URL, such as
+// https://github.com/colony-2/shai.git.
+func credentialRemote(req mcp.CredentialRequest) string {
+	remote := strings.ToLower(strings.TrimSpace(req.Protocol)) + "://" + strings.TrimSpace(req.Host)
+	if p := strings.Trim(req.Path, "/"); p != "" {
+		remote += "/" + p
+	}
+	return remote
+}
+
+// parseCredentialOutput accepts either a bare token or git credential
+// key=value lines (username=..., password=...).
+func parseCredentialOutput(out string) *mcp.Credential {
+	cred := &mcp.Credential{}
+	kv := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "password="):
+			cred.Password = strings.TrimPrefix(line, "password=")
+			kv = true
+		case strings.HasPrefix(line, "username="):
+			cred.Username = strings.TrimPrefix(line, "username=")
+			kv = true
+		}
+	}
+	if !kv {
+		cred.Password = strings.TrimSpace(out)
+	}
+	return cred
+}
@@ -0,0 +1,75 @@
+package alias
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/colony-2/shai/internal/shai/runtime/alias/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitCredentialRuleMatching(t *testing.T) {
+	rule := GitCredentialRule{Remote: "https://github.com/colony-2/*"}
+	req := mcp.CredentialRequest{Protocol: "https", Host: "github.com", Path: "colony-2/shai.git"}
+	require.True(t, rule.matches(req))
+
+	req.Path = "other/shai.git"
+	require.False(t, rule.matches(req))
+
+	req.Path = ""
+	require.False(t, rule.matches(req), "remote without path must not match a path pattern")
+
+	noScheme := GitCredentialRule{Remote: "github.com/colony-2/*"}
+	require.True(t, noScheme.matches(mcp.CredentialRequest{Protocol: "https", Host: "GitHub.com", Path: "colony-2/shai"}))
+
+	require.True(t, rule.allows("fetch"))
+	require.False(t, rule.allows("push"), "rules default to fetch only")
+	require.True(t, GitCredentialRule{Operations: []string{"push"}}.allows("push"))
+}
+
+func TestGitCredentialProviderRunsMatchingRule(t *testing.T) {
+	provider := newGitCredentialProvider(&Executor{WorkingDir: t.TempDir(), ShellPath: "/bin/sh"}, []GitCredentialRule{
+		{Remote: "https://github.com/colony-2/*", Operations: []string{"fetch"}, Command: "echo read-token"},
+		{Remote: "https://github.com/colony-2/*", Operations: []string{"push"}, Username: "bot", Command: "printf 'username=ignored\\npassword=write-token\\n'"},
+		{Remote: "https://gitlab.com/*", Operations: []string{"fetch"}, Command: "exit 3"},
+	})
+	ctx := context.Background()
+
+	cred, err := provider.Credential(ctx, mcp.CredentialRequest{Protocol: "https", Host: "github.com", Path: "colony-2/shai.git", Operation: "fetch"})
+	require.NoError(t, err)
+	require.Equal(t, &mcp.Credential{Username: defaultGitUsername, Password: "read-token"}, cred)
+
+	cred, err = provider.Credential(ctx, mcp.CredentialRequest{Protocol: "https", Host: "github.com", Path: "colony-2/shai.git", Operation: "push"})
+	require.NoError(t, err)
+	require.Equal(t, &mcp.Credential{Username: "bot", Password: "write-token"}, cred)
+
+	cred, err = provider.Credential(ctx, mcp.CredentialRequest{Protocol: "https", Host: "github.com", Path: "elsewhere/repo.git", Operation: "fetch"})
+	require.NoError(t, err)
+	require.Nil(t, cred)
+
+	_, err = provider.Credential(ctx, mcp.CredentialRequest{Protocol: "https", Host: "gitlab.com", Path: "group", Operation: "fetch"})
+	require.ErrorContains(t, err, "git credential command for https://gitlab.com/* failed")
+}
+
+func TestGitCredentialProviderPassesRequestToCommand(t *testing.T) {
+	provider := newGitCredentialProvider(&Executor{WorkingDir: t.TempDir(), ShellPath: "/bin/sh"}, []GitCredentialRule{
+		{Remote: "https://github.com/colony-2/*", Operations: []string{"fetch", "push"}, Command: `echo "$SHAI_GIT_OPERATION $SHAI_GIT_REMOTE"`},
+	})
+	cred, err := provider.Credential(context.Background(), mcp.CredentialRequest{Protocol: "https", Host: "github.com", Path: "colony-2/shai.git", Operation: "push"})
+	require.NoError(t, err)
+	require.Equal(t, "push https://github.com/colony-2/shai.git", cred.Password)
+}
+
+func TestGitCredentialProviderKeepsCommandErrorsOnHost(t *testing.T) {
+	var hostLog bytes.Buffer
+	provider := newGitCredentialProvider(&Executor{WorkingDir: t.TempDir(), ShellPath: "/bin/sh"}, []GitCredentialRule{
+		{Remote: "https://github.com/acme/*", Command: "echo 'vault token hvs.secret expired' >&2; exit 1"},
+	})
+	provider.log = &hostLog
+
+	_, err := provider.Credential(context.Background(), mcp.CredentialRequest{Protocol: "https", Host: "github.com", Path: "acme/repo"})
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "hvs.secret")
+	require.Contains(t, hostLog.String(), "exited 1: vault token hvs.secret expired")
+}
@@ -23,6 +23,8 @@ type Executor struct {
 	WorkingDir string
 	ShellPath  string
 	Timeout    time.Duration
+	// Env is added to the host environment of every command.
+	Env []string
 }
 
 // RunResult captures the outcome of an alias command.
@@ -63,7 +65,7 @@ func (e *Executor) Run(ctx context.Context, entry *Entry, args []string, streams
 
 	cmd := exec.CommandContext(execCtx, shell, "-lc", commandLine)
 	cmd.Dir = e.WorkingDir
-	cmd.Env = os.Environ()
+	cmd.Env = append(os.Environ(), e.Env...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	cmd.Stdout = writerOrDiscard(streams.Stdout)
 	cmd.Stderr = writerOrDiscard(streams.Stderr)
@@ -31,6 +31,34 @@ type Executor interface {
 	Execute(ctx context.Context, name string, args []string, streams Streams) (int, error)
 }
 
+// CredentialRequest describes the git remote a credential is requested for.
+type CredentialRequest struct {
+	Protocol  string `json:"protocol"`
+	Host      string `json:"host"`
+	Path      string `json:"path"`
+	Username  string `json:"username"`
+	Operation string `json:"operation"`
+}
+
+// Credential is a username/password pair handed to the sandbox's git.
+type Credential struct {
+	Username string
+	Password string
+}
+
+// CredentialProvider resolves git credentials on the host. A nil credential
+// with a nil error means no rule matched the request.
+type CredentialProvider interface {
+	Credential(ctx context.Context, req CredentialRequest) (*Credential, error)
+}
+
+// CredentialResult models the getCredential response payload.
+type CredentialResult struct {
+	Found    bool   `json:"found"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
 // Logger emits debug messages from the server.
 type Logger interface {
 	Printf(format string, args ...interface{})
@@ -42,6 +70,7 @@ type Config struct {
 	Token         string
 	SessionID     string
 	Executor      Executor
+	Credentials   CredentialProvider
 	Logger        Logger
 	MaxConcurrent int
 }
@@ -234,6 +263,9 @@ func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
 	case "callTool":
 		resp := s.handleCallTool(r.Context(), req)
 		s.writeResponse(w, resp)
+	case "getCredential":
+		resp := s.handleGetCredential(r.Context(), req)
+		s.writeResponse(w, resp)
 	default:
 		s.writeResponse(w, rpcResponse{
 			JSONRPC: "2.0",
@@ -313,6 +345,55 @@ func (s *Server) handleCallTool(ctx context.Context, req rpcRequest) rpcResponse
 	}
 }
 
+func (s *Server) handleGetCredential(ctx context.Context, req rpcRequest) rpcResponse {
+	if s.cfg.Credentials == nil {
+		return rpcResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result:  CredentialResult{Found: false},
+		}
+	}
+	var params CredentialRequest
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return rpcResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &rpcError{
+				Code:    -32602,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+	cred, err := s.cfg.Credentials.Credential(ctx, params)
+	if err != nil {
+		s.logf("credential lookup for %s://%s/%s failed: %v", params.Protocol, params.Host, params.Path, err)
+		return rpcResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &rpcError{
+				Code:    -32004,
+				Message: err.Error(),
+			},
+		}
+	}
+	if cred == nil {
+		return rpcResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Result:  CredentialResult{Found: false},
+		}
+	}
+	return rpcResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: CredentialResult{
+			Found:    true,
+			Username: cred.Username,
+			Password: cred.Password,
+		},
+	}
+}
+
 func (s *Server) writeResponse(w http.ResponseWriter, resp rpcResponse) {
 	w.Header().Set("Content-Type", "application/json")
 	enc := json.NewEncoder(w)
@@ -93,12 +93,58 @@ func TestServerRequiresAuth(t *testing.T) {
 	}
 }
 
+func TestServerGetCredential(t *testing.T) {
+	creds := &fakeCredentials{cred: &Credential{Username: "x-access-token", Password: "tok"}}
+	server, endpoint := startTestServerWithCredentials(t, &fakeExecutor{}, creds)
+	defer server.Close(context.Background())
+
+	resp := doRequest(t, endpoint, `{"jsonrpc":"2.0","id":3,"method":"getCredential","params":{"protocol":"https","host":"github.com","path":"org/repo.git","operation":"push"}}`)
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+	result := resp.Result.(map[string]any)
+	if result["found"] != true || result["password"] != "tok" || result["username"] != "x-access-token" {
+		t.Fatalf("unexpected credential result %+v", result)
+	}
+	if creds.last.Operation != "push" || creds.last.Path != "org/repo.git" {
+		t.Fatalf("unexpected request forwarded: %+v", creds.last)
+	}
+
+	creds.cred = nil
+	resp = doRequest(t, endpoint, `{"jsonrpc":"2.0","id":4,"method":"getCredential","params":{"protocol":"https","host":"example.com"}}`)
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+	if found := resp.Result.(map[string]any)["found"]; found != false {
+		t.Fatalf("expected found=false, got %v", found)
+	}
+}
+
+func TestServerGetCredentialWithoutProvider(t *testing.T) {
+	server, endpoint := startTestServer(t, &fakeExecutor{})
+	defer server.Close(context.Background())
+
+	resp := doRequest(t, endpoint, `{"jsonrpc":"2.0","id":5,"method":"getCredential","params":{"protocol":"https","host":"github.com"}}`)
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+	if found := resp.Result.(map[string]any)["found"]; found != false {
+		t.Fatalf("expected found=false, got %v", found)
+	}
+}
+
 func startTestServer(t *testing.T, exec Executor) (*Server, string) {
+	t.Helper()
+	return startTestServerWithCredentials(t, exec, nil)
+}
+
+func startTestServerWithCredentials(t *testing.T, exec Executor, creds CredentialProvider) (*Server, string) {
 	t.Helper()
 	cfg := Config{
 		Token:         "secret",
 		SessionID:     "session",
 		Executor:      exec,
+		Credentials:   creds,
 		MaxConcurrent: 1,
 	}
 	server, err := NewServer(cfg)
@@ -154,3 +200,13 @@ func (f *fakeExecutor) Execute(ctx context.Context, name string, args []string,
 	}
 	return 0, nil
 }
+
+type fakeCredentials struct {
+	cred *Credential
+	last CredentialRequest
+}
+
+func (f *fakeCredentials) Credential(ctx context.Context, req CredentialRequest) (*Credential, error) {
+	f.last = req
+	return f.cred, nil
+}
@@ -25,6 +25,7 @@ type Config struct {
 	ShellPath      string
 	Debug          bool
 	Entries        []*Entry
+	GitCredentials []GitCredentialRule
 	DockerHostAddr string
 	MCPBindAddr    string
 }
@@ -95,11 +96,17 @@ func MaybeStart(cfg Config) (*Service, error) {
 		Timeout:    defaultExecTimeout,
 	}
 
+	var credentials mcp.CredentialProvider
+	if len(cfg.GitCredentials) > 0 {
+		credentials = newGitCredentialProvider(executor, cfg.GitCredentials)
+	}
+
 	server, err := mcp.NewServer(mcp.Config{
 		BindAddr:      mcpBindAddr,
 		Token:         token,
 		SessionID:     sessionID,
 		Executor:      newAliasExecutorAdapter(executor, entries),
+		Credentials:   credentials,
 		MaxConcurrent: 4,
 	})
 	if err != nil {
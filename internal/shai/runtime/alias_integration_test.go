@@ -100,6 +100,43 @@ func TestAliasIntegrationMasksManifest(t *testing.T) {
 	time.Sleep(1 * time.Second)
 }
 
+func TestAliasIntegrationHardenedSandboxInstallsHelpers(t *testing.T) {
+	workspace := setupAliasWorkspace(t)
+	cfgPath := filepath.Join(workspace, shai.DefaultConfigRelPath)
+	data, err := os.ReadFile(cfgPath)
+	require.NoError(t, err)
+	withGit := strings.Replace(string(data), "    calls:\n", `    git:
+      - remote: https://github.com/acme/*
+        command: echo host-issued-token
+    calls:
+`, 1)
+	require.NoError(t, os.WriteFile(cfgPath, []byte(withGit), 0o644))
+
+	// The default profile is hardened: the rootfs is read-only, so the
+	// helpers must come from the /run tmpfs.
+	cmd := `
+set -euo pipefail
+if touch /usr/local/bin/shai-probe 2>/dev/null; then echo ROOTFS_WRITABLE; fi
+echo "REMOTE_AT:$(command -v shai-remote)"
+shai-remote call hosthello hardened
+printf 'protocol=https\nhost=github.com\npath=acme/repo.git\n\n' | git credential fill
+`
+	lines, err := runInSandbox(t, workspace, cmd)
+	if err != nil {
+		t.Fatalf("hardened helpers failed: %v\nlogs: %v", err, lines)
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "ROOTFS_WRITABLE") {
+			t.Fatalf("expected a read-only rootfs in the default profile: %v", lines)
+		}
+	}
+	assertContainsSubstring(t, lines, "REMOTE_AT:/run/shai/bin/shai-remote")
+	assertContainsSubstring(t, lines, "HOST_HELLO:hardened")
+	assertContainsSubstring(t, lines, "password=host-issued-token")
+	// wait second or container rm will fail due to macos conccurrency issues with virtiofs
+	time.Sleep(1 * time.Second)
+}
+
 // --- helpers ---
 
 func setupAliasWorkspace(t *testing.T) string {
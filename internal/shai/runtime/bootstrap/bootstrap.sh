@@ -6,6 +6,7 @@ VERBOSE=0
 BOOT_SRC_DIR=$(CDPATH= cd -- "$(dirname -- "$0")" && pwd)
 SHAI_CONF_DIR=${SHAI_CONF_DIR:-$BOOT_SRC_DIR/conf}
 SHAI_RUN_DIR=${SHAI_RUN_DIR:-/run/shai}
+SHAI_BIN_DIR=${SHAI_BIN_DIR:-$SHAI_RUN_DIR/bin}
 SHAI_LOG_DIR=${SHAI_LOG_DIR:-/var/log/shai}
 TINYPROXY_CONF_SRC="$SHAI_CONF_DIR/tinyproxy.conf"
 DNSMASQ_CONF_SRC="$SHAI_CONF_DIR/dnsmasq.conf"
@@ -18,6 +19,8 @@ DNSMASQ_RUN_DIR="$SHAI_RUN_DIR/dnsmasq"
 TINYPROXY_PID_FILE="$TINYPROXY_RUN_DIR/tinyproxy.pid"
 DNSMASQ_PID_FILE="$DNSMASQ_RUN_DIR/dnsmasq.pid"
 PROXY_ENV_FILE="$SHAI_RUN_DIR/proxy-env.sh"
+EXEC_STATE_FILE="$SHAI_RUN_DIR/exec-env.sh"
+EXEC_HELPER="$SHAI_RUN_DIR/exec"
 PROFILE_SNIPPET="/etc/profile.d/zz-shai-proxy.sh"
 SUPERVISOR_LOG="$SHAI_LOG_DIR/supervisord.log"
 SUPERVISOR_PID="$SHAI_RUN_DIR/supervisord.pid"
@@ -135,6 +138,21 @@ render_config() {
     "$src" >"$dest"
 }
 
+# ensure_bin_dir creates the directory shai's helpers are installed into and
+# puts it first on PATH. It lives on /run, which is a tmpfs in hardened
+# sandboxes, so it stays writable when the rootfs is read-only.
+ensure_bin_dir() {
+  if ! mkdir -p "$SHAI_BIN_DIR" 2>/dev/null || [ ! -w "$SHAI_BIN_DIR" ]; then
+    log_verbose "cannot create $SHAI_BIN_DIR; installing helpers on PATH instead"
+    return
+  fi
+  chmod 0755 "$SHAI_RUN_DIR" "$SHAI_BIN_DIR" 2>/dev/null || true
+  case ":${PATH:-}:" in
+    *":$SHAI_BIN_DIR:"*) ;;
+    *) export PATH="$SHAI_BIN_DIR${PATH:+:$PATH}" ;;
+  esac
+}
+
 find_install_dir() {
   local requested=${SHAI_BOOTSTRAP_INSTALL_DIR:-}
   local -a candidates=()
@@ -187,6 +205,94 @@ install_alias_script() {
   fi
 }
 
+# install_git_credential_helper points git at git-credential-shai so HTTPS
+# remotes get host-issued credentials. Root writes the system gitconfig;
+# otherwise the helper is configured through GIT_CONFIG_* for this session.
+install_git_credential_helper() {
+  if [ "$GIT_CREDENTIALS" -ne 1 ]; then
+    return
+  fi
+  local helper_src="$BOOT_SRC_DIR/git-credential-shai"
+  if [ ! -f "$helper_src" ]; then
+    log_verbose "git-credential-shai source missing at $helper_src; skipping"
+    return
+  fi
+  local helper="$helper_src"
+  local dest_dir
+  if dest_dir=$(find_install_dir); then
+    if cp "$helper_src" "$dest_dir/git-credential-shai"; then
+      chmod 0755 "$dest_dir/git-credential-shai" || true
+      helper="$dest_dir/git-credential-shai"
+    fi
+  fi
+
+  if [ "$IS_ROOT" -eq 1 ] && command -v git >/dev/null 2>&1; then
+    if git config --system credential.helper "$helper" &&
+      git config --system credential.useHttpPath true; then
+      log_verbose "configured git credential helper $helper"
+      return
+    fi
+    log_verbose "failed to write system gitconfig; falling back to environment"
+  fi
+  export GIT_CONFIG_COUNT=2
+  export GIT_CONFIG_KEY_0=credential.helper GIT_CONFIG_VALUE_0="$helper"
+  export GIT_CONFIG_KEY_1=credential.useHttpPath GIT_CONFIG_VALUE_1=true
+}
+
+# install_secret_files moves staged as-file vars from the bootstrap mount onto
+# the secrets tmpfs, readable only by the target user, and exports NAME_FILE.
+install_secret_files() {
+  if [ ${#SECRET_FILES[@]} -eq 0 ]; then
+    return
+  fi
+  mkdir -p "$SECRETS_DIR" || die "failed to create secrets dir $SECRETS_DIR"
+  local name src dest
+  for name in "${SECRET_FILES[@]}"; do
+    src="$BOOT_SRC_DIR/private/secrets/$name"
+    dest="$SECRETS_DIR/$name"
+    [ -f "$src" ] || die "staged secret $name missing"
+    cp "$src" "$dest" || die "failed to install secret $name"
+    rm -f "$src" || die "failed to remove staged secret $name"
+    [ ! -e "$src" ] || die "staged secret $name still present"
+    chmod 0400 "$dest"
+    if [ "$IS_ROOT" -eq 1 ]; then
+      chown "$DEV_UID:$DEV_GID" "$dest"
+    fi
+    export "${name}_FILE=$dest"
+    log_verbose "installed secret file $dest"
+  done
+  rmdir "$BOOT_SRC_DIR/private/secrets" 2>/dev/null || true
+  rmdir "$BOOT_SRC_DIR/private" 2>/dev/null || true
+  if [ "$IS_ROOT" -eq 1 ]; then
+    chown "$DEV_UID:$DEV_GID" "$SECRETS_DIR"
+  fi
+  chmod 0500 "$SECRETS_DIR"
+}
+
+# write_exec_state records the user environment and identity and installs the
+# shai-exec helper, so "shai exec" can start processes that match the
+# session's own. The state holds var values, so only its owner may read it.
+write_exec_state() {
+  local helper_src="$BOOT_SRC_DIR/shai-exec"
+  if [ ! -f "$helper_src" ]; then
+    log_verbose "shai-exec source missing at $helper_src; shai exec unavailable"
+    return
+  fi
+  if ! cp "$helper_src" "$EXEC_HELPER" || ! chmod 0700 "$EXEC_HELPER"; then
+    log_verbose "failed to install $EXEC_HELPER; shai exec unavailable"
+    return
+  fi
+  (
+    umask 077
+    {
+      export -p
+      printf 'SHAI_EXEC_USER=%q\nSHAI_EXEC_UID=%q\nSHAI_EXEC_GID=%q\nSHAI_EXEC_HARDENED=%q\n' \
+        "$TARGET_USER" "$DEV_UID" "$DEV_GID" "$HARDENED"
+    } >"$EXEC_STATE_FILE.tmp"
+    mv "$EXEC_STATE_FILE.tmp" "$EXEC_STATE_FILE"
+  ) || log_verbose "failed to write $EXEC_STATE_FILE; shai exec unavailable"
+}
+
 on_exit() {
   if [ "$VERBOSE" -eq 1 ]; then
     status=$?
@@ -207,13 +313,20 @@ DNS_PORT=${DNS_PORT:-1053}
 REQUESTED_DEV_UID=${DEV_UID:-4747}
 REQUESTED_DEV_GID=${DEV_GID:-$REQUESTED_DEV_UID}
 RM_SELF="false"
+GIT_CREDENTIALS=0
+HARDENED=0
 
 declare -a EXEC_ENVS=()
 declare -a EXEC_CMD=()
 declare -a HTTP_ALLOW=()
 declare -a PORT_ALLOW=()
+declare -a HOST_PORTS=()
+declare -a PUBLISH_PORTS=()
 declare -a RESOURCE_NAMES=()
 declare -a ROOT_CMDS=()
+declare -a SECRET_FILES=()
+EXEC_ENV_FILE=""
+SECRETS_DIR=${SECRETS_DIR:-/run/shai-secrets}
 
 require_arg() {
   if [ $# -lt 2 ]; then
@@ -243,6 +356,11 @@ while [ $# -gt 0 ]; do
       EXEC_ENVS+=("$2")
       shift 2
       ;;
+    --exec-env-file)
+      require_arg "$@"
+      EXEC_ENV_FILE="$2"
+      shift 2
+      ;;
     --exec-cmd)
       require_arg "$@"
       EXEC_CMD+=("$2")
@@ -258,6 +376,16 @@ while [ $# -gt 0 ]; do
       PORT_ALLOW+=("$2")
       shift 2
       ;;
+    --host-port)
+      require_arg "$@"
+      HOST_PORTS+=("$2")
+      shift 2
+      ;;
+    --publish-port)
+      require_arg "$@"
+      PUBLISH_PORTS+=("$2")
+      shift 2
+      ;;
     --rm)
       require_arg "$@"
       RM_SELF="$2"
@@ -278,6 +406,19 @@ while [ $# -gt 0 ]; do
       ROOT_CMDS+=("$2")
       shift 2
       ;;
+    --secret-file)
+      require_arg "$@"
+      SECRET_FILES+=("$2")
+      shift 2
+      ;;
+    --git-credentials)
+      GIT_CREDENTIALS=1
+      shift
+      ;;
+    --hardened)
+      HARDENED=1
+      shift
+      ;;
     --verbose)
       VERBOSE=1
       shift
@@ -288,6 +429,17 @@ while [ $# -gt 0 ]; do
   esac
 done
 
+# Secrets arrive in a NUL-separated file rather than on the command line so
+# they stay out of docker inspect and ps; drop it as soon as it is read.
+if [ -n "$EXEC_ENV_FILE" ]; then
+  [ -f "$EXEC_ENV_FILE" ] || die "exec env file $EXEC_ENV_FILE missing"
+  while IFS= read -r -d '' pair; do
+    EXEC_ENVS+=("$pair")
+  done <"$EXEC_ENV_FILE"
+  rm -f "$EXEC_ENV_FILE" || die "failed to remove exec env file $EXEC_ENV_FILE"
+  [ ! -e "$EXEC_ENV_FILE" ] || die "exec env file $EXEC_ENV_FILE still present"
+fi
+
 [ -z "$VERSION" ] && die "--version is required"
 [ -z "$TARGET_USER" ] && die "--user is required"
 [ -z "$WORKSPACE" ] && die "--workspace is required"
@@ -296,6 +448,7 @@ if [ "$VERSION" != "1" ]; then
   die "unsupported config version $VERSION"
 fi
 
+ensure_bin_dir
 install_alias_script
 
 if [ ! -d "$SHAI_CONF_DIR" ]; then
@@ -523,6 +676,32 @@ dev_egress_setup() {
       fi
     done
 
+    if [ ${#HOST_PORTS[@]} -gt 0 ]; then
+      if [ -n "$docker_host_ip" ]; then
+        for mapping in "${HOST_PORTS[@]}"; do
+          local local_port=${mapping%%:*}
+          local relay_port=${mapping##*:}
+          if [ -z "$local_port" ] || [ -z "$relay_port" ]; then
+            continue
+          fi
+          log_verbose "forwarding localhost:${local_port} to ${docker_host_name}:${relay_port}"
+          ensure_rule nat OUTPUT -p tcp -d 127.0.0.1 --dport "$local_port" -j DNAT --to-destination "${docker_host_ip}:${relay_port}"
+          ensure_rule nat POSTROUTING -p tcp -s 127.0.0.1 -d "$docker_host_ip" --dport "$relay_port" -j MASQUERADE
+          ensure_rule filter OUTPUT -m owner --uid-owner "$dev_uid" -p tcp -d "$docker_host_ip" --dport "$relay_port" -j ACCEPT
+        done
+      else
+        log "warning: unable to resolve $docker_host_name; host ports will not be forwarded"
+      fi
+    fi
+
+    # Published ports accept inbound connections from the host; let replies
+    # from those sockets out without opening new outbound connections.
+    for published in "${PUBLISH_PORTS[@]}"; do
+      [ -z "$published" ] && continue
+      log_verbose "allowing replies from published port $published"
+      ensure_rule filter OUTPUT -m owner --uid-owner "$dev_uid" -p tcp --sport "$published" -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
+    done
+
     ensure_rule filter OUTPUT -m owner --uid-owner "$dev_uid" -j REJECT
     if [ "$VERBOSE" -eq 1 ]; then
       iptables -S OUTPUT || true
@@ -738,6 +917,15 @@ main() {
   fi
 
   reconcile_target_user
+  install_git_credential_helper
+  install_secret_files
+
+  # The filtered ssh-agent socket is created by the host user; make sure the
+  # sandbox user can reach it when host and sandbox uids differ.
+  if [ "$IS_ROOT" -eq 1 ] && [ -S "${SSH_AUTH_SOCK:-}" ]; then
+    chown "$DEV_UID:$DEV_GID" "$(dirname "$SSH_AUTH_SOCK")" "$SSH_AUTH_SOCK" 2>/dev/null || \
+      debug "unable to chown ssh-agent socket $SSH_AUTH_SOCK"
+  fi
 
   log_verbose "bootstrap start (uid=${EUID:-$(id -u)}, dev_uid=$DEV_UID, dev_gid=$DEV_GID, proxy_port=$PROXY_PORT)"
 
@@ -829,6 +1017,10 @@ main() {
   no_proxy="localhost,127.0.0.1,::1"
 
   cat >"$PROXY_ENV_FILE" <<EOF
+case ":\$PATH:" in
+  *":$SHAI_BIN_DIR:"*) ;;
+  *) if [ -d "$SHAI_BIN_DIR" ]; then export PATH="$SHAI_BIN_DIR:\$PATH"; fi ;;
+esac
 export HTTP_PROXY="$proxy_url"
 export HTTPS_PROXY="$proxy_url"
 export http_proxy="$proxy_url"
@@ -902,6 +1094,9 @@ EOF
     done
   fi
 
+  # Written last, so its presence also tells shai the sandbox is ready.
+  write_exec_state
+
   argv=("${EXEC_CMD[@]}")
   if [ ${#argv[@]} -eq 0 ]; then
     argv=("$user_shell" "-l")
@@ -918,9 +1113,21 @@ EOF
   printf '%s\n' "$summary_message"
 
   if [ "$IS_ROOT" -eq 1 ]; then
+    # Both switches keep the environment built above and run the command
+    # through the user's shell, as su -p does, so BASH_ENV and the shell's
+    # startup files apply the same way hardened or not.
+    export SHELL="$user_shell"
+    export LOGNAME="$TARGET_USER"
+    cmd=$(printf '%q ' "${argv[@]}")
+    cmd=${cmd% }
+    if [ "$HARDENED" -eq 1 ]; then
+      if command -v setpriv >/dev/null 2>&1; then
+        exec setpriv --reuid="$DEV_UID" --regid="$DEV_GID" --init-groups \
+          --inh-caps=-all --bounding-set=-all --no-new-privs -- "$user_shell" -c "$cmd"
+      fi
+      log "warning: setpriv missing; capabilities stay in the bounding set of $TARGET_USER's session"
+    fi
     if command -v su >/dev/null 2>&1; then
-      cmd=$(printf '%q ' "${argv[@]}")
-      cmd=${cmd% }
       exec su -p "$TARGET_USER" -c "$cmd"
     elif command -v runuser >/dev/null 2>&1; then
       exec runuser -u "$TARGET_USER" --preserve-environment -- "${argv[@]}"
@@ -0,0 +1,122 @@
+#!/bin/bash
+# git-credential-shai: git credential helper that asks the shai host for a
+# credential over the alias channel. Tokens are minted on the host per request
+# and never written inside the sandbox; store/erase are therefore no-ops.
+set -u
+
+endpoint=${SHAI_ALIAS_ENDPOINT-}
+token=${SHAI_ALIAS_TOKEN-}
+
+debug() {
+	if [ -n "${SHAI_ALIAS_DEBUG-}" ] && [ "${SHAI_ALIAS_DEBUG}" != "0" ]; then
+		printf 'git-credential-shai[debug]: %s\n' "$*" >&2
+	fi
+}
+
+# git_operation inspects a git argv and prints "push" or "fetch", or returns
+# non-zero when the process is plumbing that should be skipped.
+git_operation() {
+	local base=${1##*/}
+	shift
+	case "$base" in
+		git-send-pack) printf 'push'; return 0 ;;
+		git-fetch-pack|git-upload-pack) printf 'fetch'; return 0 ;;
+		git) ;;
+		*) return 1 ;;
+	esac
+	while [ $# -gt 0 ]; do
+		case "$1" in
+			-C|-c|--git-dir|--work-tree|--namespace|--exec-path|--config-env)
+				shift 2
+				continue
+				;;
+			-*)
+				shift
+				continue
+				;;
+			push|send-pack)
+				printf 'push'
+				return 0
+				;;
+			credential*|remote-*)
+				return 1
+				;;
+			*)
+				printf 'fetch'
+				return 0
+				;;
+		esac
+	done
+	return 1
+}
+
+# detect_operation walks up the process tree to find the git command that
+# triggered this lookup.
+detect_operation() {
+	local pid=$PPID depth=0 stat op
+	local -a argv
+	while [ "$pid" -gt 1 ] && [ "$depth" -lt 16 ]; do
+		if [ -r "/proc/$pid/cmdline" ]; then
+			mapfile -d '' -t argv <"/proc/$pid/cmdline" 2>/dev/null || argv=()
+			if [ ${#argv[@]} -gt 0 ] && op=$(git_operation "${argv[@]}"); then
+				printf '%s' "$op"
+				return
+			fi
+		fi
+		stat=$(cat "/proc/$pid/stat" 2>/dev/null) || break
+		stat=${stat##*) }
+		pid=$(printf '%s' "$stat" | cut -d' ' -f2)
+		depth=$((depth + 1))
+	done
+	printf 'fetch'
+}
+
+main() {
+	if [ "${1-}" != "get" ]; then
+		exit 0
+	fi
+	if [ -z "$endpoint" ] || [ -z "$token" ]; then
+		debug "alias endpoint not configured"
+		exit 0
+	fi
+	if ! command -v curl >/dev/null 2>&1 || ! command -v jq >/dev/null 2>&1; then
+		debug "curl and jq are required"
+		exit 0
+	fi
+
+	local protocol="" host="" path="" username="" line
+	while IFS= read -r line; do
+		[ -z "$line" ] && break
+		case "$line" in
+			protocol=*) protocol=${line#protocol=} ;;
+			host=*) host=${line#host=} ;;
+			path=*) path=${line#path=} ;;
+			username=*) username=${line#username=} ;;
+		esac
+	done
+
+	local operation payload response
+	operation=$(detect_operation)
+	debug "requesting $operation credential for $protocol://$host/$path"
+	payload=$(jq -nc --arg protocol "$protocol" --arg host "$host" --arg path "$path" \
+		--arg username "$username" --arg operation "$operation" '
+		{jsonrpc:"2.0",id:1,method:"getCredential",
+		 params:{protocol:$protocol,host:$host,path:$path,username:$username,operation:$operation}}') || exit 0
+	response=$(printf '%s' "$payload" | curl --noproxy '*' -sS \
+		-H "Authorization: Bearer ${token}" \
+		-H "Content-Type: application/json" \
+		--data-binary @- \
+		"${endpoint}") || exit 0
+
+	if printf '%s' "$response" | jq -e '.error' >/dev/null 2>&1; then
+		printf 'git-credential-shai: %s\n' "$(printf '%s' "$response" | jq -r '.error.message // "credential lookup failed"')" >&2
+		exit 0
+	fi
+	if ! printf '%s' "$response" | jq -e '.result.found == true' >/dev/null 2>&1; then
+		debug "no credential rule matched"
+		exit 0
+	fi
+	printf '%s' "$response" | jq -r '"username=\(.result.username)\npassword=\(.result.password)"'
+}
+
+main "$@"
@@ -8,5 +8,11 @@ var Script []byte
 //go:embed shai-remote.sh
 var AliasScript []byte
 
+//go:embed git-credential-shai.sh
+var GitCredentialScript []byte
+
+//go:embed shai-exec.sh
+var ExecScript []byte
+
 //go:embed conf/tinyproxy.conf conf/dnsmasq.conf conf/dnsmasq.d/*
 var ConfFS embed.FS
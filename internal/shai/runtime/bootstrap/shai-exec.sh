@@ -0,0 +1,79 @@
+#!/usr/bin/env bash
+# shai-exec starts a process in a running sandbox as the sandbox user, with
+# the environment and working directory of the session's own process.
+# Bootstrap installs it as $SHAI_RUN_DIR/exec; shai runs it as root through
+# docker exec.
+#
+# Usage: exec [--workdir DIR] [--env NAME]... [-- command [args...]]
+#
+# --env NAME keeps the value NAME has in the docker exec environment instead
+# of the session's, so values never appear on a command line.
+set -euo pipefail
+
+SHAI_RUN_DIR=${SHAI_RUN_DIR:-/run/shai}
+STATE_FILE="$SHAI_RUN_DIR/exec-env.sh"
+
+# shai reads a final "shai-exec: " line with status 125 as a setup failure
+# rather than the command's own status.
+die() {
+  echo "shai-exec: $*" >&2
+  exit 125
+}
+
+workdir=""
+declare -a envs=()
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --workdir)
+      [ $# -ge 2 ] || die "--workdir requires a value"
+      workdir="$2"
+      shift 2
+      ;;
+    --env)
+      [ $# -ge 2 ] || die "--env requires a value"
+      envs+=("$2=${!2-}")
+      shift 2
+      ;;
+    --)
+      shift
+      break
+      ;;
+    *)
+      break
+      ;;
+  esac
+done
+
+[ -r "$STATE_FILE" ] || die "sandbox is still starting; try again shortly"
+# shellcheck source=/dev/null
+. "$STATE_FILE"
+
+for pair in "${envs[@]}"; do
+  export "${pair%%=*}"="${pair#*=}"
+done
+
+cd "${workdir:-$SHAI_WORKSPACE}" || die "failed to enter ${workdir:-$SHAI_WORKSPACE}"
+
+if [ $# -eq 0 ]; then
+  shell=$(getent passwd "$SHAI_EXEC_USER" | cut -d: -f7 || true)
+  set -- "${shell:-/bin/bash}" -l
+fi
+
+if [ "${EUID:-$(id -u)}" -ne 0 ]; then
+  exec "$@"
+fi
+if command -v setpriv >/dev/null 2>&1; then
+  if [ "$SHAI_EXEC_HARDENED" = "1" ]; then
+    exec setpriv --reuid="$SHAI_EXEC_UID" --regid="$SHAI_EXEC_GID" --init-groups \
+      --inh-caps=-all --bounding-set=-all --no-new-privs -- "$@"
+  fi
+  exec setpriv --reuid="$SHAI_EXEC_UID" --regid="$SHAI_EXEC_GID" --init-groups -- "$@"
+fi
+if command -v runuser >/dev/null 2>&1; then
+  exec runuser -u "$SHAI_EXEC_USER" --preserve-environment -- "$@"
+fi
+if command -v su >/dev/null 2>&1; then
+  cmd=$(printf '%q ' "$@")
+  exec su -p "$SHAI_EXEC_USER" -c "${cmd% }"
+fi
+die "unable to switch to $SHAI_EXEC_USER (setpriv/runuser/su missing)"
@@ -755,3 +755,69 @@ apply:
 	result := output.String()
 	assert.Contains(t, result, "CONTAINER_VAR=host_value_123", "Resource env var should be injected from host")
 }
+
+// Staged vars and as-file values must not outlive bootstrap.
+func TestBootstrap_RemovesStagedPrivateFiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	t.Setenv("TEST_HOST_VAR", "host_value_123")
+	t.Setenv("TEST_HOST_SECRET", "secret_value_456")
+
+	tmpDir := t.TempDir()
+	configContent := `
+type: shai-sandbox
+version: 1
+image: ghcr.io/colony-2/shai-base:latest
+user: shai
+resources:
+  test:
+    vars:
+      - source: TEST_HOST_VAR
+        target: CONTAINER_VAR
+      - source: TEST_HOST_SECRET
+        target: CONTAINER_SECRET
+        as-file: true
+apply:
+  - path: ./
+    resources: [test]
+`
+	configPath := filepath.Join(tmpDir, ".shai", "config.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(configPath), 0755))
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	script := `echo CONTAINER_VAR=$CONTAINER_VAR
+cat "$CONTAINER_SECRET_FILE"; echo
+for f in /shai-bootstrap/private/exec.env /shai-bootstrap/private/secrets/CONTAINER_SECRET; do
+  if [ -e "$f" ]; then echo "STAGED_PRESENT $f"; fi
+done`
+	var output strings.Builder
+	cfg := EphemeralConfig{
+		WorkingDir:   tmpDir,
+		ConfigFile:   configPath,
+		Verbose:      testing.Verbose(),
+		ShowProgress: false,
+		Stdout:       &output,
+		PostSetupExec: &ExecSpec{
+			Command: []string{"sh", "-c", script},
+			UseTTY:  false,
+		},
+	}
+
+	runner, err := NewEphemeralRunner(cfg)
+	require.NoError(t, err)
+	defer runner.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	require.NoError(t, runner.Run(ctx))
+
+	result := output.String()
+	assert.Contains(t, result, "CONTAINER_VAR=host_value_123")
+	assert.Contains(t, result, "secret_value_456")
+	assert.NotContains(t, result, "STAGED_PRESENT")
+	_, err = os.Stat(filepath.Join(runner.bootstrapMount, bootstrapPrivateDir, execEnvFileName))
+	assert.True(t, os.IsNotExist(err), "exec env file should be gone from the host mount")
+}
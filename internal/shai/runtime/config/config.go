@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 
@@ -14,8 +16,17 @@ import (
 const (
 	expectedType    = "shai-sandbox"
 	expectedVersion = 1
+
+	// DefaultWorkspace is where the working directory is mounted when the
+	// config does not set a workspace.
+	DefaultWorkspace = "/src"
+	// BootstrapMountTarget is reserved for shai's bootstrap files; the
+	// workspace and resource mounts may not overlap it.
+	BootstrapMountTarget = "/shai-bootstrap"
 )
 
+var envNameRx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // Config represents the parsed .shai/config.yaml configuration.
 type Config struct {
 	Type      string                  `yaml:"type"`
@@ -23,34 +34,77 @@ type Config struct {
 	Image     string                  `yaml:"image"`
 	User      string                  `yaml:"user"`
 	Workspace string                  `yaml:"workspace"`
+	Limits    Limits                  `yaml:"limits"`
+	Mask      []string                `yaml:"mask"`
 	Resources map[string]*ResourceSet `yaml:"resources"`
 	Apply     []ApplyRule             `yaml:"apply"`
+	// Include lists files whose resource sets and mask patterns are merged
+	// into this config.
+	Include []string `yaml:"include"`
+	// Locked lists fields the user overlay may not change.
+	Locked []string `yaml:"locked"`
 
 	sourcePath string
 	sourceDir  string
 	resolved   []pathResources
+	// includes lists the included files and origins the files each value
+	// came from; see Origin.
+	includes []string
+	origins  map[string][]string
+	// overlayPath is the user overlay merged in, if any, and overlayIgnored
+	// the locked fields it tried to change.
+	overlayPath    string
+	overlayIgnored []string
 }
 
 // ResourceSet groups runtime resources (env vars, mounts, calls).
 type ResourceSet struct {
+	// Extends names resource sets this one builds on; see mergeResourceSets.
+	Extends      []string        `yaml:"extends"`
 	Vars         []VarMapping    `yaml:"vars"`
 	Mounts       []Mount         `yaml:"mounts"`
 	Calls        []Call          `yaml:"calls"`
 	HTTP         []string        `yaml:"http"`
 	Ports        []Port          `yaml:"ports"`
+	HostPorts    []HostPort      `yaml:"host-ports"`
+	PortsOut     []PublishedPort `yaml:"ports-out"`
+	SSHAgent     *SSHAgent       `yaml:"ssh-agent"`
+	Git          []GitCredential `yaml:"git"`
 	RootCommands []string        `yaml:"root-commands"`
+	Limits       Limits          `yaml:"limits"`
+	Mask         []string        `yaml:"mask"`
 	Options      ResourceOptions `yaml:"options"`
 }
 
 // ResourceOptions contains optional resource set configuration.
 type ResourceOptions struct {
 	Privileged bool `yaml:"privileged"`
+	// Hardening set to "off" disables the hardened container profile
+	// (read-only rootfs, dropped capabilities, seccomp) for the session.
+	Hardening string `yaml:"hardening"`
 }
 
-// VarMapping defines a host->container variable mapping.
+// VarMapping defines a host->container variable mapping. Exactly one of
+// Source (host env var), File, Command or Keychain supplies the value; AsFile
+// delivers it as a file on a tmpfs instead of an environment variable.
 type VarMapping struct {
-	Source string `yaml:"source"`
-	Target string `yaml:"target"`
+	Source   string `yaml:"source"`
+	File     string `yaml:"file"`
+	Command  string `yaml:"command"`
+	Keychain string `yaml:"keychain"`
+	Target   string `yaml:"target"`
+	AsFile   bool   `yaml:"as-file"`
+}
+
+// SourceCount returns how many value sources are set on the mapping.
+func (v VarMapping) SourceCount() int {
+	n := 0
+	for _, s := range []string{v.Source, v.File, v.Command, v.Keychain} {
+		if strings.TrimSpace(s) != "" {
+			n++
+		}
+	}
+	return n
 }
 
 // Mount describes a host mount.
@@ -81,11 +135,54 @@ type Port struct {
 	Port int    `yaml:"port"`
 }
 
+// HostPort forwards a port bound to the host's loopback interface into the
+// sandbox, where it is reachable on localhost.
+type HostPort struct {
+	Port   int `yaml:"port"`
+	Target int `yaml:"target"`
+}
+
+// ContainerPort returns the sandbox-side localhost port, defaulting to Port.
+func (h HostPort) ContainerPort() int {
+	if h.Target != 0 {
+		return h.Target
+	}
+	return h.Port
+}
+
+// PublishedPort exposes a sandbox port on the host's loopback interface.
+// HostPort 0 selects the same port when free, otherwise any free port.
+type PublishedPort struct {
+	Port     int `yaml:"port"`
+	HostPort int `yaml:"host-port"`
+}
+
+// SSHAgent forwards the host ssh-agent into the sandbox through a filtering
+// proxy. Only the listed key fingerprints are visible and usable; with
+// RestrictHosts, signatures are limited to hosts in the resource set's ports.
+type SSHAgent struct {
+	Keys          []string `yaml:"keys"`
+	RestrictHosts bool     `yaml:"restrict-hosts"`
+}
+
+// GitCredential lets the sandbox's git obtain a credential for matching HTTPS
+// remotes from a host command. Operations defaults to fetch only; it is
+// reported by the sandbox, so it selects a rule but only the command, which
+// sees SHAI_GIT_OPERATION and SHAI_GIT_REMOTE, can enforce it.
+type GitCredential struct {
+	Remote     string   `yaml:"remote"`
+	Operations []string `yaml:"operations"`
+	Username   string   `yaml:"username"`
+	Command    string   `yaml:"command"`
+}
+
 // ApplyRule maps a workspace path to resource set names.
 type ApplyRule struct {
 	Path      string   `yaml:"path"`
 	Resources []string `yaml:"resources"`
 	Image     string   `yaml:"image"`
+
+	origin string
 }
 
 type pathResources struct {
@@ -100,8 +197,24 @@ type ResolvedResource struct {
 	Spec *ResourceSet
 }
 
+// LoadOptions selects optional sources merged into a loaded config.
+type LoadOptions struct {
+	// UserConfig merges the user's own config, ~/.config/shai/config.yaml,
+	// over the loaded one.
+	UserConfig bool
+	// WorkingDir is the directory relative mounts[].source and vars[].file
+	// entries resolve against when host policy checks them. It defaults to
+	// the directory holding .shai, or the current directory.
+	WorkingDir string
+}
+
 // Load parses and validates a .shai/config.yaml file with template expansion.
+// It reads only path and the files it includes.
 func Load(path string, env map[string]string, vars map[string]string) (*Config, error) {
+	return load(path, env, vars, LoadOptions{})
+}
+
+func load(path string, env map[string]string, vars map[string]string, opts LoadOptions) (*Config, error) {
 	if env == nil {
 		env = map[string]string{}
 	}
@@ -113,7 +226,7 @@ func Load(path string, env map[string]string, vars map[string]string) (*Config,
 	if err != nil {
 		return nil, fmt.Errorf("read shai config: %w", err)
 	}
-	return loadFromData(data, path, env, vars)
+	return loadFromData(data, path, env, vars, opts)
 }
 
 func (c *Config) applyTemplates(env, vars, conf map[string]string) error {
@@ -132,53 +245,8 @@ func (c *Config) applyTemplates(env, vars, conf map[string]string) error {
 	}
 
 	for name, res := range c.Resources {
-		for i := range res.Vars {
-			res.Vars[i].Source, err = expandTemplates(res.Vars[i].Source, env, vars, conf)
-			if err != nil {
-				return fmt.Errorf("resource %s var[%d] source: %w", name, i, err)
-			}
-			res.Vars[i].Target, err = expandTemplates(res.Vars[i].Target, env, vars, conf)
-			if err != nil {
-				return fmt.Errorf("resource %s var[%d] target: %w", name, i, err)
-			}
-		}
-		for i := range res.Mounts {
-			res.Mounts[i].Source, err = expandTemplates(res.Mounts[i].Source, env, vars, conf)
-			if err != nil {
-				return fmt.Errorf("resource %s mount[%d] source: %w", name, i, err)
-			}
-			res.Mounts[i].Target, err = expandTemplates(res.Mounts[i].Target, env, vars, conf)
-			if err != nil {
-				return fmt.Errorf("resource %s mount[%d] target: %w", name, i, err)
-			}
-		}
-		for i := range res.Calls {
-			res.Calls[i].Description, err = expandTemplates(res.Calls[i].Description, env, vars, conf)
-			if err != nil {
-				return fmt.Errorf("resource %s call[%d] description: %w", name, i, err)
-			}
-			res.Calls[i].Command, err = expandTemplates(res.Calls[i].Command, env, vars, conf)
-			if err != nil {
-				return fmt.Errorf("resource %s call[%d] command: %w", name, i, err)
-			}
-		}
-		for i := range res.HTTP {
-			res.HTTP[i], err = expandTemplates(res.HTTP[i], env, vars, conf)
-			if err != nil {
-				return fmt.Errorf("resource %s http[%d]: %w", name, i, err)
-			}
-		}
-		for i := range res.Ports {
-			res.Ports[i].Host, err = expandTemplates(res.Ports[i].Host, env, vars, conf)
-			if err != nil {
-				return fmt.Errorf("resource %s port[%d] host: %w", name, i, err)
-			}
-		}
-		for i := range res.RootCommands {
-			res.RootCommands[i], err = expandTemplates(res.RootCommands[i], env, vars, conf)
-			if err != nil {
-				return fmt.Errorf("resource %s root-commands[%d]: %w", name, i, err)
-			}
+		if err := res.applyTemplates(name, env, vars, conf); err != nil {
+			return c.resourceErr(name, err)
 		}
 	}
 	for i := range c.Apply {
@@ -205,38 +273,220 @@ func (c *Config) validate() error {
 		return errors.New("image is required")
 	}
 	// User and workspace now have defaults, so they're not required in config
+	if err := validateMountTarget(c.Workspace); err != nil {
+		return fmt.Errorf("workspace %w", err)
+	}
 	if len(c.Resources) == 0 {
 		return errors.New("resources section is required")
 	}
+	if _, err := c.Limits.Resolve(); err != nil {
+		return fmt.Errorf("limits: %w", err)
+	}
+	if err := validateMask(c.Mask); err != nil {
+		return err
+	}
+	if err := c.validateLocked(); err != nil {
+		return err
+	}
 	for name, res := range c.Resources {
-		for i := range res.Mounts {
-			mode := strings.ToLower(strings.TrimSpace(res.Mounts[i].Mode))
-			if mode == "" {
-				mode = "ro"
-			}
-			if mode != "ro" && mode != "rw" {
-				return fmt.Errorf("resource %s mount[%d] has invalid mode %q", name, i, res.Mounts[i].Mode)
-			}
-			res.Mounts[i].Mode = mode
+		if err := res.validate(name); err != nil {
+			return c.resourceErr(name, err)
+		}
+	}
+	if len(c.Apply) == 0 {
+		return errors.New("apply rules are required")
+	}
+	return nil
+}
+
+func (res *ResourceSet) applyTemplates(name string, env, vars, conf map[string]string) error {
+	var err error
+	for i := range res.Vars {
+		res.Vars[i].Source, err = expandTemplates(res.Vars[i].Source, env, vars, conf)
+		if err != nil {
+			return fmt.Errorf("resource %s var[%d] source: %w", name, i, err)
+		}
+		res.Vars[i].Target, err = expandTemplates(res.Vars[i].Target, env, vars, conf)
+		if err != nil {
+			return fmt.Errorf("resource %s var[%d] target: %w", name, i, err)
+		}
+	}
+	for i := range res.Mounts {
+		res.Mounts[i].Source, err = expandTemplates(res.Mounts[i].Source, env, vars, conf)
+		if err != nil {
+			return fmt.Errorf("resource %s mount[%d] source: %w", name, i, err)
+		}
+		res.Mounts[i].Target, err = expandTemplates(res.Mounts[i].Target, env, vars, conf)
+		if err != nil {
+			return fmt.Errorf("resource %s mount[%d] target: %w", name, i, err)
+		}
+	}
+	for i := range res.Calls {
+		res.Calls[i].Description, err = expandTemplates(res.Calls[i].Description, env, vars, conf)
+		if err != nil {
+			return fmt.Errorf("resource %s call[%d] description: %w", name, i, err)
+		}
+		res.Calls[i].Command, err = expandTemplates(res.Calls[i].Command, env, vars, conf)
+		if err != nil {
+			return fmt.Errorf("resource %s call[%d] command: %w", name, i, err)
+		}
+	}
+	for i := range res.HTTP {
+		res.HTTP[i], err = expandTemplates(res.HTTP[i], env, vars, conf)
+		if err != nil {
+			return fmt.Errorf("resource %s http[%d]: %w", name, i, err)
+		}
+	}
+	for i := range res.Ports {
+		res.Ports[i].Host, err = expandTemplates(res.Ports[i].Host, env, vars, conf)
+		if err != nil {
+			return fmt.Errorf("resource %s port[%d] host: %w", name, i, err)
 		}
-		for i := range res.Calls {
-			if strings.TrimSpace(res.Calls[i].Name) == "" {
-				return fmt.Errorf("resource %s call[%d] missing name", name, i)
+	}
+	for i := range res.RootCommands {
+		res.RootCommands[i], err = expandTemplates(res.RootCommands[i], env, vars, conf)
+		if err != nil {
+			return fmt.Errorf("resource %s root-commands[%d]: %w", name, i, err)
+		}
+	}
+	return nil
+}
+
+func (res *ResourceSet) validate(name string) error {
+	if _, err := res.Limits.Resolve(); err != nil {
+		return fmt.Errorf("resource %s limits: %w", name, err)
+	}
+	if err := validateMask(res.Mask); err != nil {
+		return fmt.Errorf("resource %s %w", name, err)
+	}
+	switch strings.ToLower(strings.TrimSpace(res.Options.Hardening)) {
+	case "", "on", "off":
+	default:
+		return fmt.Errorf("resource %s options.hardening must be on or off (got %q)", name, res.Options.Hardening)
+	}
+	for i, vm := range res.Vars {
+		if vm.SourceCount() != 1 {
+			return fmt.Errorf("resource %s vars[%d] must set exactly one of source, file, command, keychain", name, i)
+		}
+		target := strings.TrimSpace(vm.Target)
+		if target == "" && strings.TrimSpace(vm.Source) == "" {
+			return fmt.Errorf("resource %s vars[%d] requires target", name, i)
+		}
+		if target != "" && !envNameRx.MatchString(target) {
+			return fmt.Errorf("resource %s vars[%d] has invalid target %q", name, i, vm.Target)
+		}
+	}
+	for i := range res.Mounts {
+		mode := strings.ToLower(strings.TrimSpace(res.Mounts[i].Mode))
+		if mode == "" {
+			mode = "ro"
+		}
+		if mode != "ro" && mode != "rw" {
+			return fmt.Errorf("resource %s mount[%d] has invalid mode %q", name, i, res.Mounts[i].Mode)
+		}
+		res.Mounts[i].Mode = mode
+		if err := validateMountTarget(res.Mounts[i].Target); err != nil {
+			return fmt.Errorf("resource %s mount[%d] target %w", name, i, err)
+		}
+	}
+	seenHostPorts := map[int]bool{}
+	for i, hp := range res.HostPorts {
+		if hp.Port < 1 || hp.Port > 65535 {
+			return fmt.Errorf("resource %s host-ports[%d] has invalid port %d", name, i, hp.Port)
+		}
+		if hp.Target < 0 || hp.Target > 65535 {
+			return fmt.Errorf("resource %s host-ports[%d] has invalid target %d", name, i, hp.Target)
+		}
+		if seenHostPorts[hp.ContainerPort()] {
+			return fmt.Errorf("resource %s host-ports[%d] duplicates target port %d", name, i, hp.ContainerPort())
+		}
+		seenHostPorts[hp.ContainerPort()] = true
+	}
+	for i, pp := range res.PortsOut {
+		if pp.Port < 1 || pp.Port > 65535 {
+			return fmt.Errorf("resource %s ports-out[%d] has invalid port %d", name, i, pp.Port)
+		}
+		if pp.HostPort < 0 || pp.HostPort > 65535 {
+			return fmt.Errorf("resource %s ports-out[%d] has invalid host-port %d", name, i, pp.HostPort)
+		}
+	}
+	if res.SSHAgent != nil {
+		if len(res.SSHAgent.Keys) == 0 {
+			return fmt.Errorf("resource %s ssh-agent requires at least one key fingerprint", name)
+		}
+		for i, key := range res.SSHAgent.Keys {
+			if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(key)), "SHA256:") {
+				return fmt.Errorf("resource %s ssh-agent keys[%d] must be a SHA256 fingerprint (got %q)", name, i, key)
 			}
-			if strings.TrimSpace(res.Calls[i].Command) == "" {
-				return fmt.Errorf("resource %s call[%d] missing command", name, i)
+		}
+		if res.SSHAgent.RestrictHosts && len(res.Ports) == 0 {
+			return fmt.Errorf("resource %s ssh-agent restrict-hosts requires ports", name)
+		}
+	}
+	for i := range res.Git {
+		g := &res.Git[i]
+		if strings.TrimSpace(g.Remote) == "" {
+			return fmt.Errorf("resource %s git[%d] missing remote", name, i)
+		}
+		if _, err := path.Match(g.Remote, ""); err != nil {
+			return fmt.Errorf("resource %s git[%d] invalid remote pattern %q: %w", name, i, g.Remote, err)
+		}
+		if strings.TrimSpace(g.Command) == "" {
+			return fmt.Errorf("resource %s git[%d] missing command", name, i)
+		}
+		for j, op := range g.Operations {
+			op = strings.ToLower(strings.TrimSpace(op))
+			if op != "fetch" && op != "push" {
+				return fmt.Errorf("resource %s git[%d] operations[%d] must be fetch or push (got %q)", name, i, j, g.Operations[j])
 			}
-			if res.Calls[i].AllowedArgs != "" {
-				rx, err := regexp.Compile(res.Calls[i].AllowedArgs)
-				if err != nil {
-					return fmt.Errorf("resource %s call[%s] invalid allowed-args regex: %w", name, res.Calls[i].Name, err)
-				}
-				res.Calls[i].allowedRx = rx
+			g.Operations[j] = op
+		}
+	}
+	for i := range res.Calls {
+		if strings.TrimSpace(res.Calls[i].Name) == "" {
+			return fmt.Errorf("resource %s call[%d] missing name", name, i)
+		}
+		if strings.TrimSpace(res.Calls[i].Command) == "" {
+			return fmt.Errorf("resource %s call[%d] missing command", name, i)
+		}
+		if res.Calls[i].AllowedArgs != "" {
+			rx, err := regexp.Compile(res.Calls[i].AllowedArgs)
+			if err != nil {
+				return fmt.Errorf("resource %s call[%s] invalid allowed-args regex: %w", name, res.Calls[i].Name, err)
 			}
+			res.Calls[i].allowedRx = rx
 		}
 	}
-	if len(c.Apply) == 0 {
-		return errors.New("apply rules are required")
+	return nil
+}
+
+// validateMountTarget checks an in-container mount path: it must be absolute
+// and must not overlap the bootstrap mount.
+func validateMountTarget(target string) error {
+	if !path.IsAbs(target) {
+		return fmt.Errorf("%q must be an absolute path", target)
+	}
+	clean := path.Clean(target)
+	if clean == BootstrapMountTarget || strings.HasPrefix(clean, BootstrapMountTarget+"/") || strings.HasPrefix(BootstrapMountTarget, strings.TrimSuffix(clean, "/")+"/") {
+		return fmt.Errorf("%q collides with the reserved %s mount", target, BootstrapMountTarget)
+	}
+	return nil
+}
+
+// validateMask checks mask globs. A leading "!" removes a pattern, including
+// a default one, from the mask list.
+func validateMask(patterns []string) error {
+	for i, p := range patterns {
+		p = strings.TrimPrefix(strings.TrimSpace(p), "!")
+		if p == "" {
+			return fmt.Errorf("mask[%d] is empty", i)
+		}
+		if strings.Contains(p, "..") {
+			return fmt.Errorf("mask[%d] %q must stay inside the workspace", i, patterns[i])
+		}
+		if _, err := path.Match(strings.Trim(p, "/"), ""); err != nil {
+			return fmt.Errorf("mask[%d] invalid pattern %q: %w", i, patterns[i], err)
+		}
 	}
 	return nil
 }
@@ -261,6 +511,9 @@ func (c *Config) resolvePaths() error {
 			if !ok {
 				return fmt.Errorf("apply path %q references unknown resource %q", rule.Path, name)
 			}
+			if rule.origin != c.overlayPath && c.overlayOnly(name) {
+				return fmt.Errorf("apply path %q references resource %q, which only the user config %s defines", rule.Path, name, c.overlayPath)
+			}
 			resList = append(resList, &ResolvedResource{Name: name, Spec: res})
 		}
 		resolved = append(resolved, pathResources{Path: path, Resources: resList, Image: image})
@@ -339,13 +592,23 @@ func (c *Config) ResourcesForPath(path string) []*ResolvedResource {
 
 // ImageForPath returns the first image override that matches the provided path.
 func (c *Config) ImageForPath(path string) (string, bool) {
+	rule, ok := c.ImageRuleForPath(path)
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSpace(rule.Image), true
+}
+
+// ImageRuleForPath returns the most specific apply rule with an image that
+// matches the provided path.
+func (c *Config) ImageRuleForPath(path string) (ApplyRule, bool) {
 	candidate := normalizePath(path)
 	var (
-		image    string
+		rule     ApplyRule
 		matched  bool
 		matchLen int
 	)
-	for _, pr := range c.resolved {
+	for i, pr := range c.resolved {
 		if pr.Image == "" {
 			continue
 		}
@@ -355,29 +618,56 @@ func (c *Config) ImageForPath(path string) (string, bool) {
 				length = len(strings.Split(pr.Path, "/"))
 			}
 			if !matched || length > matchLen {
-				image = pr.Image
+				rule = c.Apply[i]
 				matched = true
 				matchLen = length
 			}
 		}
 	}
-	return image, matched
+	return rule, matched
+}
+
+// ApplyRulesForPath returns the apply rules that match a workspace-relative
+// path, in config order.
+func (c *Config) ApplyRulesForPath(path string) []ApplyRule {
+	candidate := normalizePath(path)
+	var out []ApplyRule
+	for i, pr := range c.resolved {
+		if pathMatches(pr.Path, candidate) {
+			out = append(out, c.Apply[i])
+		}
+	}
+	return out
 }
 
-func loadFromData(data []byte, path string, env, vars map[string]string) (*Config, error) {
+func loadFromData(data []byte, path string, env, vars map[string]string, opts LoadOptions) (*Config, error) {
 	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("parse shai config: %w", err)
 	}
+	if err := checkKnownFields(data, path, reflect.TypeOf(cfg)); err != nil {
+		return nil, err
+	}
 	cfg.sourcePath = path
 	cfg.sourceDir = filepath.Dir(path)
-
+	cfg.recordOrigins()
+	if err := cfg.resolveIncludes(env, vars); err != nil {
+		return nil, err
+	}
+	if opts.UserConfig {
+		if err := cfg.applyOverlay(); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.resolveExtends(); err != nil {
+		return nil, err
+	}
 	// Apply defaults for optional fields
 	if strings.TrimSpace(cfg.User) == "" {
 		cfg.User = "shai"
 	}
 	if strings.TrimSpace(cfg.Workspace) == "" {
-		cfg.Workspace = "/src"
+		cfg.Workspace = DefaultWorkspace
 	}
 
 	// First expand user and workspace fields (they can use env and vars but not conf)
@@ -405,12 +695,34 @@ func loadFromData(data []byte, path string, env, vars map[string]string) (*Confi
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
+	policies, err := loadPolicies()
+	if err != nil {
+		return nil, err
+	}
+	workingDir := opts.WorkingDir
+	if workingDir == "" && len(policies) > 0 {
+		workingDir = defaultWorkingDir(path)
+	}
+	for _, policy := range policies {
+		if err := policy.Check(&cfg, env, workingDir); err != nil {
+			return nil, err
+		}
+	}
 	if err := cfg.resolvePaths(); err != nil {
 		return nil, err
 	}
 	return &cfg, nil
 }
 
+// defaultWorkingDir guesses the workspace a config at path belongs to.
+func defaultWorkingDir(path string) string {
+	if dir := filepath.Dir(path); filepath.Base(dir) == ".shai" {
+		return filepath.Dir(dir)
+	}
+	wd, _ := os.Getwd()
+	return wd
+}
+
 // ResolveResources returns unique resource sets for the provided workspace-relative paths.
 func (c *Config) ResolveResources(paths []string) []*ResolvedResource {
 	if len(paths) == 0 {
@@ -212,7 +212,7 @@ func TestLoadOrDefaultFallsBack(t *testing.T) {
 
 	// Provide HOME environment variable for template expansion in default config
 	env := map[string]string{"HOME": "/home/testuser"}
-	cfg, usedDefault, err := LoadOrDefault(path, env, map[string]string{})
+	cfg, usedDefault, err := LoadOrDefault(path, env, map[string]string{}, LoadOptions{})
 	require.NoError(t, err)
 	assert.True(t, usedDefault)
 	require.NotNil(t, cfg)
@@ -243,9 +243,339 @@ apply:
     resources: [base]
 `)
 
-	cfg, usedDefault, err := LoadOrDefault(path, map[string]string{}, map[string]string{})
+	cfg, usedDefault, err := LoadOrDefault(path, map[string]string{}, map[string]string{}, LoadOptions{})
 	require.NoError(t, err)
 	assert.False(t, usedDefault)
 	require.NotNil(t, cfg)
 	assert.Equal(t, "dev", cfg.User)
 }
+
+func TestLoadConfigHostPorts(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  db:
+    host-ports:
+      - port: 5432
+      - port: 8080
+        target: 3000
+apply:
+  - path: ./
+    resources: [db]
+`)
+	cfg, err := Load(path, map[string]string{}, map[string]string{})
+	require.NoError(t, err)
+	ports := cfg.Resources["db"].HostPorts
+	require.Len(t, ports, 2)
+	assert.Equal(t, 5432, ports[0].ContainerPort())
+	assert.Equal(t, 3000, ports[1].ContainerPort())
+}
+
+func TestLoadConfigHostPortsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  db:
+    host-ports:
+      - port: 0
+apply:
+  - path: ./
+    resources: [db]
+`)
+	_, err := Load(path, map[string]string{}, map[string]string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resource db host-ports[0] has invalid port 0")
+
+	path = writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  db:
+    host-ports:
+      - port: 5432
+      - port: 15432
+        target: 5432
+apply:
+  - path: ./
+    resources: [db]
+`)
+	_, err = Load(path, map[string]string{}, map[string]string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicates target port 5432")
+}
+
+func TestLoadConfigSSHAgent(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  git-push:
+    ports:
+      - host: github.com
+        port: 22
+    ssh-agent:
+      keys: ["SHA256:abc"]
+      restrict-hosts: true
+apply:
+  - path: ./
+    resources: [git-push]
+`)
+	cfg, err := Load(path, map[string]string{}, map[string]string{})
+	require.NoError(t, err)
+	agent := cfg.Resources["git-push"].SSHAgent
+	require.NotNil(t, agent)
+	assert.Equal(t, []string{"SHA256:abc"}, agent.Keys)
+	assert.True(t, agent.RestrictHosts)
+
+	path = writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  git-push:
+    ssh-agent:
+      keys: ["MD5:aa:bb"]
+apply:
+  - path: ./
+    resources: [git-push]
+`)
+	_, err = Load(path, map[string]string{}, map[string]string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resource git-push ssh-agent keys[0] must be a SHA256 fingerprint")
+
+	path = writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  git-push:
+    ssh-agent:
+      keys: ["SHA256:abc"]
+      restrict-hosts: true
+apply:
+  - path: ./
+    resources: [git-push]
+`)
+	_, err = Load(path, map[string]string{}, map[string]string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ssh-agent restrict-hosts requires ports")
+}
+
+func TestLoadConfigGitCredentials(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  github:
+    git:
+      - remote: https://github.com/colony-2/*
+        operations: [Fetch, push]
+        command: gh auth token
+apply:
+  - path: ./
+    resources: [github]
+`)
+	cfg, err := Load(path, map[string]string{}, map[string]string{})
+	require.NoError(t, err)
+	rules := cfg.Resources["github"].Git
+	require.Len(t, rules, 1)
+	assert.Equal(t, []string{"fetch", "push"}, rules[0].Operations)
+
+	path = writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  github:
+    git:
+      - remote: https://github.com/colony-2/*
+        operations: [clone]
+        command: gh auth token
+apply:
+  - path: ./
+    resources: [github]
+`)
+	_, err = Load(path, map[string]string{}, map[string]string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resource github git[0] operations[0] must be fetch or push")
+
+	path = writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  github:
+    git:
+      - remote: https://github.com/colony-2/*
+apply:
+  - path: ./
+    resources: [github]
+`)
+	_, err = Load(path, map[string]string{}, map[string]string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resource github git[0] missing command")
+}
+
+func TestLoadConfigVarSources(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  secrets:
+    vars:
+      - source: TOKEN
+      - file: ~/.config/openai/key
+        target: OPENAI_API_KEY
+      - command: op read op://vault/item/token
+        target: VAULT_TOKEN
+        as-file: true
+      - keychain: npm-token
+        target: NPM_TOKEN
+apply:
+  - path: ./
+    resources: [secrets]
+`)
+	cfg, err := Load(path, map[string]string{}, map[string]string{})
+	require.NoError(t, err)
+	vars := cfg.Resources["secrets"].Vars
+	require.Len(t, vars, 4)
+	assert.Equal(t, "~/.config/openai/key", vars[1].File)
+	assert.True(t, vars[2].AsFile)
+	assert.Equal(t, "npm-token", vars[3].Keychain)
+
+	for _, tc := range []struct {
+		body string
+		want string
+	}{
+		{"      - source: TOKEN\n        file: /tmp/key\n", "vars[0] must set exactly one of source, file, command, keychain"},
+		{"      - command: echo hi\n", "vars[0] requires target"},
+		{"      - file: /tmp/key\n        target: BAD-NAME\n", "vars[0] has invalid target \"BAD-NAME\""},
+	} {
+		path = writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  secrets:
+    vars:
+`+tc.body+`apply:
+  - path: ./
+    resources: [secrets]
+`)
+		_, err = Load(path, map[string]string{}, map[string]string{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), tc.want)
+	}
+}
+
+func TestLoadConfigHardeningOption(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  legacy:
+    options:
+      hardening: off
+apply:
+  - path: ./
+    resources: [legacy]
+`)
+	cfg, err := Load(path, map[string]string{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "off", cfg.Resources["legacy"].Options.Hardening)
+
+	path = writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  legacy:
+    options:
+      hardening: partial
+apply:
+  - path: ./
+    resources: [legacy]
+`)
+	_, err = Load(path, map[string]string{}, nil)
+	require.ErrorContains(t, err, "options.hardening must be on or off")
+}
+
+func TestLoadConfigMask(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+mask:
+  - terraform.tfstate
+  - "!.netrc"
+resources:
+  infra:
+    mask: [secrets/]
+apply:
+  - path: ./
+    resources: [infra]
+`)
+	cfg, err := Load(path, map[string]string{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"terraform.tfstate", "!.netrc"}, cfg.Mask)
+	assert.Equal(t, []string{"secrets/"}, cfg.Resources["infra"].Mask)
+
+	path = writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  infra:
+    mask: ["../outside"]
+apply:
+  - path: ./
+    resources: [infra]
+`)
+	_, err = Load(path, map[string]string{}, nil)
+	require.ErrorContains(t, err, "resource infra mask[0]")
+}
+
+func TestLoadConfigMountTargets(t *testing.T) {
+	dir := t.TempDir()
+	load := func(workspace, target string) error {
+		path := writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+workspace: `+workspace+`
+resources:
+  base:
+    mounts:
+      - source: cache
+        target: `+target+`
+apply:
+  - path: ./
+    resources: [base]
+`)
+		_, err := Load(path, map[string]string{}, nil)
+		return err
+	}
+
+	require.NoError(t, load("/work", "/home/shai/.cache"))
+	require.ErrorContains(t, load("/shai-bootstrap/src", "/cache"), "workspace")
+	require.ErrorContains(t, load("/", "/cache"), "collides")
+	require.ErrorContains(t, load("work", "/cache"), "absolute")
+	require.ErrorContains(t, load("/work", "/shai-bootstrap"), "resource base mount[0] target")
+	require.ErrorContains(t, load("/work", "cache"), "absolute")
+}
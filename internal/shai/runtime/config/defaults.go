@@ -18,14 +18,14 @@ func GetDefaultConfigBytes() []byte {
 
 // LoadOrDefault loads the config at path, or falls back to the embedded default when missing.
 // Returns true when the embedded default was used.
-func LoadOrDefault(path string, env map[string]string, vars map[string]string) (*Config, bool, error) {
+func LoadOrDefault(path string, env map[string]string, vars map[string]string, opts LoadOptions) (*Config, bool, error) {
 	if _, err := os.Stat(path); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			cfg, err := loadFromData(embeddedDefault, path, env, vars)
+			cfg, err := loadFromData(embeddedDefault, path, env, vars, opts)
 			return cfg, true, err
 		}
 		return nil, false, fmt.Errorf("stat shai config: %w", err)
 	}
-	cfg, err := Load(path, env, vars)
+	cfg, err := load(path, env, vars, opts)
 	return cfg, false, err
 }
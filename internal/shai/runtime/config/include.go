@@ -0,0 +1,236 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// library is the content of a file pulled in with include: shared resource
+// sets and mask patterns, and further includes.
+type library struct {
+	Include   []string                `yaml:"include"`
+	Resources map[string]*ResourceSet `yaml:"resources"`
+	Mask      []string                `yaml:"mask"`
+}
+
+// Includes returns the absolute paths of the files the config included,
+// directly or through other includes, in load order.
+func (c *Config) Includes() []string {
+	return c.includes
+}
+
+// resourceErr names the files a resource set came from when it was included
+// or merged from the user overlay, so errors point at the file to fix.
+func (c *Config) resourceErr(name string, err error) error {
+	files := c.origins["resources."+name]
+	if len(files) == 0 || (len(files) == 1 && files[0] == c.sourcePath) {
+		return err
+	}
+	return fmt.Errorf("%s: %w", strings.Join(files, ", "), err)
+}
+
+// resolveIncludes loads the files listed in c.Include, and recursively in
+// theirs. Included resource sets are added to c.Resources; a name defined in
+// two files is an error. Included mask patterns come before c's own.
+func (c *Config) resolveIncludes(env, vars map[string]string) error {
+	own := c.Mask
+	c.Mask = nil
+	seen := map[string]bool{}
+	if abs, err := filepath.Abs(c.sourcePath); err == nil {
+		seen[abs] = true
+	}
+	origin := map[string]string{}
+	for name := range c.Resources {
+		origin[name] = c.sourcePath
+	}
+	if err := c.includeFiles(c.sourcePath, c.Include, env, vars, seen, origin); err != nil {
+		return err
+	}
+	c.Mask = append(c.Mask, own...)
+	return nil
+}
+
+func (c *Config) includeFiles(from string, includes []string, env, vars map[string]string, seen map[string]bool, origin map[string]string) error {
+	for i, inc := range includes {
+		file, err := includePath(from, inc, env, vars)
+		if err != nil {
+			return fmt.Errorf("%s: include[%d]: %w", from, i, err)
+		}
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("%s: include %s: %w", from, inc, err)
+		}
+		var lib library
+		if err := yaml.Unmarshal(data, &lib); err != nil {
+			return fmt.Errorf("parse included shai config %s: %w", file, err)
+		}
+		if err := checkKnownFields(data, file, reflect.TypeOf(lib)); err != nil {
+			return err
+		}
+		c.includes = append(c.includes, file)
+		if err := c.includeFiles(file, lib.Include, env, vars, seen, origin); err != nil {
+			return err
+		}
+		for name, res := range lib.Resources {
+			if other, ok := origin[name]; ok {
+				return fmt.Errorf("resource set %q is defined in both %s and %s", name, other, file)
+			}
+			origin[name] = file
+			if c.Resources == nil {
+				c.Resources = map[string]*ResourceSet{}
+			}
+			c.Resources[name] = res
+			c.origins["resources."+name] = []string{file}
+		}
+		c.Mask = append(c.Mask, lib.Mask...)
+	}
+	return nil
+}
+
+// includePath resolves an include entry: templates are expanded, "~/" is the
+// home directory and relative paths start at the including file's directory.
+func includePath(from, inc string, env, vars map[string]string) (string, error) {
+	p, err := expandTemplates(strings.TrimSpace(inc), env, vars, map[string]string{})
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("resolve home directory: %w", err)
+		}
+		p = filepath.Join(home, strings.TrimPrefix(p, "~"))
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(filepath.Dir(from), p)
+	}
+	return filepath.Abs(p)
+}
+
+// resolveExtends replaces every resource set that extends others with the
+// merge of its parents, in order, and its own entries.
+func (c *Config) resolveExtends() error {
+	done := map[string]bool{}
+	var resolve func(name string, chain []string) error
+	resolve = func(name string, chain []string) error {
+		if done[name] {
+			return nil
+		}
+		for _, prev := range chain {
+			if prev == name {
+				cycle := append(append([]string{}, chain...), name)
+				return c.resourceErr(chain[0], fmt.Errorf("resource %s has an extends cycle: %s", chain[0], strings.Join(cycle, " -> ")))
+			}
+		}
+		res := c.Resources[name]
+		if res == nil || len(res.Extends) == 0 {
+			done[name] = true
+			return nil
+		}
+		merged := &ResourceSet{}
+		for _, parent := range res.Extends {
+			parent = strings.TrimSpace(parent)
+			if _, ok := c.Resources[parent]; !ok {
+				return c.resourceErr(name, fmt.Errorf("resource %s extends unknown resource set %q", name, parent))
+			}
+			if err := resolve(parent, append(chain, name)); err != nil {
+				return err
+			}
+			merged = mergeResourceSets(merged, c.Resources[parent])
+		}
+		c.Resources[name] = mergeResourceSets(merged, res)
+		done[name] = true
+		return nil
+	}
+	for name := range c.Resources {
+		if err := resolve(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeResourceSets layers child over parent into a new set. Keyed lists
+// (vars by target, mounts by target, calls by name, host-ports by target
+// port, ports-out by port, git by remote) keep the parent's order and let
+// the child replace an entry with the same key; other lists are concatenated
+// without duplicates. In limits and options, fields the child sets win,
+// except privileged, which either can turn on.
+func mergeResourceSets(parent, child *ResourceSet) *ResourceSet {
+	out := &ResourceSet{
+		Vars: mergeKeyed(parent.Vars, child.Vars, func(v VarMapping) string {
+			if t := strings.TrimSpace(v.Target); t != "" {
+				return t
+			}
+			return strings.TrimSpace(v.Source)
+		}),
+		Mounts:       mergeKeyed(parent.Mounts, child.Mounts, func(m Mount) string { return m.Target }),
+		Calls:        mergeKeyed(parent.Calls, child.Calls, func(c Call) string { return c.Name }),
+		HTTP:         mergeKeyed(parent.HTTP, child.HTTP, func(s string) string { return s }),
+		Ports:        mergeKeyed(parent.Ports, child.Ports, func(p Port) string { return p.Host + ":" + strconv.Itoa(p.Port) }),
+		HostPorts:    mergeKeyed(parent.HostPorts, child.HostPorts, func(h HostPort) string { return strconv.Itoa(h.ContainerPort()) }),
+		PortsOut:     mergeKeyed(parent.PortsOut, child.PortsOut, func(p PublishedPort) string { return strconv.Itoa(p.Port) }),
+		Git:          mergeKeyed(parent.Git, child.Git, func(g GitCredential) string { return g.Remote }),
+		RootCommands: mergeKeyed(parent.RootCommands, child.RootCommands, func(s string) string { return s }),
+		Mask:         mergeKeyed(parent.Mask, child.Mask, func(s string) string { return s }),
+		SSHAgent:     parent.SSHAgent,
+		Limits:       parent.Limits,
+		Options:      parent.Options,
+	}
+	if child.SSHAgent != nil {
+		out.SSHAgent = child.SSHAgent
+	}
+	mergeNonZero(&out.Limits, child.Limits)
+	out.Options.Privileged = parent.Options.Privileged || child.Options.Privileged
+	if strings.TrimSpace(child.Options.Hardening) != "" {
+		out.Options.Hardening = child.Options.Hardening
+	}
+	return out
+}
+
+// mergeKeyed returns a new list of parent's items with child's layered on
+// top: an item whose key is already present replaces it in place, others are
+// appended.
+func mergeKeyed[T any](parent, child []T, key func(T) string) []T {
+	if len(parent) == 0 && len(child) == 0 {
+		return nil
+	}
+	out := make([]T, 0, len(parent)+len(child))
+	index := map[string]int{}
+	for _, items := range [][]T{parent, child} {
+		for _, item := range items {
+			k := key(item)
+			if i, ok := index[k]; ok {
+				out[i] = item
+				continue
+			}
+			index[k] = len(out)
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// mergeNonZero copies the fields of src that are set onto dst.
+func mergeNonZero[T any](dst *T, src T) {
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src)
+	for i := 0; i < sv.NumField(); i++ {
+		if !sv.Field(i).IsZero() {
+			dv.Field(i).Set(sv.Field(i))
+		}
+	}
+}
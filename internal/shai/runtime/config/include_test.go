@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMergesIncludesAndExtends(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared", "resources.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(shared), 0o755))
+	require.NoError(t, os.WriteFile(shared, []byte(`
+resources:
+  base:
+    vars:
+      - source: TOKEN
+      - source: REGION
+    http: [github.com]
+    calls:
+      - name: deploy
+        command: ./deploy.sh
+mask: [secrets/**]
+`), 0o644))
+	path := writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example/image:1
+include: [../shared/resources.yaml]
+resources:
+  web:
+    extends: [base]
+    vars:
+      - source: PROD_REGION
+        target: REGION
+    http: [github.com, npmjs.org]
+    calls:
+      - name: deploy
+        command: ./deploy.sh --dry-run
+mask: [dist/**]
+apply:
+  - path: ./
+    resources: [web]
+`)
+
+	cfg, err := Load(path, map[string]string{"TOKEN": "t", "PROD_REGION": "eu"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{shared}, cfg.Includes())
+	assert.Equal(t, []string{"secrets/**", "dist/**"}, cfg.Mask)
+
+	web := cfg.Resources["web"]
+	require.NotNil(t, web)
+	assert.Equal(t, []VarMapping{{Source: "TOKEN"}, {Source: "PROD_REGION", Target: "REGION"}}, web.Vars)
+	assert.Equal(t, []string{"github.com", "npmjs.org"}, web.HTTP)
+	require.Len(t, web.Calls, 1)
+	assert.Equal(t, "./deploy.sh --dry-run", web.Calls[0].Command)
+	assert.Len(t, cfg.Resources["base"].Vars, 2)
+}
+
+func TestLoadIncludeErrorsNameTheFile(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.yaml")
+	main := `
+type: shai-sandbox
+version: 1
+image: example/image:1
+include: [../lib.yaml]
+resources:
+  web:
+    http: [github.com]
+apply:
+  - path: ./
+    resources: [web]
+`
+
+	require.NoError(t, os.WriteFile(lib, []byte("resources:\n  web:\n    http: [example.com]\n"), 0o644))
+	path := writeConfig(t, dir, main)
+	_, err := Load(path, nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `resource set "web" is defined in both `+path+" and "+lib)
+
+	require.NoError(t, os.WriteFile(lib, []byte("resources:\n  tools:\n    mounts:\n      - source: /opt\n        target: opt\n"), 0o644))
+	_, err = Load(path, nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), lib+": resource tools mount[0] target")
+
+	require.NoError(t, os.WriteFile(lib, []byte("resources:\n  tools:\n    htp: [example.com]\n"), 0o644))
+	_, err = Load(path, nil, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), lib+":3:5: unknown field \"htp\" in resources.tools (did you mean \"http\"?)")
+}
+
+func TestLoadRejectsExtendsCycles(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `
+type: shai-sandbox
+version: 1
+image: example/image:1
+resources:
+  a:
+    extends: [b]
+  b:
+    extends: [a]
+apply:
+  - path: ./
+    resources: [a]
+`)
+
+	_, err := Load(path, nil, nil)
+	require.Error(t, err)
+	assert.Regexp(t, `extends cycle: (a -> b -> a|b -> a -> b)$`, err.Error())
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+// Limits caps the resources a sandbox may consume. Sizes use Docker notation
+// such as "512m" or "4g". Unset fields impose no limit.
+type Limits struct {
+	CPUs       float64 `yaml:"cpus"`
+	Memory     string  `yaml:"memory"`
+	MemorySwap string  `yaml:"memory-swap"`
+	Pids       int64   `yaml:"pids"`
+	// Tmpfs sizes the tmpfs mounts shai creates (such as /tmp when hardened).
+	Tmpfs string `yaml:"tmpfs"`
+	// Storage caps the container's writable layer where the storage driver
+	// supports it.
+	Storage string `yaml:"storage"`
+	// MaxDuration and IdleTimeout (Go durations such as "2h" or "15m") stop
+	// the session after a wall-clock limit or a period without terminal
+	// input or output.
+	MaxDuration string `yaml:"max-duration"`
+	IdleTimeout string `yaml:"idle-timeout"`
+}
+
+// ResolvedLimits holds limits in Docker units. Zero means unlimited.
+type ResolvedLimits struct {
+	NanoCPUs   int64
+	Memory     int64
+	MemorySwap int64
+	Pids       int64
+	Tmpfs      int64
+	Storage    int64
+
+	MaxDuration time.Duration
+	IdleTimeout time.Duration
+}
+
+// Resolve parses l into Docker units.
+func (l Limits) Resolve() (ResolvedLimits, error) {
+	var out ResolvedLimits
+	if l.CPUs < 0 || math.IsNaN(l.CPUs) || math.IsInf(l.CPUs, 0) {
+		return out, fmt.Errorf("cpus must be positive (got %v)", l.CPUs)
+	}
+	out.NanoCPUs = int64(l.CPUs * 1e9)
+	if l.Pids < 0 {
+		return out, fmt.Errorf("pids must be positive (got %d)", l.Pids)
+	}
+	out.Pids = l.Pids
+	sizes := []struct {
+		name  string
+		value string
+		dst   *int64
+	}{
+		{"memory", l.Memory, &out.Memory},
+		{"memory-swap", l.MemorySwap, &out.MemorySwap},
+		{"tmpfs", l.Tmpfs, &out.Tmpfs},
+		{"storage", l.Storage, &out.Storage},
+	}
+	for _, s := range sizes {
+		if strings.TrimSpace(s.value) == "" {
+			continue
+		}
+		n, err := units.RAMInBytes(strings.TrimSpace(s.value))
+		if err != nil || n <= 0 {
+			return out, fmt.Errorf("%s has invalid size %q", s.name, s.value)
+		}
+		*s.dst = n
+	}
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"max-duration", l.MaxDuration, &out.MaxDuration},
+		{"idle-timeout", l.IdleTimeout, &out.IdleTimeout},
+	}
+	for _, d := range durations {
+		if strings.TrimSpace(d.value) == "" {
+			continue
+		}
+		v, err := time.ParseDuration(strings.TrimSpace(d.value))
+		if err != nil || v <= 0 {
+			return out, fmt.Errorf("%s has invalid duration %q", d.name, d.value)
+		}
+		*d.dst = v
+	}
+	return out, nil
+}
+
+// Merge combines two sets of limits, keeping the most restrictive value for
+// each field.
+func (l ResolvedLimits) Merge(other ResolvedLimits) ResolvedLimits {
+	out := ResolvedLimits{
+		NanoCPUs:   minLimit(l.NanoCPUs, other.NanoCPUs),
+		Memory:     minLimit(l.Memory, other.Memory),
+		MemorySwap: minLimit(l.MemorySwap, other.MemorySwap),
+		Pids:       minLimit(l.Pids, other.Pids),
+		Tmpfs:      minLimit(l.Tmpfs, other.Tmpfs),
+		Storage:    minLimit(l.Storage, other.Storage),
+
+		MaxDuration: time.Duration(minLimit(int64(l.MaxDuration), int64(other.MaxDuration))),
+		IdleTimeout: time.Duration(minLimit(int64(l.IdleTimeout), int64(other.IdleTimeout))),
+	}
+	// memory-swap is the combined memory+swap ceiling, so it also bounds memory.
+	if out.MemorySwap > 0 && (out.Memory == 0 || out.Memory > out.MemorySwap) {
+		out.Memory = out.MemorySwap
+	}
+	return out
+}
+
+// IsZero reports whether no limit is set.
+func (l ResolvedLimits) IsZero() bool {
+	return l == ResolvedLimits{}
+}
+
+func minLimit(a, b int64) int64 {
+	switch {
+	case a == 0:
+		return b
+	case b == 0:
+		return a
+	case a < b:
+		return a
+	default:
+		return b
+	}
+}
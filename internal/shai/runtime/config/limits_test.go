@@ -0,0 +1,84 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitsResolve(t *testing.T) {
+	l, err := Limits{CPUs: 1.5, Memory: "512m", Pids: 256, Tmpfs: "64m", Storage: "10g"}.Resolve()
+	require.NoError(t, err)
+	require.Equal(t, ResolvedLimits{
+		NanoCPUs: 1_500_000_000,
+		Memory:   512 << 20,
+		Pids:     256,
+		Tmpfs:    64 << 20,
+		Storage:  10 << 30,
+	}, l)
+
+	l, err = Limits{MaxDuration: "2h", IdleTimeout: "15m"}.Resolve()
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Hour, l.MaxDuration)
+	require.Equal(t, 15*time.Minute, l.IdleTimeout)
+	_, err = Limits{IdleTimeout: "soon"}.Resolve()
+	require.ErrorContains(t, err, `idle-timeout has invalid duration "soon"`)
+
+	_, err = Limits{Memory: "lots"}.Resolve()
+	require.ErrorContains(t, err, `memory has invalid size "lots"`)
+	_, err = Limits{CPUs: -1}.Resolve()
+	require.ErrorContains(t, err, "cpus must be positive")
+}
+
+func TestResolvedLimitsMergeMostRestrictive(t *testing.T) {
+	a := ResolvedLimits{NanoCPUs: 4e9, Memory: 8 << 30, Pids: 1024, MaxDuration: time.Hour}
+	b := ResolvedLimits{NanoCPUs: 2e9, Memory: 16 << 30, MemorySwap: 4 << 30, MaxDuration: 2 * time.Hour, IdleTimeout: time.Minute}
+	require.Equal(t, ResolvedLimits{
+		NanoCPUs:    2e9,
+		Memory:      4 << 30,
+		MemorySwap:  4 << 30,
+		Pids:        1024,
+		MaxDuration: time.Hour,
+		IdleTimeout: time.Minute,
+	}, a.Merge(b))
+	require.True(t, ResolvedLimits{}.Merge(ResolvedLimits{}).IsZero())
+}
+
+func TestLoadConfigLimits(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+limits:
+  memory: 4g
+resources:
+  build:
+    limits:
+      cpus: 2
+      memory: 2gb
+apply:
+  - path: ./
+    resources: [build]
+`)
+	cfg, err := Load(path, map[string]string{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "4g", cfg.Limits.Memory)
+	require.Equal(t, 2.0, cfg.Resources["build"].Limits.CPUs)
+
+	path = writeConfig(t, dir, `
+type: shai-sandbox
+version: 1
+image: example
+resources:
+  build:
+    limits:
+      pids: -5
+apply:
+  - path: ./
+    resources: [build]
+`)
+	_, err = Load(path, map[string]string{}, nil)
+	require.ErrorContains(t, err, "resource build limits: pids must be positive")
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Overlay is the user's own config, layered over every workspace config it
+// is loaded with. It holds personal settings, such as mounts for agent
+// credentials, that do not belong in a shared repository config.
+type Overlay struct {
+	Image     string                  `yaml:"image"`
+	User      string                  `yaml:"user"`
+	Mask      []string                `yaml:"mask"`
+	Resources map[string]*ResourceSet `yaml:"resources"`
+	Apply     []ApplyRule             `yaml:"apply"`
+}
+
+// overlayPath returns the user overlay file, ~/.config/shai/config.yaml, or
+// "" without a home directory. It is a variable so tests can point it
+// elsewhere.
+var overlayPath = func() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "shai", "config.yaml")
+}
+
+// lockable lists the fields a config's locked list may name, besides
+// resources.<name> for a single resource set.
+var lockable = []string{"image", "user", "mask", "resources", "apply"}
+
+// Overlay returns the user overlay file merged into c, or "" if none was.
+func (c *Config) Overlay() string {
+	return c.overlayPath
+}
+
+// OverlayIgnored lists the locked fields the user overlay set and that were
+// left as the config has them.
+func (c *Config) OverlayIgnored() []string {
+	return c.overlayIgnored
+}
+
+// Origin returns the files that set field: "image", "user" or
+// "resources.<name>". A resource set the overlay merged into lists both
+// files. It is empty for values that are defaults.
+func (c *Config) Origin(field string) []string {
+	return c.origins[field]
+}
+
+// Origin returns the file the apply rule came from.
+func (r ApplyRule) Origin() string {
+	return r.origin
+}
+
+// recordOrigins notes c's own file as the origin of the values it sets.
+func (c *Config) recordOrigins() {
+	c.origins = map[string][]string{}
+	if strings.TrimSpace(c.Image) != "" {
+		c.origins["image"] = []string{c.sourcePath}
+	}
+	if strings.TrimSpace(c.User) != "" {
+		c.origins["user"] = []string{c.sourcePath}
+	}
+	for name := range c.Resources {
+		c.origins["resources."+name] = []string{c.sourcePath}
+	}
+	for i := range c.Apply {
+		c.Apply[i].origin = c.sourcePath
+	}
+}
+
+// applyOverlay merges the user overlay into c. The overlay's image and user
+// replace c's; its mask patterns and apply rules follow c's; its resource
+// sets are added, or merged over c's set of the same name as with extends.
+// Fields c locks keep c's values and are recorded in c.overlayIgnored.
+func (c *Config) applyOverlay() error {
+	file := overlayPath()
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read shai user config: %w", err)
+	}
+	var ov Overlay
+	if err := yaml.Unmarshal(data, &ov); err != nil {
+		return fmt.Errorf("parse shai user config %s: %w", file, err)
+	}
+	if err := checkKnownFields(data, file, reflect.TypeOf(ov)); err != nil {
+		return err
+	}
+	c.overlayPath = file
+
+	if strings.TrimSpace(ov.Image) != "" {
+		if c.locked("image") {
+			c.ignoreOverlay("image")
+		} else {
+			c.Image = ov.Image
+			c.origins["image"] = []string{file}
+		}
+	}
+	if strings.TrimSpace(ov.User) != "" {
+		if c.locked("user") {
+			c.ignoreOverlay("user")
+		} else {
+			c.User = ov.User
+			c.origins["user"] = []string{file}
+		}
+	}
+	if len(ov.Mask) > 0 {
+		if c.locked("mask") {
+			c.ignoreOverlay("mask")
+		} else {
+			c.Mask = append(c.Mask, ov.Mask...)
+		}
+	}
+	for _, name := range sortedResourceNames(ov.Resources) {
+		field := "resources." + name
+		res := ov.Resources[name]
+		if res == nil {
+			res = &ResourceSet{}
+		}
+		existing, ok := c.Resources[name]
+		switch {
+		case !ok:
+			if c.Resources == nil {
+				c.Resources = map[string]*ResourceSet{}
+			}
+			c.Resources[name] = res
+			c.origins[field] = []string{file}
+		case c.locked("resources") || c.locked(field):
+			c.ignoreOverlay(field)
+		default:
+			merged := mergeResourceSets(existing, res)
+			merged.Extends = mergeKeyed(existing.Extends, res.Extends, func(s string) string { return strings.TrimSpace(s) })
+			c.Resources[name] = merged
+			c.origins[field] = append(slices.Clone(c.origins[field]), file)
+		}
+	}
+	if len(ov.Apply) > 0 {
+		if c.locked("apply") {
+			c.ignoreOverlay("apply")
+		} else {
+			for _, rule := range ov.Apply {
+				if strings.TrimSpace(rule.Image) != "" && c.locked("image") {
+					c.ignoreOverlay("image")
+					rule.Image = ""
+				}
+				rule.origin = file
+				c.Apply = append(c.Apply, rule)
+			}
+		}
+	}
+	return nil
+}
+
+// overlayOnly reports whether the resource set name comes from the user
+// overlay alone, so the workspace config cannot rely on it.
+func (c *Config) overlayOnly(name string) bool {
+	origins := c.origins["resources."+name]
+	return c.overlayPath != "" && len(origins) == 1 && origins[0] == c.overlayPath
+}
+
+func (c *Config) locked(field string) bool {
+	for _, l := range c.Locked {
+		if strings.TrimSpace(l) == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) ignoreOverlay(field string) {
+	if !slices.Contains(c.overlayIgnored, field) {
+		c.overlayIgnored = append(c.overlayIgnored, field)
+	}
+}
+
+// validateLocked checks that every locked entry names a lockable field or
+// one of c's resource sets.
+func (c *Config) validateLocked() error {
+	for i, l := range c.Locked {
+		l = strings.TrimSpace(l)
+		if slices.Contains(lockable, l) {
+			continue
+		}
+		if name, ok := strings.CutPrefix(l, "resources."); ok {
+			if _, exists := c.Resources[name]; exists {
+				continue
+			}
+			return fmt.Errorf("locked[%d] names unknown resource set %q", i, name)
+		}
+		return fmt.Errorf("locked[%d] %q must be one of %s or resources.<name>", i, l, strings.Join(lockable, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadWithOverlay loads path with the user config merged in.
+func loadWithOverlay(path string) (*Config, error) {
+	cfg, _, err := LoadOrDefault(path, nil, nil, LoadOptions{UserConfig: true})
+	return cfg, err
+}
+
+func useOverlay(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	orig := overlayPath
+	overlayPath = func() string { return path }
+	t.Cleanup(func() { overlayPath = orig })
+	return path
+}
+
+const overlayTestConfig = `
+type: shai-sandbox
+version: 1
+image: example/image:1
+resources:
+  web:
+    http: [github.com]
+apply:
+  - path: ./
+    resources: [web]
+`
+
+const overlayTestUserConfig = `
+image: example/personal:1
+resources:
+  web:
+    http: [npmjs.org]
+  agents:
+    mounts:
+      - source: ~/.claude
+        target: /home/shai/.claude
+        mode: rw
+apply:
+  - path: ./
+    resources: [agents]
+`
+
+func TestLoadMergesUserOverlay(t *testing.T) {
+	overlay := useOverlay(t, overlayTestUserConfig)
+	path := writeConfig(t, t.TempDir(), overlayTestConfig)
+
+	cfg, err := loadWithOverlay(path)
+	require.NoError(t, err)
+	assert.Equal(t, overlay, cfg.Overlay())
+	assert.Empty(t, cfg.OverlayIgnored())
+
+	assert.Equal(t, "example/personal:1", cfg.Image)
+	assert.Equal(t, []string{overlay}, cfg.Origin("image"))
+	assert.Equal(t, []string{"github.com", "npmjs.org"}, cfg.Resources["web"].HTTP)
+	assert.Equal(t, []string{path, overlay}, cfg.Origin("resources.web"))
+	assert.Equal(t, []string{overlay}, cfg.Origin("resources.agents"))
+	assert.Empty(t, cfg.Origin("user"))
+
+	rules := cfg.ApplyRulesForPath(".")
+	require.Len(t, rules, 2)
+	assert.Equal(t, path, rules[0].Origin())
+	assert.Equal(t, overlay, rules[1].Origin())
+	var names []string
+	for _, res := range cfg.ResolveResources(nil) {
+		names = append(names, res.Name)
+	}
+	assert.Equal(t, []string{"web", "agents"}, names)
+}
+
+func TestLoadKeepsLockedFieldsFromOverlay(t *testing.T) {
+	useOverlay(t, overlayTestUserConfig)
+	path := writeConfig(t, t.TempDir(), overlayTestConfig+"locked: [image, resources.web]\n")
+
+	cfg, err := loadWithOverlay(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"image", "resources.web"}, cfg.OverlayIgnored())
+	assert.Equal(t, "example/image:1", cfg.Image)
+	assert.Equal(t, []string{"github.com"}, cfg.Resources["web"].HTTP)
+	assert.Contains(t, cfg.Resources, "agents")
+
+	path = writeConfig(t, t.TempDir(), overlayTestConfig+"locked: [resources.api]\n")
+	_, err = loadWithOverlay(path)
+	require.ErrorContains(t, err, `locked[0] names unknown resource set "api"`)
+}
+
+func TestLoadUserOverlayErrorsNameTheFile(t *testing.T) {
+	overlay := useOverlay(t, "resources:\n  web:\n    mounts:\n      - target: relative\n")
+	path := writeConfig(t, t.TempDir(), overlayTestConfig)
+
+	_, err := loadWithOverlay(path)
+	require.ErrorContains(t, err, path+", "+overlay+": resource web mount[0] target")
+
+	useOverlay(t, "resource: {}\n")
+	_, err = loadWithOverlay(path)
+	require.ErrorContains(t, err, `unknown field "resource" (did you mean "resources"?)`)
+}
+
+func TestLoadIgnoresUserOverlayUnlessAsked(t *testing.T) {
+	useOverlay(t, overlayTestUserConfig)
+	path := writeConfig(t, t.TempDir(), overlayTestConfig)
+
+	cfg, err := Load(path, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Overlay())
+	assert.Equal(t, "example/image:1", cfg.Image)
+	assert.NotContains(t, cfg.Resources, "agents")
+}
+
+func TestLoadRejectsWorkspaceRulesForUserOnlySets(t *testing.T) {
+	overlay := useOverlay(t, "resources:\n  agents:\n    http: [api.anthropic.com]\n")
+	path := writeConfig(t, t.TempDir(), overlayTestConfig+`  - path: ./
+    resources: [agents]
+`)
+
+	_, err := loadWithOverlay(path)
+	require.ErrorContains(t, err, `apply path "./" references resource "agents", which only the user config `+overlay+" defines")
+
+	_, err = Load(path, nil, nil)
+	require.ErrorContains(t, err, `references unknown resource "agents"`)
+}
@@ -0,0 +1,364 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SystemPolicyPath is the machine-wide policy file.
+const SystemPolicyPath = "/etc/shai/policy.yaml"
+
+// Policy caps what a workspace config may request. It is owned by the host
+// or organization, never by the repository, and is enforced on every load.
+// Empty lists impose no restriction.
+type Policy struct {
+	// ForbidPrivileged rejects resource sets that set options.privileged.
+	ForbidPrivileged bool `yaml:"forbid-privileged"`
+	// MountPrefixes lists host path prefixes that mount sources and vars
+	// files must live under. Relative paths that stay inside the workspace
+	// are allowed. Paths are compared after resolving symlinks, and a path
+	// that cannot be resolved is rejected.
+	MountPrefixes []string `yaml:"mount-prefixes"`
+	// ImageRegistries lists registries (optionally with a repository path
+	// prefix) that images must come from, e.g. ghcr.io/colony-2.
+	ImageRegistries []string `yaml:"image-registries"`
+	// DeniedHosts lists hosts, including their subdomains, that may not
+	// appear in http or ports entries.
+	DeniedHosts []string `yaml:"denied-hosts"`
+	// ForbidCalls rejects every host command: calls, vars commands, git
+	// credential commands and keychain lookups.
+	ForbidCalls bool `yaml:"forbid-calls"`
+	// AllowedCalls lists the host commands that calls, vars and git
+	// credentials may run, as path.Match patterns over the whole command
+	// string.
+	AllowedCalls []string `yaml:"allowed-calls"`
+	// ForbidKeychain rejects vars read from the host keychain.
+	ForbidKeychain bool `yaml:"forbid-keychain"`
+	// ForbidHostPorts rejects host-ports, and AllowedHostPorts lists the
+	// host loopback ports they may forward.
+	ForbidHostPorts  bool  `yaml:"forbid-host-ports"`
+	AllowedHostPorts []int `yaml:"allowed-host-ports"`
+	// ForbidSSHAgent rejects forwarding the host ssh-agent.
+	ForbidSSHAgent bool `yaml:"forbid-ssh-agent"`
+
+	path string
+}
+
+// policyPaths returns the policy files enforced by Load, in order. It is a
+// variable so tests can point it elsewhere.
+var policyPaths = func() []string {
+	paths := []string{SystemPolicyPath}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "shai", "policy.yaml"))
+	}
+	return paths
+}
+
+// LoadPolicy parses a policy file. Unknown keys are rejected so a typo cannot
+// silently weaken a policy.
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read shai policy: %w", err)
+	}
+	var p Policy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse shai policy %s: %w", file, err)
+	}
+	for i, pattern := range p.AllowedCalls {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("shai policy %s allowed-calls[%d] invalid pattern %q: %w", file, i, pattern, err)
+		}
+	}
+	p.path = file
+	return &p, nil
+}
+
+// loadPolicies loads every existing policy file. A missing file is fine; an
+// unreadable or malformed one fails closed.
+func loadPolicies() ([]*Policy, error) {
+	var policies []*Policy
+	for _, p := range policyPaths() {
+		if _, err := os.Stat(p); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("stat shai policy: %w", err)
+		}
+		policy, err := LoadPolicy(p)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// Check returns an error naming the first field of cfg that violates p.
+// Relative host paths in cfg resolve against workingDir.
+func (p *Policy) Check(cfg *Config, env map[string]string, workingDir string) error {
+	if err := p.checkImage("image", cfg.Image); err != nil {
+		return err
+	}
+	for i, rule := range cfg.Apply {
+		if strings.TrimSpace(rule.Image) == "" {
+			continue
+		}
+		if err := p.checkImage(fmt.Sprintf("apply[%d].image", i), rule.Image); err != nil {
+			return err
+		}
+	}
+	prefixes := p.mountPrefixes(env)
+	for _, name := range sortedResourceNames(cfg.Resources) {
+		res := cfg.Resources[name]
+		if p.ForbidPrivileged && res.Options.Privileged {
+			return p.violation("resource %s options.privileged is forbidden", name)
+		}
+		for i, m := range res.Mounts {
+			if len(prefixes) == 0 {
+				break
+			}
+			if err := mountAllowed(m.Source, workingDir, prefixes); err != nil {
+				return p.violation("resource %s mounts[%d].source %q %v", name, i, m.Source, err)
+			}
+		}
+		for i, host := range res.HTTP {
+			if denied := p.deniedHost(host); denied != "" {
+				return p.violation("resource %s http[%d] %q is a denied host (%s)", name, i, host, denied)
+			}
+		}
+		for i, port := range res.Ports {
+			if denied := p.deniedHost(port.Host); denied != "" {
+				return p.violation("resource %s ports[%d].host %q is a denied host (%s)", name, i, port.Host, denied)
+			}
+		}
+		for i, call := range res.Calls {
+			if err := p.checkCommand(fmt.Sprintf("resource %s calls[%d]", name, i), call.Command); err != nil {
+				return err
+			}
+		}
+		for i, vm := range res.Vars {
+			field := fmt.Sprintf("resource %s vars[%d]", name, i)
+			switch {
+			case strings.TrimSpace(vm.Command) != "":
+				if err := p.checkCommand(field, vm.Command); err != nil {
+					return err
+				}
+			case strings.TrimSpace(vm.Keychain) != "":
+				if p.ForbidCalls || p.ForbidKeychain {
+					return p.violation("%s.keychain %q is forbidden", field, vm.Keychain)
+				}
+			case strings.TrimSpace(vm.File) != "":
+				if len(prefixes) == 0 {
+					break
+				}
+				if err := mountAllowed(expandPolicyHome(strings.TrimSpace(vm.File), env), workingDir, prefixes); err != nil {
+					return p.violation("%s.file %q %v", field, vm.File, err)
+				}
+			}
+		}
+		for i, g := range res.Git {
+			if err := p.checkCommand(fmt.Sprintf("resource %s git[%d]", name, i), g.Command); err != nil {
+				return err
+			}
+		}
+		for i, hp := range res.HostPorts {
+			if p.ForbidHostPorts {
+				return p.violation("resource %s host-ports[%d] is forbidden", name, i)
+			}
+			if len(p.AllowedHostPorts) > 0 && !slices.Contains(p.AllowedHostPorts, hp.Port) {
+				return p.violation("resource %s host-ports[%d].port %d is not in allowed-host-ports", name, i, hp.Port)
+			}
+		}
+		if res.SSHAgent != nil && p.ForbidSSHAgent {
+			return p.violation("resource %s ssh-agent is forbidden", name)
+		}
+	}
+	return nil
+}
+
+// checkCommand applies forbid-calls and allowed-calls to a host command run
+// by field.
+func (p *Policy) checkCommand(field, command string) error {
+	if p.ForbidCalls {
+		return p.violation("%s.command %q is forbidden", field, command)
+	}
+	if len(p.AllowedCalls) > 0 && !callAllowed(command, p.AllowedCalls) {
+		return p.violation("%s.command %q is not in allowed-calls", field, command)
+	}
+	return nil
+}
+
+func (p *Policy) violation(format string, args ...any) error {
+	return fmt.Errorf("shai policy %s: %s", p.path, fmt.Sprintf(format, args...))
+}
+
+func (p *Policy) checkImage(field, image string) error {
+	if len(p.ImageRegistries) == 0 {
+		return nil
+	}
+	repo := imageRepository(normalizeImageRef(image))
+	for _, allowed := range p.ImageRegistries {
+		allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/")
+		if allowed == "" {
+			continue
+		}
+		if strings.Contains(allowed, "/") || !isRegistryHost(allowed) {
+			allowed = normalizeImageRef(allowed)
+		}
+		if repo == allowed || strings.HasPrefix(repo, allowed+"/") {
+			return nil
+		}
+	}
+	return p.violation("%s %q is not from an allowed registry", field, image)
+}
+
+func (p *Policy) mountPrefixes(env map[string]string) []string {
+	var out []string
+	for _, prefix := range p.MountPrefixes {
+		prefix = expandPolicyHome(strings.TrimSpace(prefix), env)
+		if prefix == "" || strings.HasPrefix(prefix, "~") {
+			continue
+		}
+		// Sources are compared after resolving symlinks, so prefixes must
+		// be too; a prefix that does not exist cannot contain anything.
+		if resolved, err := filepath.EvalSymlinks(prefix); err == nil {
+			prefix = resolved
+		}
+		out = append(out, filepath.Clean(prefix))
+	}
+	return out
+}
+
+// expandPolicyHome expands a leading "~" to the home directory, leaving the
+// path unchanged when it is unknown.
+func expandPolicyHome(path string, env map[string]string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home := env["HOME"]
+	if home == "" {
+		home, _ = os.UserHomeDir()
+	}
+	if home == "" {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+func (p *Policy) deniedHost(host string) string {
+	host = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(host), "*."))
+	for _, denied := range p.DeniedHosts {
+		d := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(denied), "*."))
+		if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+			return denied
+		}
+	}
+	return ""
+}
+
+// mountAllowed reports why the host path source may not be exposed, or nil
+// when it resolves inside workingDir (for relative sources) or one of the
+// resolved prefixes. Symlinks are followed first, so a link committed to the
+// workspace or placed under a prefix cannot point elsewhere; a source that
+// cannot be resolved is refused.
+func mountAllowed(source, workingDir string, prefixes []string) error {
+	relative := !filepath.IsAbs(source)
+	if relative {
+		if workingDir == "" {
+			return errors.New("cannot be resolved without a working directory")
+		}
+		source = filepath.Join(workingDir, source)
+	}
+	resolved, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return fmt.Errorf("cannot be resolved: %w", err)
+	}
+	roots := prefixes
+	if relative {
+		root, err := filepath.EvalSymlinks(workingDir)
+		if err != nil {
+			return fmt.Errorf("cannot be resolved: %w", err)
+		}
+		roots = append([]string{root}, prefixes...)
+	}
+	for _, root := range roots {
+		if pathWithin(resolved, root) {
+			return nil
+		}
+	}
+	if relative {
+		return fmt.Errorf("resolves to %s, outside the workspace and the allowed mount prefixes", resolved)
+	}
+	if resolved != filepath.Clean(source) {
+		return fmt.Errorf("resolves to %s, outside the allowed mount prefixes", resolved)
+	}
+	return errors.New("is outside the allowed mount prefixes")
+}
+
+func pathWithin(path, root string) bool {
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func sortedResourceNames(resources map[string]*ResourceSet) []string {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func callAllowed(command string, patterns []string) bool {
+	command = strings.TrimSpace(command)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, command); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeImageRef expands Docker Hub shorthands so registry prefixes can be
+// compared: "ubuntu" becomes "docker.io/library/ubuntu".
+func normalizeImageRef(image string) string {
+	ref := strings.TrimSpace(image)
+	first, _, hasSlash := strings.Cut(ref, "/")
+	if !hasSlash {
+		return "docker.io/library/" + ref
+	}
+	if !isRegistryHost(first) {
+		return "docker.io/" + ref
+	}
+	return ref
+}
+
+// isRegistryHost reports whether the first component of a reference names
+// a registry rather than a Docker Hub namespace.
+func isRegistryHost(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
+
+// imageRepository drops the digest and tag from a reference, leaving the
+// repository: "docker.io/library/ubuntu:22.04" becomes
+// "docker.io/library/ubuntu". A registry port is kept.
+func imageRepository(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
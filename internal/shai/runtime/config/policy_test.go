@@ -0,0 +1,297 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func usePolicy(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	orig := policyPaths
+	policyPaths = func() []string { return []string{path, filepath.Join(t.TempDir(), "missing.yaml")} }
+	t.Cleanup(func() { policyPaths = orig })
+	return path
+}
+
+const policyTestConfig = `
+type: shai-sandbox
+version: 1
+image: ghcr.io/colony-2/shai-base
+resources:
+  build:
+    mounts:
+      - source: ${{ env.HOME }}/.cache/go
+        target: /home/shai/.cache/go
+      - source: ./tools
+        target: /opt/tools
+    http:
+      - proxy.golang.org
+    calls:
+      - name: deploy
+        command: ops/deploy.sh
+apply:
+  - path: ./
+    resources: [build]
+`
+
+func TestPolicyAllowsCompliantConfig(t *testing.T) {
+	usePolicy(t, `
+forbid-privileged: true
+mount-prefixes: ["~/.cache"]
+image-registries: [ghcr.io/colony-2]
+denied-hosts: [pastebin.com]
+allowed-calls: ["ops/*"]
+`)
+	home := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".cache", "go"), 0o755))
+	workspace := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(workspace, "tools"), 0o755))
+	path := writeConfig(t, workspace, policyTestConfig)
+	_, err := Load(path, map[string]string{"HOME": home}, nil)
+	require.NoError(t, err)
+}
+
+const policyHostAccessConfig = `
+type: shai-sandbox
+version: 1
+image: ghcr.io/colony-2/shai-base
+resources:
+  build:
+    vars:
+      - command: op read op://dev/npm
+        target: NPM_TOKEN
+      - keychain: github-token
+        target: GH_TOKEN
+      - file: ~/.aws/credentials
+        target: AWS_CREDENTIALS
+    git:
+      - remote: https://github.com/acme/*
+        command: gh auth token
+    host-ports:
+      - port: 5432
+      - port: 6379
+    ssh-agent:
+      keys: [SHA256:Qk0yH3pVbW1XfXk2c0xZ2jJtQ1pZbnVwV3d4eE5xT0E]
+apply:
+  - path: ./
+    resources: [build]
+`
+
+func TestPolicyViolationsNameResourceAndField(t *testing.T) {
+	env := map[string]string{"HOME": "/home/dev"}
+	cases := []struct {
+		name   string
+		policy string
+		config string
+		want   string
+	}{
+		{
+			name:   "privileged",
+			policy: "forbid-privileged: true\n",
+			config: `
+type: shai-sandbox
+version: 1
+image: ghcr.io/colony-2/shai-base
+resources:
+  build:
+    options:
+      privileged: true
+apply:
+  - path: ./
+    resources: [build]
+`,
+			want: "resource build options.privileged is forbidden",
+		},
+		{
+			name:   "mount prefix",
+			policy: "mount-prefixes: [/opt]\n",
+			config: policyTestConfig,
+			want:   `resource build mounts[0].source "/home/dev/.cache/go" cannot be resolved`,
+		},
+		{
+			name:   "image registry",
+			policy: "image-registries: [docker.io/library]\n",
+			config: policyTestConfig,
+			want:   `image "ghcr.io/colony-2/shai-base" is not from an allowed registry`,
+		},
+		{
+			name:   "denied host",
+			policy: "denied-hosts: [golang.org]\n",
+			config: policyTestConfig,
+			want:   `resource build http[0] "proxy.golang.org" is a denied host (golang.org)`,
+		},
+		{
+			name:   "forbid calls",
+			policy: "forbid-calls: true\n",
+			config: policyTestConfig,
+			want:   `resource build calls[0].command "ops/deploy.sh" is forbidden`,
+		},
+		{
+			name:   "allowed calls",
+			policy: "allowed-calls: [make]\n",
+			config: policyTestConfig,
+			want:   `resource build calls[0].command "ops/deploy.sh" is not in allowed-calls`,
+		},
+		{
+			name:   "vars command",
+			policy: "allowed-calls: [\"ops/*\"]\n",
+			config: policyHostAccessConfig,
+			want:   `resource build vars[0].command "op read op://dev/npm" is not in allowed-calls`,
+		},
+		{
+			name:   "keychain",
+			policy: "forbid-keychain: true\n",
+			config: policyHostAccessConfig,
+			want:   `resource build vars[1].keychain "github-token" is forbidden`,
+		},
+		{
+			name:   "keychain under forbid-calls",
+			policy: "forbid-calls: true\n",
+			config: strings.Replace(policyHostAccessConfig, "      - command: op read op://dev/npm\n        target: NPM_TOKEN\n", "", 1),
+			want:   `resource build vars[0].keychain "github-token" is forbidden`,
+		},
+		{
+			name:   "vars file",
+			policy: "mount-prefixes: [\"~/.cache\"]\n",
+			config: policyHostAccessConfig,
+			want:   `resource build vars[2].file "~/.aws/credentials" cannot be resolved`,
+		},
+		{
+			name:   "git command",
+			policy: "allowed-calls: [\"op read op://dev/npm\"]\n",
+			config: policyHostAccessConfig,
+			want:   `resource build git[0].command "gh auth token" is not in allowed-calls`,
+		},
+		{
+			name:   "forbid host ports",
+			policy: "forbid-host-ports: true\n",
+			config: policyHostAccessConfig,
+			want:   "resource build host-ports[0] is forbidden",
+		},
+		{
+			name:   "allowed host ports",
+			policy: "allowed-host-ports: [5432]\n",
+			config: policyHostAccessConfig,
+			want:   "resource build host-ports[1].port 6379 is not in allowed-host-ports",
+		},
+		{
+			name:   "ssh agent",
+			policy: "forbid-ssh-agent: true\n",
+			config: policyHostAccessConfig,
+			want:   "resource build ssh-agent is forbidden",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policyPath := usePolicy(t, tc.policy)
+			path := writeConfig(t, t.TempDir(), tc.config)
+			_, err := Load(path, env, nil)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), policyPath)
+			require.Contains(t, err.Error(), tc.want)
+		})
+	}
+}
+
+func TestMountAllowed(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "workspace")
+	opt := filepath.Join(root, "opt")
+	for _, dir := range []string{workspace + "/tools", root + "/secrets", opt + "/sdk", root + "/optional"} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	prefixes := []string{opt}
+
+	require.NoError(t, mountAllowed("./tools", workspace, prefixes))
+	require.Error(t, mountAllowed("../secrets", workspace, prefixes))
+	require.NoError(t, mountAllowed(opt+"/sdk", workspace, prefixes))
+	require.Error(t, mountAllowed(root+"/optional", workspace, prefixes))
+	require.ErrorContains(t, mountAllowed(opt+"/missing", workspace, prefixes), "cannot be resolved")
+}
+
+func TestMountAllowedFollowsSymlinks(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "workspace")
+	opt := filepath.Join(root, "opt")
+	aws := filepath.Join(root, "home", ".aws")
+	for _, dir := range []string{workspace, opt + "/sdk", aws} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(aws, "credentials"), []byte("secret"), 0o600))
+	// A committed link out of the workspace, and one planted under a prefix.
+	require.NoError(t, os.Symlink(aws, filepath.Join(workspace, "creds")))
+	require.NoError(t, os.Symlink(aws, filepath.Join(opt, "creds")))
+	require.NoError(t, os.Symlink(filepath.Join(opt, "sdk"), filepath.Join(workspace, "sdk")))
+	prefixes := []string{opt}
+
+	require.ErrorContains(t, mountAllowed("creds", workspace, prefixes), "resolves to "+aws)
+	require.ErrorContains(t, mountAllowed("creds/credentials", workspace, prefixes), "outside the workspace")
+	require.ErrorContains(t, mountAllowed(opt+"/creds", workspace, prefixes), "outside the allowed mount prefixes")
+	require.NoError(t, mountAllowed("sdk", workspace, prefixes), "links to an allowed prefix are fine")
+
+	// The prefix itself may be reached through a symlink.
+	linkedOpt := filepath.Join(root, "opt-link")
+	require.NoError(t, os.Symlink(opt, linkedOpt))
+	p := &Policy{MountPrefixes: []string{linkedOpt}}
+	require.NoError(t, mountAllowed(opt+"/sdk", workspace, p.mountPrefixes(nil)))
+}
+
+func TestPolicyRejectsSymlinkEscapes(t *testing.T) {
+	home := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".cache"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".aws"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".aws", "credentials"), []byte("secret"), 0o600))
+	usePolicy(t, "mount-prefixes: [\"~/.cache\"]\n")
+	env := map[string]string{"HOME": home}
+
+	for name, resource := range map[string]string{
+		"mount": "    mounts:\n      - source: creds\n        target: /home/shai/.aws\n",
+		"file":  "    vars:\n      - file: creds/credentials\n        target: AWS_CREDENTIALS\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			workspace := t.TempDir()
+			require.NoError(t, os.Symlink(filepath.Join(home, ".aws"), filepath.Join(workspace, "creds")))
+			path := writeConfig(t, workspace, "type: shai-sandbox\nversion: 1\nimage: ghcr.io/colony-2/shai-base\nresources:\n  build:\n"+resource+"apply:\n  - path: ./\n    resources: [build]\n")
+			_, err := Load(path, env, nil)
+			require.ErrorContains(t, err, "outside the workspace and the allowed mount prefixes")
+		})
+	}
+}
+
+func TestPolicyImageRegistriesIgnoreTagsAndDigests(t *testing.T) {
+	p := &Policy{ImageRegistries: []string{"docker.io/library/ubuntu", "ghcr.io", "localhost:5000/team"}}
+	for _, image := range []string{
+		"ubuntu",
+		"ubuntu:22.04",
+		"docker.io/library/ubuntu:22.04",
+		"ubuntu@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+		"ghcr.io/colony-2/shai-base:latest",
+		"localhost:5000/team/tool:1",
+	} {
+		require.NoError(t, p.checkImage("image", image), image)
+	}
+	for _, image := range []string{"ubuntu-evil:22.04", "docker.io/library/debian", "localhost:5000/other:1"} {
+		require.Error(t, p.checkImage("image", image), image)
+	}
+}
+
+func TestNormalizeImageRef(t *testing.T) {
+	require.Equal(t, "docker.io/library/ubuntu:24.04", normalizeImageRef("ubuntu:24.04"))
+	require.Equal(t, "docker.io/acme/tool", normalizeImageRef("acme/tool"))
+	require.Equal(t, "ghcr.io/acme/tool", normalizeImageRef("ghcr.io/acme/tool"))
+	require.Equal(t, "localhost:5000/tool", normalizeImageRef("localhost:5000/tool"))
+}
+
+func TestLoadPolicyRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("forbid-privilege: true\n"), 0o644))
+	_, err := LoadPolicy(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "forbid-privilege")
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// SchemaID is where the published JSON Schema for .shai/config.yaml lives.
+const SchemaID = "https://raw.githubusercontent.com/colony-2/shai/main/docs/shai-config.schema.json"
+
+// schemaRequired lists the keys each type must set, by Go type name.
+var schemaRequired = map[string][]string{
+	"Config":        {"type", "version", "image", "resources", "apply"},
+	"Mount":         {"target"},
+	"Call":          {"name", "command"},
+	"HostPort":      {"port"},
+	"PublishedPort": {"port"},
+	"SSHAgent":      {"keys"},
+	"GitCredential": {"remote", "command"},
+	"ApplyRule":     {"resources"},
+}
+
+// schemaFields adds constraints and descriptions to single keys, by
+// "<Go type name>.<key>". Template expressions may appear in most strings, so
+// those are left unconstrained.
+var schemaFields = map[string]map[string]any{
+	"Config.type":      {"const": expectedType},
+	"Config.version":   {"const": expectedVersion},
+	"Config.image":     {"description": "Container image used unless an apply rule or --image overrides it."},
+	"Config.user":      {"description": "User the sandboxed command runs as (default shai)."},
+	"Config.workspace": {"description": "Absolute path the working directory is mounted at (default " + DefaultWorkspace + ")."},
+	"Config.limits":    {"description": "Resource limits for every sandbox; resource sets can only tighten them."},
+	"Config.mask":      {"description": "Workspace globs hidden from the sandbox; \"!pattern\" drops a default."},
+	"Config.resources": {"description": "Named resource sets that apply rules and --resource-set activate."},
+	"Config.apply":     {"description": "Rules activating resource sets for workspace paths."},
+	"Config.include":   {"description": "Files whose resources and mask are merged in; relative paths start at this file, ~/ at the home directory."},
+	"Config.locked":    {"description": "Fields the user overlay (~/.config/shai/config.yaml) may not change: image, user, mask, resources, apply or resources.<name>."},
+
+	"ResourceSet.extends":       {"description": "Resource sets this one builds on; its own entries replace theirs by key."},
+	"ResourceSet.vars":          {"description": "Variables set in the sandbox from host env, files, commands or the keychain."},
+	"ResourceSet.mounts":        {"description": "Host paths mounted into the sandbox."},
+	"ResourceSet.calls":         {"description": "Host commands the sandbox may run through shai-remote."},
+	"ResourceSet.http":          {"description": "Hosts reachable through the HTTP proxy."},
+	"ResourceSet.ports":         {"description": "Host:port pairs reachable directly."},
+	"ResourceSet.host-ports":    {"description": "Host loopback ports forwarded to localhost in the sandbox."},
+	"ResourceSet.ports-out":     {"description": "Sandbox ports published on host loopback."},
+	"ResourceSet.ssh-agent":     {"description": "Forward selected keys of the host ssh-agent."},
+	"ResourceSet.git":           {"description": "Credentials for HTTPS git remotes, obtained from host commands."},
+	"ResourceSet.root-commands": {"description": "Commands run as root during bootstrap."},
+
+	"ResourceOptions.hardening": {"enum": []string{"on", "off"}},
+	"Mount.mode":                {"enum": []string{"ro", "rw"}},
+	"GitCredential.operations":  {"items": map[string]any{"enum": []string{"fetch", "push"}}},
+	"Port.port":                 portRange(1),
+	"HostPort.port":             portRange(1),
+	"HostPort.target":           portRange(0),
+	"PublishedPort.port":        portRange(1),
+	"PublishedPort.host-port":   portRange(0),
+}
+
+func portRange(min int) map[string]any {
+	return map[string]any{"minimum": min, "maximum": 65535}
+}
+
+// Schema returns a JSON Schema for .shai/config.yaml generated from the
+// Config types, for editors and CI.
+func Schema() ([]byte, error) {
+	defs := map[string]any{}
+	root := schemaFor(reflect.TypeOf(Config{}), defs)
+	schema := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     SchemaID,
+		"title":   "shai sandbox config (.shai/config.yaml)",
+		"$ref":    root["$ref"],
+		"$defs":   defs,
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// schemaFor describes t, adding struct types to defs.
+func schemaFor(t reflect.Type, defs map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), defs)}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := defs[name]; !ok {
+			// Reserve the name first so recursive types terminate.
+			defs[name] = nil
+			props := map[string]any{}
+			for _, f := range yamlFields(t) {
+				prop := schemaFor(f.field.Type, defs)
+				for k, v := range schemaFields[name+"."+f.name] {
+					prop[k] = v
+				}
+				props[f.name] = prop
+			}
+			def := map[string]any{
+				"type":                 "object",
+				"properties":           props,
+				"additionalProperties": false,
+			}
+			if required := schemaRequired[name]; len(required) > 0 {
+				def["required"] = required
+			}
+			defs[name] = def
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	}
+	return map[string]any{}
+}
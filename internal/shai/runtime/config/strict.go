@@ -0,0 +1,271 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FieldError reports a config key that no setting decodes, such as a typo
+// like root-command for root-commands.
+type FieldError struct {
+	File   string
+	Line   int
+	Column int
+	// Field is the unknown key and Path the dotted location of the mapping
+	// holding it; Path is empty at the top level.
+	Field string
+	Path  string
+	// Suggestion is a known key close to Field, if any.
+	Suggestion string
+}
+
+func (e *FieldError) Error() string {
+	msg := fmt.Sprintf("%s:%d:%d: unknown field %q", e.File, e.Line, e.Column, e.Field)
+	if e.Path != "" {
+		msg += " in " + e.Path
+	}
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", e.Suggestion)
+	}
+	return msg
+}
+
+// yamlField is a struct field as yaml.v3 decodes it.
+type yamlField struct {
+	name  string
+	field reflect.StructField
+}
+
+// yamlFields lists the keys t decodes, in declaration order.
+func yamlFields(t reflect.Type) []yamlField {
+	var out []yamlField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		out = append(out, yamlField{name: name, field: f})
+	}
+	return out
+}
+
+// CheckSchema checks the config at path, and the files it includes, for
+// structure alone: the YAML decodes, every key is known, and type and
+// version match. Unlike Load it renders no templates and applies no host
+// policy, so the result is the same on every host. Includes whose path uses
+// a template or the home directory are skipped for the same reason.
+func CheckSchema(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read shai config: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("parse shai config: %w", err)
+	}
+	var errs []error
+	if err := checkKnownFields(data, path, reflect.TypeOf(cfg)); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Type != expectedType {
+		errs = append(errs, fmt.Errorf("unsupported config type %q (expected %q)", cfg.Type, expectedType))
+	}
+	if cfg.Version != expectedVersion {
+		errs = append(errs, fmt.Errorf("unsupported config version %d (expected %d)", cfg.Version, expectedVersion))
+	}
+	seen := map[string]bool{}
+	if abs, err := filepath.Abs(path); err == nil {
+		seen[abs] = true
+	}
+	errs = append(errs, checkIncludeSchemas(path, cfg.Include, seen))
+	return errors.Join(errs...)
+}
+
+// checkIncludeSchemas is CheckSchema for the files includes lists.
+func checkIncludeSchemas(from string, includes []string, seen map[string]bool) error {
+	var errs []error
+	for i, inc := range includes {
+		inc = strings.TrimSpace(inc)
+		if templateExpr.MatchString(inc) || inc == "~" || strings.HasPrefix(inc, "~/") {
+			continue
+		}
+		file, err := includePath(from, inc, nil, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: include[%d]: %w", from, i, err))
+			continue
+		}
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		data, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: include %s: %w", from, inc, err))
+			continue
+		}
+		var lib library
+		if err := yaml.Unmarshal(data, &lib); err != nil {
+			errs = append(errs, fmt.Errorf("parse included shai config %s: %w", file, err))
+			continue
+		}
+		if err := checkKnownFields(data, file, reflect.TypeOf(lib)); err != nil {
+			errs = append(errs, err)
+		}
+		errs = append(errs, checkIncludeSchemas(file, lib.Include, seen))
+	}
+	return errors.Join(errs...)
+}
+
+// checkKnownFields decodes data's document node and returns a FieldError for
+// every mapping key that t does not decode. Unlike yaml.v3's KnownFields it
+// reports the column and keeps going after the first unknown key.
+func checkKnownFields(data []byte, file string, t reflect.Type) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	var found []*FieldError
+	walkKnownFields(doc.Content[0], t, "", &found)
+	// An anchored mapping merged in several places is checked each time.
+	type position struct{ line, column int }
+	seen := map[position]bool{}
+	var errs []error
+	for _, fe := range found {
+		if pos := (position{fe.Line, fe.Column}); !seen[pos] {
+			seen[pos] = true
+			fe.File = file
+			errs = append(errs, fe)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isMergeKey reports whether key is a YAML merge key ("<<: *anchor").
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge"
+}
+
+// walkMerged checks the mappings a merge key pulls in as part of the
+// mapping holding it: one alias or a sequence of them.
+func walkMerged(value *yaml.Node, t reflect.Type, path string, errs *[]*FieldError) {
+	if value.Kind == yaml.SequenceNode {
+		for _, item := range value.Content {
+			walkKnownFields(item, t, path, errs)
+		}
+		return
+	}
+	walkKnownFields(value, t, path, errs)
+}
+
+func walkKnownFields(node *yaml.Node, t reflect.Type, path string, errs *[]*FieldError) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if isMergeKey(key) {
+				walkMerged(value, t, path, errs)
+				continue
+			}
+			known := false
+			for _, f := range fields {
+				if f.name == key.Value {
+					walkKnownFields(value, f.field.Type, joinFieldPath(path, key.Value), errs)
+					known = true
+					break
+				}
+			}
+			if !known {
+				*errs = append(*errs, &FieldError{
+					Line:       key.Line,
+					Column:     key.Column,
+					Field:      key.Value,
+					Path:       path,
+					Suggestion: suggestField(key.Value, fields),
+				})
+			}
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if isMergeKey(node.Content[i]) {
+				walkMerged(node.Content[i+1], t, path, errs)
+				continue
+			}
+			walkKnownFields(node.Content[i+1], t.Elem(), joinFieldPath(path, node.Content[i].Value), errs)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			walkKnownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func joinFieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggestField returns the known key closest to name when it is a likely
+// typo: at most two edits away.
+func suggestField(name string, fields []yamlField) string {
+	best, bestDist := "", 3
+	for _, f := range fields {
+		if d := editDistance(name, f.name); d < bestDist {
+			best, bestDist = f.name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
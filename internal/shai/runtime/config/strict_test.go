@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRejectsUnknownFieldsWithPosition(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `type: shai-sandbox
+version: 1
+image: example/image:1
+resources:
+  web:
+    root-command: ["apt-get install -y jq"]
+    mounts:
+      - source: /cache
+        target: /cache
+        mdoe: rw
+apply:
+  - path: ./
+    resources: [web]
+colour: blue
+`)
+
+	_, err := Load(path, nil, nil)
+	require.Error(t, err)
+
+	var fe *FieldError
+	require.True(t, errors.As(err, &fe))
+	assert.Equal(t, &FieldError{
+		File: path, Line: 6, Column: 5,
+		Field: "root-command", Path: "resources.web", Suggestion: "root-commands",
+	}, fe)
+	assert.Contains(t, err.Error(), path+":10:9: unknown field \"mdoe\" in resources.web.mounts[0] (did you mean \"mode\"?)")
+	assert.True(t, strings.HasSuffix(err.Error(), path+":14:1: unknown field \"colour\""), err.Error())
+}
+
+func TestLoadFollowsYAMLMergeKeys(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `type: shai-sandbox
+version: 1
+image: example/image:1
+resources:
+  base: &base
+    http: [github.com]
+    mounts:
+      - source: /cache
+        target: /cache
+  web:
+    <<: *base
+    ports:
+      - host: db.internal
+        port: 5432
+  api:
+    <<: [*base]
+apply:
+  - path: ./
+    resources: [web, api]
+`)
+	cfg, err := Load(path, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"github.com"}, cfg.Resources["web"].HTTP)
+	assert.Equal(t, []string{"github.com"}, cfg.Resources["api"].HTTP)
+
+	path = writeConfig(t, t.TempDir(), `type: shai-sandbox
+version: 1
+image: example/image:1
+resources:
+  base: &base
+    htpp: [github.com]
+  web:
+    <<: *base
+    http: [npmjs.org]
+apply:
+  - path: ./
+    resources: [web]
+`)
+	_, err = Load(path, nil, nil)
+	require.Error(t, err)
+	assert.Equal(t, path+":6:5: unknown field \"htpp\" in resources.base (did you mean \"http\"?)", err.Error())
+}
+
+func TestSchemaMatchesPublishedFile(t *testing.T) {
+	schema, err := Schema()
+	require.NoError(t, err)
+	published, err := os.ReadFile(filepath.Join("..", "..", "..", "..", "docs", "shai-config.schema.json"))
+	require.NoError(t, err)
+	assert.Equal(t, string(published), string(schema), "regenerate with: go run ./cmd/shai schema > docs/shai-config.schema.json")
+}
+
+func TestCheckSchemaIgnoresHostPolicyAndEnv(t *testing.T) {
+	usePolicy(t, `image-registries: [ghcr.io/colony-2]
+`)
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `type: shai-sandbox
+version: 1
+image: docker.io/library/${{ env.SHAI_TEST_UNSET_IMAGE }}
+include: [lib.yaml, "${{ vars.EXTRA }}", ~/shared.yaml]
+resources:
+  web:
+    http: [example.com]
+apply:
+  - path: ./
+    resources: [web]
+`)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".shai", "lib.yaml"), []byte("resources:\n  lib:\n    http: [example.org]\n"), 0o644))
+
+	_, err := Load(path, nil, nil)
+	require.Error(t, err)
+	require.NoError(t, CheckSchema(path))
+}
+
+func TestCheckSchemaReportsUnknownKeysInIncludes(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, `type: shai-sandbox
+version: 2
+include: [lib.yaml, missing.yaml]
+colour: blue
+`)
+	lib := filepath.Join(dir, ".shai", "lib.yaml")
+	require.NoError(t, os.WriteFile(lib, []byte("resources:\n  lib:\n    htp: [example.org]\n"), 0o644))
+
+	err := CheckSchema(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), path+":4:1: unknown field \"colour\"")
+	assert.Contains(t, err.Error(), "unsupported config version 2")
+	assert.Contains(t, err.Error(), lib+":3:5: unknown field \"htp\"")
+	assert.Contains(t, err.Error(), "include missing.yaml")
+}
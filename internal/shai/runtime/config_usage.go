@@ -94,6 +94,26 @@ func callEntriesFromResources(resources []*configpkg.ResolvedResource) ([]*alias
 	return entries, nil
 }
 
+// gitCredentialRulesFromResources flattens git credential rules in resource
+// order; the first matching rule wins when the sandbox asks for a credential.
+func gitCredentialRulesFromResources(resources []*configpkg.ResolvedResource) []alias.GitCredentialRule {
+	var rules []alias.GitCredentialRule
+	for _, res := range resources {
+		if res == nil || res.Spec == nil {
+			continue
+		}
+		for _, g := range res.Spec.Git {
+			rules = append(rules, alias.GitCredentialRule{
+				Remote:     g.Remote,
+				Operations: g.Operations,
+				Username:   g.Username,
+				Command:    g.Command,
+			})
+		}
+	}
+	return rules
+}
+
 func selectImageOverride(cfg *configpkg.Config, orderedPaths []string) string {
 	if cfg == nil {
 		return ""
@@ -52,6 +52,38 @@ func TestCallEntriesFromResources(t *testing.T) {
 	assert.ElementsMatch(t, []string{"git-sync", "deploy"}, names)
 }
 
+func TestGitCredentialRulesFromResources(t *testing.T) {
+	resources := []*config.ResolvedResource{
+		{
+			Name: "github",
+			Spec: &config.ResourceSet{
+				Git: []config.GitCredential{
+					{Remote: "https://github.com/colony-2/*", Operations: []string{"push"}, Command: "gh auth token"},
+				},
+			},
+		},
+		{Name: "empty", Spec: &config.ResourceSet{}},
+	}
+
+	rules := gitCredentialRulesFromResources(resources)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "https://github.com/colony-2/*", rules[0].Remote)
+	assert.Equal(t, []string{"push"}, rules[0].Operations)
+	assert.Equal(t, "gh auth token", rules[0].Command)
+
+	runner := &EphemeralRunner{
+		shaiConfig: &config.Config{User: "shai", Workspace: "/src"},
+		resources:  resources,
+		hostEnv:    map[string]string{},
+	}
+	args, err := runner.buildBootstrapArgs()
+	require.NoError(t, err)
+	assert.Contains(t, args, "--git-credentials")
+	for _, arg := range args {
+		assert.NotContains(t, arg, "gh auth token", "credential commands stay on the host")
+	}
+}
+
 func TestResolvedResourcesWithExtraSets(t *testing.T) {
 	cfg := loadTestConfig(t, `
 type: shai-sandbox
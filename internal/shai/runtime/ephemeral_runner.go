@@ -1,6 +1,7 @@
 package shai
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"crypto/rand"
@@ -9,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
 	"os"
 	"os/signal"
 	"os/user"
@@ -25,6 +27,10 @@ import (
 	"github.com/colony-2/shai/internal/shai/runtime/alias"
 	"github.com/colony-2/shai/internal/shai/runtime/bootstrap"
 	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/colony-2/shai/internal/shai/runtime/hostports"
+	"github.com/colony-2/shai/internal/shai/runtime/overlay"
+	"github.com/colony-2/shai/internal/shai/runtime/sshagent"
+	"github.com/colony-2/shai/internal/shai/runtime/worktree"
 	"github.com/docker/docker/api/types/container"
 	imagetypes "github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
@@ -44,6 +50,7 @@ type EphemeralConfig struct {
 	ResourceSets        []string
 	Verbose             bool
 	PostSetupExec       *ExecSpec
+	Stdin               io.Reader // nil uses os.Stdin
 	Stdout              io.Writer
 	Stderr              io.Writer
 	GracefulStopTimeout time.Duration
@@ -53,19 +60,81 @@ type EphemeralConfig struct {
 	HostGID             string
 	Privileged          bool
 	ShowProgress        bool
+	PublishedPorts      []PublishedPort
+	// CPUs and Memory cap the sandbox on top of the config's limits; the
+	// most restrictive value wins.
+	CPUs   float64
+	Memory string
+	// MaxDuration and IdleTimeout stop the session after a wall-clock limit
+	// or a period without terminal input or output while no exec runs in
+	// it, combined with the config's limits. The session then fails with a
+	// *SessionLimitError.
+	MaxDuration time.Duration
+	IdleTimeout time.Duration
+	// UserConfig merges the user's own config, ~/.config/shai/config.yaml,
+	// over the workspace config.
+	UserConfig bool
+	// RequireTrust refuses repo configs that have not been approved in the
+	// trust store; ConfirmTrust, when set, is asked to approve them.
+	RequireTrust  bool
+	ConfirmTrust  func(TrustRequest) (bool, error)
+	TrustStoreDir string
+	// RWMode selects how read-write paths are mounted: RWModeBind (the
+	// default) writes straight into the working directory, RWModeOverlay
+	// collects writes in an overlay session under OverlayDir (default
+	// ~/.local/state/shai/sessions) for review.
+	RWMode     string
+	OverlayDir string
+	// Worktree runs the sandbox in a fresh clone of the workspace repository
+	// on a new branch (WorktreeBranch, or shai/<timestamp>), mounted
+	// read-write apart from its .git/config and .git/hooks. Clones live
+	// under WorktreeDir (default ~/.local/state/shai/worktrees) and outlast
+	// the session.
+	Worktree       bool
+	WorktreeBranch string
+	WorktreeDir    string
+	// ContainerName names the sandbox container; empty picks shai-<random>.
+	ContainerName string
+
+	// resourceDir, when set, replaces WorkingDir as the directory relative
+	// resource mount sources, vars files and vars commands resolve against.
+	// Pooled sandboxes point it at the template's workspace.
+	resourceDir string
 }
 
-// ExecSpec describes a command to run post-setup.
+// resourceBaseDir returns the directory relative host paths in resource sets
+// resolve against.
+func (c EphemeralConfig) resourceBaseDir() string {
+	if c.resourceDir != "" {
+		return c.resourceDir
+	}
+	return c.WorkingDir
+}
+
+// Read-write mount modes.
+const (
+	RWModeBind    = "bind"
+	RWModeOverlay = "overlay"
+)
+
+// ExecSpec describes a command to run post-setup, or in a running sandbox
+// through Session.Exec.
 type ExecSpec struct {
 	Command []string
 	Env     map[string]string
 	Workdir string
 	UseTTY  bool
+	// Stdin, Stdout and Stderr apply to Session.Exec. A nil Stdin attaches
+	// no input; nil Stdout and Stderr use the process's streams.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
 }
 
 // EphemeralRunner launches ephemeral containers using .shai/config.yaml.
 type EphemeralRunner struct {
 	config             EphemeralConfig
+	fingerprint        string
 	shaiConfig         *configpkg.Config
 	resources          []*configpkg.ResolvedResource
 	resourceNames      []string
@@ -81,6 +150,23 @@ type EphemeralRunner struct {
 	bootstrapDir       string
 	bootstrapMount     string
 	dockerHostAddr     string
+	hostPortRelays     []hostPortRelay
+	sshAgent           *sshagent.Proxy
+	publishedPorts     []PublishedPort
+	portBindings       []PortBinding
+	varsResolved       bool
+	resolvedEnv        map[string]string
+	resolvedFiles      map[string]string
+	limits             configpkg.ResolvedLimits
+	limitsStart        chan struct{}
+	overlay            *overlay.Session
+	worktree           *worktree.Worktree
+}
+
+// hostPortRelay pairs a sandbox localhost port with the host relay serving it.
+type hostPortRelay struct {
+	containerPort int
+	relay         *hostports.Relay
 }
 
 func (r *EphemeralRunner) workspaceDir() string {
@@ -93,59 +179,44 @@ func (r *EphemeralRunner) workspaceDir() string {
 	return ""
 }
 
-// NewEphemeralRunner creates a new ephemeral runner.
+// NewEphemeralRunner creates a new ephemeral runner. Failures are reported
+// as setup errors.
 func NewEphemeralRunner(cfg EphemeralConfig) (*EphemeralRunner, error) {
-	if cfg.WorkingDir == "" {
-		wd, err := os.Getwd()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get working directory: %w", err)
-		}
-		cfg.WorkingDir = wd
-	}
-
-	if !cfg.Verbose && os.Getenv("SHAI_FORCE_VERBOSE") == "1" {
-		cfg.Verbose = true
+	runner, err := newEphemeralRunner(cfg)
+	if err != nil {
+		return nil, asSetupError(err)
 	}
+	return runner, nil
+}
 
-	hostEnv := hostEnvMap()
-	if strings.TrimSpace(cfg.HostUID) == "" || strings.TrimSpace(cfg.HostGID) == "" {
-		uid, gid := hostUserIDs()
-		if strings.TrimSpace(cfg.HostUID) == "" {
-			cfg.HostUID = uid
-		}
-		if strings.TrimSpace(cfg.HostGID) == "" {
-			cfg.HostGID = gid
-		}
-	}
-	configPath := cfg.ConfigFile
-	if configPath == "" {
-		configPath = filepath.Join(cfg.WorkingDir, DefaultConfigRelPath)
+func newEphemeralRunner(cfg EphemeralConfig) (*EphemeralRunner, error) {
+	resolved, err := resolveSandbox(cfg)
+	if err != nil {
+		return nil, err
 	}
-	shaiCfg, _, err := configpkg.LoadOrDefault(configPath, hostEnv, cfg.TemplateVars)
+	fingerprint, err := resolved.fingerprint()
 	if err != nil {
-		return nil, fmt.Errorf("failed to load shai config: %w", err)
+		return nil, err
 	}
+	cfg = resolved.cfg
+	shaiCfg := resolved.shaiCfg
+	mountBuilder := resolved.mountBuilder
+	resources := resolved.resources
 
 	dockerClient, err := newDockerClient()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create docker client: %w", err)
 	}
 
-	mountBuilder, err := NewMountBuilder(cfg.WorkingDir, cfg.ReadWritePaths)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create mount builder: %w", err)
-	}
-
-	workspace := effectiveWorkspace(shaiCfg.Workspace, mountBuilder.ReadWritePaths)
-	shaiCfg.Workspace = workspace
-
-	resources, resourceNames, applyImageOverride, err := resolvedResources(shaiCfg, mountBuilder.ReadWritePaths, cfg.ResourceSets)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve resources: %w", err)
-	}
-	callEntries, err := callEntriesFromResources(resources)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve calls: %w", err)
+	var wt *worktree.Worktree
+	if cfg.Worktree {
+		var wtDir string
+		wt, wtDir, err = startWorktree(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create worktree: %w", err)
+		}
+		cfg.WorkingDir = wtDir
+		mountBuilder.WorkingDir = wtDir
 	}
 
 	mcpBindAddr := getMCPServerBindAddr(context.Background(), dockerClient)
@@ -154,17 +225,51 @@ func NewEphemeralRunner(cfg EphemeralConfig) (*EphemeralRunner, error) {
 		WorkingDir:     cfg.WorkingDir,
 		ShellPath:      os.Getenv("SHELL"),
 		Debug:          os.Getenv("SHAI_ALIAS_DEBUG") != "",
-		Entries:        callEntries,
+		Entries:        resolved.callEntries,
+		GitCredentials: gitCredentialRulesFromResources(resources),
 		DockerHostAddr: dockerHostAddr,
 		MCPBindAddr:    mcpBindAddr,
 	})
 	if err != nil {
+		removeWorktree(wt)
 		return nil, fmt.Errorf("failed to initialize alias service: %w", err)
 	}
 
-	image, imageSource := chooseImage(shaiCfg.Image, cfg.ImageOverride, applyImageOverride)
+	relays, err := startHostPortRelays(resources, mcpBindAddr)
+	if err != nil {
+		aliasSvc.Close()
+		removeWorktree(wt)
+		return nil, fmt.Errorf("failed to start host port relays: %w", err)
+	}
+
+	agentProxy, err := startSSHAgentProxy(resources, resolved.hostEnv)
+	if err != nil {
+		aliasSvc.Close()
+		for _, hp := range relays {
+			_ = hp.relay.Close()
+		}
+		removeWorktree(wt)
+		return nil, fmt.Errorf("failed to start ssh-agent proxy: %w", err)
+	}
+
+	overlaySession, err := startOverlaySession(cfg, mountBuilder.ReadWritePaths)
+	if err != nil {
+		aliasSvc.Close()
+		for _, hp := range relays {
+			_ = hp.relay.Close()
+		}
+		if agentProxy != nil {
+			_ = agentProxy.Close()
+			_ = os.RemoveAll(agentProxy.SocketDir())
+		}
+		removeWorktree(wt)
+		return nil, fmt.Errorf("failed to start overlay session: %w", err)
+	}
+	mountBuilder.Overlay = overlaySession
+
+	image := resolved.image
 	if cfg.Verbose {
-		switch imageSource {
+		switch resolved.imageSource {
 		case "cli":
 			fmt.Fprintf(os.Stderr, "shai: using image override from flag: %s\n", image)
 		case "apply":
@@ -176,20 +281,33 @@ func NewEphemeralRunner(cfg EphemeralConfig) (*EphemeralRunner, error) {
 		config:         cfg,
 		shaiConfig:     shaiCfg,
 		resources:      resources,
-		resourceNames:  resourceNames,
+		resourceNames:  resolved.resourceNames,
 		image:          image,
-		workspace:      workspace,
+		workspace:      resolved.workspace,
 		docker:         dockerClient,
 		mountBuilder:   mountBuilder,
 		aliasSvc:       aliasSvc,
-		hostEnv:        hostEnv,
+		hostEnv:        resolved.hostEnv,
 		hostUID:        cfg.HostUID,
 		hostGID:        cfg.HostGID,
 		dockerHostAddr: dockerHostAddr,
+		hostPortRelays: relays,
+		sshAgent:       agentProxy,
+		publishedPorts: collectPublishedPorts(cfg.PublishedPorts, resources),
+		limits:         resolved.limits,
+		overlay:        overlaySession,
+		worktree:       wt,
+		fingerprint:    fingerprint,
 	}
 	if cfg.Verbose {
-		if len(resourceNames) > 0 {
-			fmt.Fprintf(os.Stderr, "shai: activating resource sets: %s\n", strings.Join(resourceNames, ", "))
+		for _, hp := range relays {
+			fmt.Fprintf(os.Stderr, "shai: forwarding sandbox localhost:%d to host %s\n", hp.containerPort, hp.relay.Target())
+		}
+		if agentProxy != nil {
+			fmt.Fprintf(os.Stderr, "shai: forwarding filtered ssh-agent at %s\n", sshAgentSocketPath)
+		}
+		if len(resolved.resourceNames) > 0 {
+			fmt.Fprintf(os.Stderr, "shai: activating resource sets: %s\n", strings.Join(resolved.resourceNames, ", "))
 		} else {
 			fmt.Fprintln(os.Stderr, "shai: no resource sets activated")
 		}
@@ -200,7 +318,7 @@ func NewEphemeralRunner(cfg EphemeralConfig) (*EphemeralRunner, error) {
 // Run creates and runs the container to completion.
 func (r *EphemeralRunner) Run(ctx context.Context) error {
 	useTTY := r.shouldUseTTY()
-	return r.runEphemeralContainer(ctx, useTTY)
+	return asSetupError(r.runEphemeralContainer(ctx, useTTY))
 }
 
 // Start launches the container and returns a session for supervision.
@@ -211,7 +329,7 @@ func (r *EphemeralRunner) Start(ctx context.Context) (*Session, error) {
 	done := make(chan error, 1)
 	idCh := make(chan string, 1)
 	go func() {
-		done <- r.runEphemeralContainerWithID(sctx, useTTY, idCh)
+		done <- asSetupError(r.runEphemeralContainerWithID(sctx, useTTY, idCh))
 	}()
 
 	var cid string
@@ -223,11 +341,12 @@ func (r *EphemeralRunner) Start(ctx context.Context) (*Session, error) {
 		return nil, err
 	case <-time.After(10 * time.Second):
 		cancel()
-		return nil, errors.New("timeout creating container")
+		return nil, asSetupError(errors.New("timeout creating container"))
 	}
 
 	return &Session{
 		ContainerID: cid,
+		Ports:       r.PortBindings(),
 		waitCh:      done,
 		cancel:      cancel,
 		docker:      r.docker,
@@ -240,6 +359,15 @@ func (r *EphemeralRunner) Close() error {
 	if r.aliasSvc != nil {
 		r.aliasSvc.Close()
 	}
+	for _, hp := range r.hostPortRelays {
+		_ = hp.relay.Close()
+	}
+	r.hostPortRelays = nil
+	if r.sshAgent != nil {
+		_ = r.sshAgent.Close()
+		_ = os.RemoveAll(r.sshAgent.SocketDir())
+		r.sshAgent = nil
+	}
 	if r.bootstrapDir != "" {
 		_ = os.RemoveAll(r.bootstrapDir)
 		r.bootstrapDir = ""
@@ -256,6 +384,13 @@ func (r *EphemeralRunner) GetContainerID() string {
 	return r.currentContainerID
 }
 
+// PortBindings returns the host bindings of published ports once the container has started.
+func (r *EphemeralRunner) PortBindings() []PortBinding {
+	out := make([]PortBinding, len(r.portBindings))
+	copy(out, r.portBindings)
+	return out
+}
+
 func (r *EphemeralRunner) shouldUseTTY() bool {
 	if r.config.PostSetupExec != nil {
 		return r.config.PostSetupExec.UseTTY
@@ -269,7 +404,10 @@ func (r *EphemeralRunner) runEphemeralContainer(ctx context.Context, useTTY bool
 }
 
 func (r *EphemeralRunner) runEphemeralContainerWithID(ctx context.Context, useTTY bool, idCh chan<- string) error {
-	containerName := generateContainerName()
+	containerName := strings.TrimSpace(r.config.ContainerName)
+	if containerName == "" {
+		containerName = generateContainerName()
+	}
 
 	containerCfg, hostCfg, err := r.buildDockerConfigs(useTTY, containerName)
 	if err != nil {
@@ -281,14 +419,31 @@ func (r *EphemeralRunner) runEphemeralContainerWithID(ctx context.Context, useTT
 	}
 
 	resp, err := r.docker.ContainerCreate(ctx, containerCfg, hostCfg, nil, nil, containerName)
+	if err != nil && hostCfg.StorageOpt != nil && storageOptUnsupported(err) {
+		fmt.Fprintln(os.Stderr, "Warning: the docker storage driver cannot limit storage; continuing without a storage limit")
+		hostCfg.StorageOpt = nil
+		resp, err = r.docker.ContainerCreate(ctx, containerCfg, hostCfg, nil, nil, containerName)
+	}
 	if err != nil {
 		return fmt.Errorf("create container: %w", err)
 	}
 	r.currentContainerID = resp.ID
+	if err := r.stagePrivateFiles(ctx, resp.ID); err != nil {
+		_ = r.docker.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
+		return err
+	}
+	oomCtx, stopOOMWatch := context.WithCancel(ctx)
+	defer stopOOMWatch()
+	oom := watchOOM(oomCtx, r.docker, resp.ID)
 
 	if err := r.docker.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		return fmt.Errorf("start container: %w", err)
 	}
+	if len(r.publishedPorts) > 0 {
+		if err := r.resolvePortBindings(ctx, resp.ID); err != nil {
+			return err
+		}
+	}
 
 	select {
 	case idCh <- resp.ID:
@@ -307,26 +462,34 @@ func (r *EphemeralRunner) runEphemeralContainerWithID(ctx context.Context, useTT
 	}
 	defer hijacked.Close()
 
+	stdin := r.config.Stdin
+	if stdin == nil {
+		stdin = os.Stdin
+	}
 	stdinFD := os.Stdin.Fd()
-	interactiveTTY := useTTY && term.IsTerminal(stdinFD)
+	interactiveTTY := useTTY && stdin == os.Stdin && term.IsTerminal(stdinFD)
 
 	var resizeStop func()
 	if interactiveTTY {
 		if st, err := term.MakeRaw(stdinFD); err == nil {
 			defer term.RestoreTerminal(stdinFD, st)
 		}
-		resizeStop = r.startTTYResizeWatcher(ctx, stdinFD, resp.ID)
+		resizeStop = startTTYResizeWatcher(ctx, stdinFD, func(opts container.ResizeOptions) error {
+			return r.docker.ContainerResize(context.Background(), resp.ID, opts)
+		})
 	}
 	if resizeStop != nil {
 		defer resizeStop()
 	}
 
+	activity := newActivityTracker()
 	var ctrlFilter *ctrlCFilter
-	stdinReader := io.Reader(os.Stdin)
+	stdinReader := stdin
 	if interactiveTTY {
-		ctrlFilter = newCtrlCFilter(os.Stdin)
+		ctrlFilter = newCtrlCFilter(stdin)
 		stdinReader = ctrlFilter
 	}
+	stdinReader = activity.reader(stdinReader)
 
 	enableCtrlC := func() {}
 	if ctrlFilter != nil {
@@ -341,10 +504,13 @@ func (r *EphemeralRunner) runEphemeralContainerWithID(ctx context.Context, useTT
 	}()
 
 	startMarker := r.buildStartMarker()
+	outputDone := make(chan struct{})
 
+	var writer *execStartDetector
 	if interactiveTTY {
-		writer := newExecStartDetector(os.Stdout, startMarker, enableCtrlC)
+		writer = newExecStartDetector(activity.writer(os.Stdout), startMarker, enableCtrlC)
 		go func() {
+			defer close(outputDone)
 			_, err := io.Copy(writer, hijacked.Conn)
 			if closeErr := writer.Close(); err == nil {
 				err = closeErr
@@ -352,8 +518,9 @@ func (r *EphemeralRunner) runEphemeralContainerWithID(ctx context.Context, useTT
 			errCh <- err
 		}()
 	} else if useTTY {
-		writer := newExecStartDetector(os.Stdout, startMarker, nil)
+		writer = newExecStartDetector(activity.writer(os.Stdout), startMarker, nil)
 		go func() {
+			defer close(outputDone)
 			_, err := io.Copy(writer, hijacked.Conn)
 			if closeErr := writer.Close(); err == nil {
 				err = closeErr
@@ -361,17 +528,15 @@ func (r *EphemeralRunner) runEphemeralContainerWithID(ctx context.Context, useTT
 			errCh <- err
 		}()
 	} else {
+		stdout := r.config.Stdout
+		if stdout == nil {
+			stdout = os.Stdout
+		}
+		stderr := r.stderr()
+		writer = newExecStartDetector(activity.writer(stdout), startMarker, nil)
 		go func() {
-			stdout := r.config.Stdout
-			if stdout == nil {
-				stdout = os.Stdout
-			}
-			stderr := r.config.Stderr
-			if stderr == nil {
-				stderr = os.Stderr
-			}
-			writer := newExecStartDetector(stdout, startMarker, nil)
-			_, err := stdcopy.StdCopy(writer, stderr, hijacked.Reader)
+			defer close(outputDone)
+			_, err := stdcopy.StdCopy(writer, activity.writer(stderr), hijacked.Reader)
 			if closeErr := writer.Close(); err == nil {
 				err = closeErr
 			}
@@ -388,10 +553,23 @@ func (r *EphemeralRunner) runEphemeralContainerWithID(ctx context.Context, useTT
 	default:
 	}
 
+	limitCtx, stopLimitWatch := context.WithCancel(ctx)
+	defer stopLimitWatch()
+	busy := func(ctx context.Context) bool { return execRunning(ctx, r.docker, resp.ID) }
+	limitCh := watchSessionLimits(limitCtx, r.limits.MaxDuration, r.limits.IdleTimeout, activity, busy, r.limitsStart)
+
 	var status container.WaitResponse
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
+	case limitErr := <-limitCh:
+		r.stopForSessionLimit(ctx, resp.ID, limitErr)
+		select {
+		case <-ctx.Done():
+		case <-errChWait:
+		case <-waitCh:
+		}
+		return limitErr
 	case err = <-errChWait:
 		if err != nil {
 			return err
@@ -404,13 +582,35 @@ func (r *EphemeralRunner) runEphemeralContainerWithID(ctx context.Context, useTT
 		return errors.New(status.Error.Message)
 	}
 	if status.StatusCode != 0 {
-		return fmt.Errorf("container exited with status %d", status.StatusCode)
+		// The start marker may still be in flight when the container exits.
+		select {
+		case <-outputDone:
+		case <-time.After(time.Second):
+		}
+		exitErr := containerExitError(status.StatusCode, writer.Started())
+		if oomKilled(oom, status.StatusCode) {
+			exitErr.Err = oomError(r.limits)
+		}
+		return exitErr
 	}
 	return nil
 }
 
 const (
 	bootstrapConfigVersion = 1
+
+	bootstrapMountTarget = configpkg.BootstrapMountTarget
+	// bootstrapPrivateDir is copied into the bootstrap mount through the
+	// daemon after the container is created; see privateArchive.
+	bootstrapPrivateDir = "private"
+	// execEnvFileName holds NUL-separated KEY=VALUE pairs for the user
+	// environment. Values never appear on the container command line;
+	// bootstrap deletes the file once it has been read.
+	execEnvFileName = "exec.env"
+
+	// sshAgentMountDir holds the filtered ssh-agent socket inside the sandbox.
+	sshAgentMountDir   = "/run/shai-ssh-agent"
+	sshAgentSocketPath = sshAgentMountDir + "/agent.sock"
 )
 
 // buildStartMarker constructs the exact bootstrap completion marker that the
@@ -422,7 +622,8 @@ func (r *EphemeralRunner) buildStartMarker() string {
 		targetUser = r.config.UserOverride
 	}
 
-	resourceSummary := ""
+	// Bootstrap prints "none" when no resource sets are active.
+	resourceSummary := "none"
 	if len(r.resourceNames) > 0 {
 		resourceSummary = strings.Join(r.resourceNames, ", ")
 	}
@@ -440,8 +641,12 @@ func (r *EphemeralRunner) buildDockerConfigs(useTTY bool, containerName string)
 	if err != nil {
 		return nil, nil, err
 	}
+	_, secretFiles, err := r.collectEnvMappings()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	entrypoint := []string{"/shai-bootstrap/boot.sh"}
+	entrypoint := []string{bootstrapMountTarget + "/boot.sh"}
 
 	env := []string{}
 	if r.config.Verbose {
@@ -456,6 +661,9 @@ func (r *EphemeralRunner) buildDockerConfigs(useTTY bool, containerName string)
 	if strings.TrimSpace(r.hostGID) != "" {
 		env = append(env, fmt.Sprintf("DEV_GID=%s", strings.TrimSpace(r.hostGID)))
 	}
+	if r.sshAgent != nil {
+		env = append(env, "SSH_AUTH_SOCK="+sshAgentSocketPath)
+	}
 
 	cfg := &container.Config{
 		Image:        r.image,
@@ -470,6 +678,7 @@ func (r *EphemeralRunner) buildDockerConfigs(useTTY bool, containerName string)
 		AttachStderr: true,
 		OpenStdin:    true,
 		Env:          env,
+		Labels:       r.sessionLabels(),
 	}
 
 	mounts := r.mountBuilder.BuildMounts()
@@ -478,12 +687,44 @@ func (r *EphemeralRunner) buildDockerConfigs(useTTY bool, containerName string)
 		return nil, nil, err
 	}
 	mounts = append(mounts, resourceMounts...)
+	mounts = append(mounts, r.worktreeMounts()...)
+	masks, collapsed, err := r.mountBuilder.MaskMounts(maskPatterns(r.shaiConfig, r.resources), r.bootstrapMount)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(collapsed) > 0 {
+		fmt.Fprintf(r.stderr(), "Warning: mask patterns matched more than %d paths; masking these directories whole:\n", maxMaskedPaths)
+		for _, dir := range collapsed {
+			fmt.Fprintf(r.stderr(), "  - %s\n", dir)
+		}
+	}
+	if r.mountBuilder.GitConfigExposed() {
+		fmt.Fprintln(r.stderr(), "Warning: .git is writable, so credentials in .git/config stay visible in the sandbox")
+	}
+	mounts = append(mounts, masks...)
 	mounts = append(mounts, mount.Mount{
 		Type:     mount.TypeBind,
 		Source:   r.bootstrapMount,
-		Target:   "/shai-bootstrap",
+		Target:   bootstrapMountTarget,
 		ReadOnly: false,
 	})
+	if len(secretFiles) > 0 {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeTmpfs,
+			Target: secretsMountDir,
+			TmpfsOptions: &mount.TmpfsOptions{
+				SizeBytes: 1 << 20,
+				Mode:      0o700,
+			},
+		})
+	}
+	if r.sshAgent != nil {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: r.sshAgent.SocketDir(),
+			Target: sshAgentMountDir,
+		})
+	}
 
 	// Determine if container should run in privileged mode
 	privileged := r.config.Privileged || r.hasPrivilegedResource()
@@ -495,6 +736,19 @@ func (r *EphemeralRunner) buildDockerConfigs(useTTY bool, containerName string)
 		CapAdd:     []string{"NET_ADMIN"},
 		Privileged: privileged,
 	}
+	if hardeningEnabled(privileged, r.resources) {
+		applyHardening(hostCfg)
+	}
+	applyLimits(hostCfg, r.limits)
+	if exposed, bindings := dockerPortConfig(r.publishedPorts); len(bindings) > 0 {
+		cfg.ExposedPorts = exposed
+		hostCfg.PortBindings = bindings
+	}
+	if len(r.hostPortRelays) > 0 {
+		// Host ports are reached by DNAT-ing loopback traffic to the docker host,
+		// which the kernel only routes when route_localnet is enabled.
+		hostCfg.Sysctls = map[string]string{"net.ipv4.conf.all.route_localnet": "1"}
+	}
 	return cfg, hostCfg, nil
 }
 
@@ -509,7 +763,7 @@ func (r *EphemeralRunner) hasPrivilegedResource() bool {
 }
 
 func (r *EphemeralRunner) buildBootstrapArgs() ([]string, error) {
-	envMap, err := r.collectEnvMappings()
+	envMap, secretFiles, err := r.collectEnvMappings()
 	if err != nil {
 		return nil, err
 	}
@@ -541,8 +795,11 @@ func (r *EphemeralRunner) buildBootstrapArgs() ([]string, error) {
 		args = append(args, "--resource-name", name)
 	}
 
-	for _, pair := range orderedKeyValuePairs(envMap) {
-		args = append(args, "--exec-env", pair)
+	if len(envMap) > 0 || (exec != nil && len(exec.Env) > 0) {
+		args = append(args, "--exec-env-file", path.Join(bootstrapMountTarget, bootstrapPrivateDir, execEnvFileName))
+	}
+	for _, name := range sortedKeys(secretFiles) {
+		args = append(args, "--secret-file", name)
 	}
 
 	if exec != nil && len(exec.Command) > 0 {
@@ -550,11 +807,6 @@ func (r *EphemeralRunner) buildBootstrapArgs() ([]string, error) {
 			args = append(args, "--exec-cmd", arg)
 		}
 	}
-	if exec != nil && len(exec.Env) > 0 {
-		for _, pair := range orderedKeyValuePairs(exec.Env) {
-			args = append(args, "--exec-env", pair)
-		}
-	}
 
 	for _, host := range httpList {
 		args = append(args, "--http-allow", host)
@@ -562,11 +814,24 @@ func (r *EphemeralRunner) buildBootstrapArgs() ([]string, error) {
 	for _, entry := range portList {
 		args = append(args, "--port-allow", entry)
 	}
+	for _, hp := range r.hostPortRelays {
+		args = append(args, "--host-port", fmt.Sprintf("%d:%d", hp.containerPort, hp.relay.Port()))
+	}
+	for _, pp := range r.publishedPorts {
+		args = append(args, "--publish-port", strconv.Itoa(pp.Port))
+	}
+	if len(gitCredentialRulesFromResources(r.resources)) > 0 {
+		args = append(args, "--git-credentials")
+	}
 
 	for _, cmd := range rootCommands {
 		args = append(args, "--root-cmd", cmd)
 	}
 
+	if hardeningEnabled(r.config.Privileged || r.hasPrivilegedResource(), r.resources) {
+		args = append(args, "--hardened")
+	}
+
 	if r.config.Verbose {
 		args = append(args, "--verbose")
 	}
@@ -574,29 +839,129 @@ func (r *EphemeralRunner) buildBootstrapArgs() ([]string, error) {
 	return args, nil
 }
 
-func (r *EphemeralRunner) collectEnvMappings() (map[string]string, error) {
+// execEnvPairs returns resolved vars and exec env as KEY=VALUE pairs. Exec
+// env comes last so it overrides vars with the same name.
+func (r *EphemeralRunner) execEnvPairs() ([]string, error) {
+	envMap, _, err := r.collectEnvMappings()
+	if err != nil {
+		return nil, err
+	}
+	pairs := orderedKeyValuePairs(envMap)
+	if exec := r.config.PostSetupExec; exec != nil {
+		pairs = append(pairs, orderedKeyValuePairs(exec.Env)...)
+	}
+	return pairs, nil
+}
+
+// privateArchive packs the exec env file and as-file values into a tar rooted
+// at bootstrapPrivateDir. Every entry is owned by uid 0, files 0600 and dirs
+// 0700, so inside the sandbox only root (bootstrap) can read them, whatever
+// uid the host user maps to. It returns nil when there is nothing to stage.
+func (r *EphemeralRunner) privateArchive() ([]byte, error) {
+	pairs, err := r.execEnvPairs()
+	if err != nil {
+		return nil, err
+	}
+	_, secretFiles, err := r.collectEnvMappings()
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 && len(secretFiles) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	now := time.Now()
+	writeDir := func(name string) error {
+		return tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0o700, ModTime: now})
+	}
+	writeFile := func(name string, data []byte) error {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := writeDir(bootstrapPrivateDir); err != nil {
+		return nil, fmt.Errorf("stage exec env: %w", err)
+	}
+	if len(pairs) > 0 {
+		var env bytes.Buffer
+		for _, pair := range pairs {
+			env.WriteString(pair)
+			env.WriteByte(0)
+		}
+		if err := writeFile(path.Join(bootstrapPrivateDir, execEnvFileName), env.Bytes()); err != nil {
+			return nil, fmt.Errorf("stage exec env: %w", err)
+		}
+	}
+	if len(secretFiles) > 0 {
+		dir := path.Join(bootstrapPrivateDir, secretsStageDir)
+		if err := writeDir(dir); err != nil {
+			return nil, fmt.Errorf("create secrets dir: %w", err)
+		}
+		for _, name := range sortedKeys(secretFiles) {
+			if err := writeFile(path.Join(dir, name), []byte(secretFiles[name])); err != nil {
+				return nil, fmt.Errorf("stage secret %s: %w", name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("stage exec env: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// stagePrivateFiles copies privateArchive into the created container's
+// bootstrap mount. Going through the daemon rather than the host filesystem
+// is what lets the files be owned by the container's root.
+func (r *EphemeralRunner) stagePrivateFiles(ctx context.Context, containerID string) error {
+	archive, err := r.privateArchive()
+	if err != nil || archive == nil {
+		return err
+	}
+	if err := r.docker.CopyToContainer(ctx, containerID, bootstrapMountTarget, bytes.NewReader(archive), container.CopyToContainerOptions{}); err != nil {
+		return fmt.Errorf("stage exec env: %w", err)
+	}
+	return nil
+}
+
+// collectEnvMappings resolves vars entries on the host. Values destined for
+// the environment and for as-file delivery are returned separately, keyed by
+// target name. Results are cached so secret commands run once per session.
+func (r *EphemeralRunner) collectEnvMappings() (map[string]string, map[string]string, error) {
+	if r.varsResolved {
+		return r.resolvedEnv, r.resolvedFiles, nil
+	}
 	envs := map[string]string{}
+	files := map[string]string{}
 	for _, res := range r.resources {
 		if res == nil || res.Spec == nil {
 			continue
 		}
 		for _, vm := range res.Spec.Vars {
-			source := strings.TrimSpace(vm.Source)
-			if source == "" {
-				return nil, errors.New("vars entry missing source")
-			}
-			value, ok := r.hostEnv[source]
-			if !ok {
-				return nil, fmt.Errorf("host env %q not set", source)
+			value, err := r.resolveVar(vm)
+			if err != nil {
+				return nil, nil, err
 			}
 			target := strings.TrimSpace(vm.Target)
 			if target == "" {
-				target = source
+				target = strings.TrimSpace(vm.Source)
+			}
+			if vm.AsFile {
+				files[target] = value
+				delete(envs, target)
+				continue
 			}
 			envs[target] = value
+			delete(files, target)
 		}
 	}
-	return envs, nil
+	r.resolvedEnv, r.resolvedFiles, r.varsResolved = envs, files, true
+	return envs, files, nil
 }
 
 func (r *EphemeralRunner) resourceMounts() ([]mount.Mount, error) {
@@ -609,7 +974,7 @@ func (r *EphemeralRunner) resourceMounts() ([]mount.Mount, error) {
 		for _, m := range res.Spec.Mounts {
 			source := m.Source
 			if !filepath.IsAbs(source) {
-				source = filepath.Join(r.config.WorkingDir, source)
+				source = filepath.Join(r.config.resourceBaseDir(), source)
 			}
 			if _, err := os.Stat(source); err != nil {
 				if errors.Is(err, fs.ErrNotExist) {
@@ -662,9 +1027,33 @@ func (r *EphemeralRunner) ensureImage(ctx context.Context, img string) error {
 	return nil
 }
 
+// stderr returns the configured stderr, or os.Stderr.
+func (r *EphemeralRunner) stderr() io.Writer {
+	if r.config.Stderr != nil {
+		return r.config.Stderr
+	}
+	return os.Stderr
+}
+
+// resolvePortBindings records the host ports docker assigned and announces them.
+func (r *EphemeralRunner) resolvePortBindings(ctx context.Context, containerID string) error {
+	info, err := r.docker.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("inspect container ports: %w", err)
+	}
+	if info.NetworkSettings != nil {
+		r.portBindings = portBindingsFromMap(info.NetworkSettings.Ports)
+	}
+	for _, b := range r.portBindings {
+		fmt.Fprintf(r.stderr(), "shai: sandbox port %d published at %s\n", b.ContainerPort, b.URL())
+	}
+	return nil
+}
+
 // Session represents a started container.
 type Session struct {
 	ContainerID string
+	Ports       []PortBinding
 	waitCh      <-chan error
 	cancel      context.CancelFunc
 	docker      *client.Client
@@ -744,7 +1133,7 @@ type execStartDetector struct {
 	dst       io.Writer
 	marker    []byte
 	buf       []byte
-	triggered bool
+	triggered atomic.Bool
 	onExec    func()
 }
 
@@ -763,7 +1152,7 @@ func (d *execStartDetector) Write(p []byte) (int, error) {
 	if _, err := d.dst.Write(p); err != nil {
 		return 0, err
 	}
-	if d.triggered || len(d.marker) == 0 {
+	if d.triggered.Load() || len(d.marker) == 0 {
 		return len(p), nil
 	}
 
@@ -772,7 +1161,7 @@ func (d *execStartDetector) Write(p []byte) (int, error) {
 		searchLimit := len(d.buf) - len(d.marker)
 		for i := 0; i <= searchLimit; i++ {
 			if bytes.Equal(d.buf[i:i+len(d.marker)], d.marker) {
-				d.triggered = true
+				d.triggered.Store(true)
 				if d.onExec != nil {
 					d.onExec()
 				}
@@ -791,17 +1180,25 @@ func (d *execStartDetector) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// Started reports whether the marker has been seen, i.e. bootstrap handed
+// over to the command.
+func (d *execStartDetector) Started() bool {
+	return d.triggered.Load()
+}
+
 func (d *execStartDetector) Close() error {
 	return nil
 }
 
-func (r *EphemeralRunner) startTTYResizeWatcher(ctx context.Context, fd uintptr, containerID string) func() {
+// startTTYResizeWatcher keeps a container or exec TTY sized to the terminal
+// on fd; resizeFn applies a size.
+func startTTYResizeWatcher(ctx context.Context, fd uintptr, resizeFn func(container.ResizeOptions) error) func() {
 	if !term.IsTerminal(fd) {
 		return nil
 	}
 	resize := func() {
 		if ws, err := term.GetWinsize(fd); err == nil && ws != nil {
-			_ = r.docker.ContainerResize(context.Background(), containerID, container.ResizeOptions{
+			_ = resizeFn(container.ResizeOptions{
 				Height: uint(ws.Height),
 				Width:  uint(ws.Width),
 			})
@@ -832,15 +1229,20 @@ func (r *EphemeralRunner) startTTYResizeWatcher(ctx context.Context, fd uintptr,
 	}
 }
 
-func orderedKeyValuePairs(values map[string]string) []string {
-	if len(values) == 0 {
-		return nil
-	}
+func sortedKeys(values map[string]string) []string {
 	keys := make([]string, 0, len(values))
 	for k := range values {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
+	return keys
+}
+
+func orderedKeyValuePairs(values map[string]string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	keys := sortedKeys(values)
 	pairs := make([]string, 0, len(keys))
 	for _, k := range keys {
 		pairs = append(pairs, fmt.Sprintf("%s=%s", k, values[k]))
@@ -892,6 +1294,111 @@ func uniquePortEntries(resources []*configpkg.ResolvedResource) []string {
 	return entries
 }
 
+// startHostPortRelays starts one host relay per unique host-ports entry. Relays
+// bind to the same address as the alias MCP server so the sandbox can reach
+// them through the docker host. When that address is the all-interfaces
+// fallback, host ports are refused rather than exposed to the network.
+func startHostPortRelays(resources []*configpkg.ResolvedResource, bindAddr string) ([]hostPortRelay, error) {
+	host, _, err := net.SplitHostPort(bindAddr)
+	if err != nil {
+		host = "127.0.0.1"
+	}
+	listenAddr := net.JoinHostPort(host, "0")
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		for _, res := range resources {
+			if res != nil && res.Spec != nil && len(res.Spec.HostPorts) > 0 {
+				return nil, fmt.Errorf("resource %s requests host-ports, but the docker bridge address could not be determined; shai will not relay host ports on all interfaces", res.Name)
+			}
+		}
+		return nil, nil
+	}
+
+	var relays []hostPortRelay
+	seen := make(map[int]bool)
+	for _, res := range resources {
+		if res == nil || res.Spec == nil {
+			continue
+		}
+		for _, hp := range res.Spec.HostPorts {
+			target := hp.ContainerPort()
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+			relay, err := hostports.Start(listenAddr, hp.Port)
+			if err != nil {
+				for _, started := range relays {
+					_ = started.relay.Close()
+				}
+				return nil, fmt.Errorf("resource %s host port %d: %w", res.Name, hp.Port, err)
+			}
+			relays = append(relays, hostPortRelay{containerPort: target, relay: relay})
+		}
+	}
+	sort.Slice(relays, func(i, j int) bool {
+		return relays[i].containerPort < relays[j].containerPort
+	})
+	return relays, nil
+}
+
+// startSSHAgentProxy starts a filtering proxy for the host ssh-agent when any
+// active resource set requests one. Keys are unioned across resource sets;
+// host restriction covers the ports of every set that asks for it.
+func startSSHAgentProxy(resources []*configpkg.ResolvedResource, hostEnv map[string]string) (*sshagent.Proxy, error) {
+	var (
+		keys     []string
+		dests    []sshagent.Destination
+		restrict bool
+		active   bool
+	)
+	for _, res := range resources {
+		if res == nil || res.Spec == nil || res.Spec.SSHAgent == nil {
+			continue
+		}
+		active = true
+		keys = append(keys, res.Spec.SSHAgent.Keys...)
+		if res.Spec.SSHAgent.RestrictHosts {
+			restrict = true
+			for _, p := range res.Spec.Ports {
+				dests = append(dests, sshagent.Destination{Host: p.Host, Port: p.Port})
+			}
+		}
+	}
+	if !active {
+		return nil, nil
+	}
+
+	cfg := sshagent.Config{
+		Upstream: hostEnv["SSH_AUTH_SOCK"],
+		Keys:     keys,
+	}
+	if restrict {
+		var files []string
+		if home := strings.TrimSpace(hostEnv["HOME"]); home != "" {
+			files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+		}
+		files = append(files, "/etc/ssh/ssh_known_hosts")
+		known, err := sshagent.LoadKnownHosts(files...)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Destinations = dests
+		cfg.KnownHosts = known
+	}
+
+	dir, err := os.MkdirTemp("", "shai-ssh-")
+	if err != nil {
+		return nil, err
+	}
+	cfg.SocketPath = filepath.Join(dir, filepath.Base(sshAgentSocketPath))
+	proxy, err := sshagent.Start(cfg)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return proxy, nil
+}
+
 func collectRootCommands(resources []*configpkg.ResolvedResource) []string {
 	var commands []string
 	for _, res := range resources {
@@ -917,19 +1424,33 @@ func (r *EphemeralRunner) ensureBootstrapScript() error {
 	if err != nil {
 		return fmt.Errorf("generate bootstrap id: %w", err)
 	}
+	// The 0700 base dir keeps the mount private on the host. The mounted dir
+	// below it must be readable by whatever uid bootstrap runs as, which need
+	// not be the host user (user namespaces, rootless runtimes); values never
+	// land here from the host side, see privateArchive.
 	baseDir := filepath.Join(os.TempDir(), "shai-"+id)
+	if err := os.Mkdir(baseDir, 0o700); err != nil {
+		return fmt.Errorf("create bootstrap dir: %w", err)
+	}
 	scriptDir := filepath.Join(baseDir, "shai-bootstrap")
-	if err := os.MkdirAll(scriptDir, 0o700); err != nil {
+	if err := mkdirMode(scriptDir, 0o755); err != nil {
 		return fmt.Errorf("create bootstrap dir: %w", err)
 	}
 	scriptPath := filepath.Join(scriptDir, "boot.sh")
-	if err := os.WriteFile(scriptPath, bootstrap.Script, 0o700); err != nil {
+	if err := writeFileMode(scriptPath, bootstrap.Script, 0o755); err != nil {
 		return fmt.Errorf("write bootstrap script: %w", err)
 	}
 	aliasPath := filepath.Join(scriptDir, "shai-remote")
-	if err := os.WriteFile(aliasPath, bootstrap.AliasScript, 0o700); err != nil {
+	if err := writeFileMode(aliasPath, bootstrap.AliasScript, 0o755); err != nil {
 		return fmt.Errorf("write alias script: %w", err)
 	}
+	credentialPath := filepath.Join(scriptDir, "git-credential-shai")
+	if err := writeFileMode(credentialPath, bootstrap.GitCredentialScript, 0o755); err != nil {
+		return fmt.Errorf("write git credential helper: %w", err)
+	}
+	if err := writeFileMode(filepath.Join(scriptDir, "shai-exec"), bootstrap.ExecScript, 0o755); err != nil {
+		return fmt.Errorf("write exec helper: %w", err)
+	}
 	confDir := filepath.Join(scriptDir, "conf")
 	if err := copyEmbeddedDir(bootstrap.ConfFS, "conf", confDir); err != nil {
 		return fmt.Errorf("write bootstrap configs: %w", err)
@@ -939,6 +1460,23 @@ func (r *EphemeralRunner) ensureBootstrapScript() error {
 	return nil
 }
 
+// mkdirMode creates dir with exactly perm, regardless of the host umask.
+func mkdirMode(dir string, perm os.FileMode) error {
+	if err := os.Mkdir(dir, perm); err != nil {
+		return err
+	}
+	return os.Chmod(dir, perm)
+}
+
+// writeFileMode writes data to path with exactly perm, regardless of the
+// host umask.
+func writeFileMode(path string, data []byte, perm os.FileMode) error {
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return err
+	}
+	return os.Chmod(path, perm)
+}
+
 func randomHex(n int) (string, error) {
 	buf := make([]byte, n)
 	if _, err := rand.Read(buf); err != nil {
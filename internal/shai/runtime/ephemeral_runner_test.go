@@ -1,10 +1,16 @@
 package shai
 
 import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 
+	"github.com/colony-2/shai/internal/shai/runtime/bootstrap"
 	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
 	"github.com/stretchr/testify/require"
 )
@@ -52,17 +58,127 @@ func TestBuildBootstrapArgsIncludesResources(t *testing.T) {
 		"--user", "shai",
 		"--workspace", "/src",
 		"--rm", "true",
-		"--exec-env", "INSIDE_TOKEN=super-secret",
+		"--exec-env-file", "/shai-bootstrap/private/exec.env",
 		"--exec-cmd", "/bin/bash",
 		"--exec-cmd", "-lc",
 		"--exec-cmd", "echo hi",
-		"--exec-env", "FOO=bar",
 		"--http-allow", "example.com",
 		"--port-allow", "github.com:443",
+		"--hardened",
 		"--verbose",
 	}, args)
 }
 
+func TestBuildDockerConfigsKeepsVarValuesOutOfCmd(t *testing.T) {
+	tDir := t.TempDir()
+	mountBuilder, err := NewMountBuilder(tDir, "", nil)
+	require.NoError(t, err)
+
+	runner := &EphemeralRunner{
+		config: EphemeralConfig{
+			WorkingDir: tDir,
+			PostSetupExec: &ExecSpec{
+				Command: []string{"env"},
+				Env:     map[string]string{"EXEC_SECRET": "exec-value"},
+			},
+		},
+		shaiConfig:   &configpkg.Config{User: "shai", Workspace: "/src"},
+		mountBuilder: mountBuilder,
+		image:        "example",
+		resources: []*configpkg.ResolvedResource{
+			{
+				Name: "base",
+				Spec: &configpkg.ResourceSet{
+					Vars: []configpkg.VarMapping{
+						{Source: "TOKEN", Target: "INSIDE_TOKEN"},
+						{Source: "MULTILINE"},
+					},
+				},
+			},
+		},
+		hostEnv: map[string]string{
+			"TOKEN":     "super-secret",
+			"MULTILINE": "line1\nline2",
+		},
+	}
+	defer runner.Close()
+
+	cfg, _, err := runner.buildDockerConfigs(false, "sandbox-test")
+	require.NoError(t, err)
+	for _, value := range []string{"super-secret", "line1", "exec-value"} {
+		for _, arg := range cfg.Cmd {
+			require.NotContains(t, arg, value, "var values must not appear in container Cmd")
+		}
+		for _, env := range cfg.Env {
+			require.NotContains(t, env, value, "var values must not appear in container Env")
+		}
+	}
+
+	// Nothing is staged on the host; values reach the container through
+	// privateArchive once it has been created.
+	_, err = os.Stat(filepath.Join(runner.bootstrapMount, bootstrapPrivateDir))
+	require.True(t, os.IsNotExist(err))
+	info, err := os.Stat(runner.bootstrapDir)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+
+	archive, err := runner.privateArchive()
+	require.NoError(t, err)
+	entries := readPrivateArchive(t, archive)
+	require.Equal(t, []string{"private/", "private/exec.env"}, sortedEntryNames(entries))
+	env := entries["private/exec.env"]
+	require.Equal(t, "INSIDE_TOKEN=super-secret\x00MULTILINE=line1\nline2\x00EXEC_SECRET=exec-value\x00", env.data)
+}
+
+type privateEntry struct {
+	header *tar.Header
+	data   string
+}
+
+// readPrivateArchive unpacks a privateArchive and checks that every entry is
+// root-owned and private.
+func readPrivateArchive(t *testing.T, archive []byte) map[string]privateEntry {
+	t.Helper()
+	entries := map[string]privateEntry{}
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		require.Zero(t, hdr.Uid, hdr.Name)
+		require.Zero(t, hdr.Gid, hdr.Name)
+		if hdr.Typeflag == tar.TypeDir {
+			require.Equal(t, int64(0o700), hdr.Mode, hdr.Name)
+		} else {
+			require.Equal(t, int64(0o600), hdr.Mode, hdr.Name)
+		}
+		entries[hdr.Name] = privateEntry{header: hdr, data: string(data)}
+	}
+	return entries
+}
+
+func sortedEntryNames(entries map[string]privateEntry) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPrivateArchiveEmptyWithoutValues(t *testing.T) {
+	runner := &EphemeralRunner{
+		shaiConfig: &configpkg.Config{User: "shai", Workspace: "/src"},
+	}
+	archive, err := runner.privateArchive()
+	require.NoError(t, err)
+	require.Nil(t, archive)
+}
+
 func TestBuildBootstrapArgsMissingEnvFails(t *testing.T) {
 	runner := &EphemeralRunner{
 		shaiConfig: &configpkg.Config{
@@ -87,6 +203,21 @@ func TestBuildBootstrapArgsMissingEnvFails(t *testing.T) {
 	require.Contains(t, err.Error(), "host env \"MISSING\" not set")
 }
 
+func TestBuildStartMarkerMatchesBootstrap(t *testing.T) {
+	runner := &EphemeralRunner{
+		shaiConfig: &configpkg.Config{User: "shai"},
+		image:      "example/image:1",
+	}
+	require.Equal(t, "Shai sandbox started using [example/image:1] as user [shai]. Resource sets: [none]", runner.buildStartMarker())
+
+	runner.resourceNames = []string{"base", "web"}
+	require.Equal(t, "Shai sandbox started using [example/image:1] as user [shai]. Resource sets: [base, web]", runner.buildStartMarker())
+
+	script := string(bootstrap.Script)
+	require.Contains(t, script, `resource_summary="none"`)
+	require.Contains(t, script, `"Shai sandbox started using [$image_desc] as user [$TARGET_USER]. Resource sets: [$resource_summary]"`)
+}
+
 func TestChooseImagePrecedence(t *testing.T) {
 	img, src := chooseImage("base", "cli-override", "apply-override")
 	require.Equal(t, "cli-override", img)
@@ -132,6 +263,30 @@ func TestResourceMountsSkipMissingPaths(t *testing.T) {
 	require.False(t, mounts[0].ReadOnly)
 }
 
+func TestResourceMountsResolveAgainstResourceDir(t *testing.T) {
+	workspace, slot := t.TempDir(), t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(workspace, "tools"), 0o755))
+	writeFiles(t, workspace, map[string]string{"token.txt": "s3cret\n"})
+
+	// A pooled sandbox runs in an empty slot but keeps the template's
+	// workspace for relative resource paths.
+	runner := &EphemeralRunner{
+		config: EphemeralConfig{WorkingDir: slot, resourceDir: workspace},
+		resources: []*configpkg.ResolvedResource{{
+			Name: "set",
+			Spec: &configpkg.ResourceSet{Mounts: []configpkg.Mount{{Source: "./tools", Target: "/opt/tools"}}},
+		}},
+	}
+	mounts, err := runner.resourceMounts()
+	require.NoError(t, err)
+	require.Len(t, mounts, 1)
+	require.Equal(t, filepath.Join(workspace, "tools"), mounts[0].Source)
+
+	value, err := runner.readSecretFile("token.txt")
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", value)
+}
+
 func TestEffectiveWorkspaceSinglePath(t *testing.T) {
 	require.Equal(t, "/src/cmd", effectiveWorkspace("/src", []string{"cmd"}))
 	require.Equal(t, "/src", effectiveWorkspace("/src", []string{"."}))
@@ -149,7 +304,7 @@ func TestEffectiveWorkspaceWithDotPrefix(t *testing.T) {
 
 func TestBuildDockerConfigsInjectsHostIDs(t *testing.T) {
 	tDir := t.TempDir()
-	mountBuilder, err := NewMountBuilder(tDir, nil)
+	mountBuilder, err := NewMountBuilder(tDir, "", nil)
 	require.NoError(t, err)
 
 	runner := &EphemeralRunner{
@@ -172,3 +327,105 @@ func TestBuildDockerConfigsInjectsHostIDs(t *testing.T) {
 	require.Contains(t, cfg.Env, "DEV_UID=1234")
 	require.Contains(t, cfg.Env, "DEV_GID=5678")
 }
+
+func TestHostPortRelaysPassedToBootstrap(t *testing.T) {
+	resources := []*configpkg.ResolvedResource{
+		{
+			Name: "db",
+			Spec: &configpkg.ResourceSet{
+				HostPorts: []configpkg.HostPort{
+					{Port: 5432},
+					{Port: 8080, Target: 3000},
+				},
+			},
+		},
+		{
+			Name: "dup",
+			Spec: &configpkg.ResourceSet{
+				HostPorts: []configpkg.HostPort{{Port: 5432}},
+			},
+		},
+	}
+	relays, err := startHostPortRelays(resources, "127.0.0.1:0")
+	require.NoError(t, err)
+	require.Len(t, relays, 2)
+
+	runner := &EphemeralRunner{
+		shaiConfig:     &configpkg.Config{User: "shai", Workspace: "/src"},
+		resources:      resources,
+		hostEnv:        map[string]string{},
+		hostPortRelays: relays,
+	}
+	defer runner.Close()
+
+	args, err := runner.buildBootstrapArgs()
+	require.NoError(t, err)
+	require.Contains(t, args, fmt.Sprintf("3000:%d", relays[0].relay.Port()))
+	require.Contains(t, args, fmt.Sprintf("5432:%d", relays[1].relay.Port()))
+	require.Equal(t, "127.0.0.1:8080", relays[0].relay.Target())
+}
+
+func TestStartHostPortRelaysRefusesWildcardBind(t *testing.T) {
+	resources := []*configpkg.ResolvedResource{{
+		Name: "db",
+		Spec: &configpkg.ResourceSet{HostPorts: []configpkg.HostPort{{Port: 5432}}},
+	}}
+	// getMCPServerBindAddr falls back to this when the bridge IP is unknown.
+	_, err := startHostPortRelays(resources, "0.0.0.0:0")
+	require.ErrorContains(t, err, "resource db requests host-ports")
+
+	relays, err := startHostPortRelays([]*configpkg.ResolvedResource{{Name: "plain", Spec: &configpkg.ResourceSet{}}}, "0.0.0.0:0")
+	require.NoError(t, err)
+	require.Empty(t, relays)
+}
+
+func TestSSHAgentProxyMountedIntoSandbox(t *testing.T) {
+	none, err := startSSHAgentProxy([]*configpkg.ResolvedResource{{Name: "plain", Spec: &configpkg.ResourceSet{}}}, map[string]string{})
+	require.NoError(t, err)
+	require.Nil(t, none)
+
+	resources := []*configpkg.ResolvedResource{
+		{
+			Name: "git-push",
+			Spec: &configpkg.ResourceSet{
+				SSHAgent: &configpkg.SSHAgent{Keys: []string{"SHA256:abc"}},
+			},
+		},
+	}
+	_, err = startSSHAgentProxy(resources, map[string]string{})
+	require.ErrorContains(t, err, "SSH_AUTH_SOCK")
+
+	proxy, err := startSSHAgentProxy(resources, map[string]string{"SSH_AUTH_SOCK": "/nonexistent/agent.sock"})
+	require.NoError(t, err)
+	require.NotNil(t, proxy)
+
+	tDir := t.TempDir()
+	mountBuilder, err := NewMountBuilder(tDir, "", nil)
+	require.NoError(t, err)
+	runner := &EphemeralRunner{
+		config:       EphemeralConfig{WorkingDir: tDir},
+		shaiConfig:   &configpkg.Config{User: "shai", Workspace: "/src"},
+		mountBuilder: mountBuilder,
+		image:        "example",
+		hostEnv:      map[string]string{},
+		sshAgent:     proxy,
+	}
+	socketDir := proxy.SocketDir()
+
+	cfg, hostCfg, err := runner.buildDockerConfigs(false, "sandbox-test")
+	require.NoError(t, err)
+	require.Contains(t, cfg.Env, "SSH_AUTH_SOCK="+sshAgentSocketPath)
+	var found bool
+	for _, m := range hostCfg.Mounts {
+		if m.Target == sshAgentMountDir {
+			found = true
+			require.Equal(t, socketDir, m.Source)
+		}
+		require.NotContains(t, m.Source, ".ssh")
+	}
+	require.True(t, found, "ssh-agent socket dir should be mounted")
+
+	require.NoError(t, runner.Close())
+	_, err = os.Stat(socketDir)
+	require.True(t, os.IsNotExist(err))
+}
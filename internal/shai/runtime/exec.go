@@ -0,0 +1,201 @@
+package shai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/moby/term"
+)
+
+// execHelperPath is where bootstrap installs the exec helper. It runs as
+// root, loads the environment bootstrap saved and drops to the sandbox user.
+const execHelperPath = "/run/shai/exec"
+
+// execStatePath is the environment bootstrap saves for the exec helper once
+// the sandbox is ready.
+const execStatePath = "/run/shai/exec-env.sh"
+
+// execHelperPrefix starts the line the exec helper prints to stderr before
+// it exits with ExitCodeSetup, which tells its own failures apart from a
+// command that exits 125.
+const execHelperPrefix = "shai-exec: "
+
+var execEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Exec runs spec in the session's container as the sandbox user. A non-zero
+// exit status is returned as an *ExitError in the command phase, unless the
+// exec helper failed before the command started.
+func (s *Session) Exec(ctx context.Context, spec ExecSpec) error {
+	if s == nil || s.ContainerID == "" {
+		return errors.New("session has no container")
+	}
+	return asSetupError(execInContainer(ctx, s.docker, s.ContainerID, spec))
+}
+
+// ExecSession runs spec as the sandbox user in the running sandbox called
+// name. An empty command starts the user's login shell.
+func ExecSession(ctx context.Context, name string, spec ExecSpec) error {
+	docker, err := newDockerClient()
+	if err != nil {
+		return asSetupError(err)
+	}
+	defer docker.Close()
+	info, err := findSession(ctx, docker, name)
+	if err != nil {
+		return asSetupError(err)
+	}
+	return asSetupError(execInContainer(ctx, docker, info.ID, spec))
+}
+
+// execCommand builds the helper invocation for spec. Env values travel in
+// the exec environment; only their names appear on the command line.
+func execCommand(spec ExecSpec) ([]string, []string, error) {
+	cmd := []string{execHelperPath}
+	if spec.Workdir != "" {
+		cmd = append(cmd, "--workdir", spec.Workdir)
+	}
+	names := make([]string, 0, len(spec.Env))
+	for name := range spec.Env {
+		if !execEnvName.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid environment variable name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	env := make([]string, 0, len(names))
+	for _, name := range names {
+		cmd = append(cmd, "--env", name)
+		env = append(env, name+"="+spec.Env[name])
+	}
+	cmd = append(cmd, "--")
+	cmd = append(cmd, spec.Command...)
+	return cmd, env, nil
+}
+
+func execInContainer(ctx context.Context, docker *client.Client, containerID string, spec ExecSpec) error {
+	cmd, env, err := execCommand(spec)
+	if err != nil {
+		return err
+	}
+	created, err := docker.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		User:         "root",
+		Tty:          spec.UseTTY,
+		AttachStdin:  spec.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          env,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return fmt.Errorf("create exec: %w", err)
+	}
+	hijacked, err := docker.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{Tty: spec.UseTTY})
+	if err != nil {
+		return fmt.Errorf("attach exec: %w", err)
+	}
+	defer hijacked.Close()
+
+	stdout, stderr := spec.Stdout, spec.Stderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	// A TTY exec merges stderr into stdout.
+	helper := &lastLineWriter{}
+	if spec.UseTTY {
+		stdout = io.MultiWriter(stdout, helper)
+	} else {
+		stderr = io.MultiWriter(stderr, helper)
+	}
+
+	if spec.UseTTY && spec.Stdin == os.Stdin {
+		stdinFD := os.Stdin.Fd()
+		if term.IsTerminal(stdinFD) {
+			if st, err := term.MakeRaw(stdinFD); err == nil {
+				defer term.RestoreTerminal(stdinFD, st)
+			}
+			resize := func(opts container.ResizeOptions) error {
+				return docker.ContainerExecResize(context.Background(), created.ID, opts)
+			}
+			if stop := startTTYResizeWatcher(ctx, stdinFD, resize); stop != nil {
+				defer stop()
+			}
+		}
+	}
+
+	if spec.Stdin != nil {
+		go func() {
+			_, _ = io.Copy(hijacked.Conn, spec.Stdin)
+			_ = hijacked.CloseWrite()
+		}()
+	}
+	if spec.UseTTY {
+		_, err = io.Copy(stdout, hijacked.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, hijacked.Reader)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	result, err := docker.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return fmt.Errorf("inspect exec: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return execExitError(result.ExitCode, helper.line())
+	}
+	return nil
+}
+
+// execExitError classifies a non-zero exec status given the last line of
+// its stderr. The exec helper's own failures are setup errors; every other
+// status is the command's.
+func execExitError(status int, lastLine string) *ExitError {
+	if status == ExitCodeSetup {
+		if msg, ok := strings.CutPrefix(lastLine, execHelperPrefix); ok {
+			return &ExitError{Code: ExitCodeSetup, Phase: ExitPhaseSetup, Err: fmt.Errorf("exec: %s", msg)}
+		}
+	}
+	return &ExitError{Code: status, Phase: ExitPhaseCommand}
+}
+
+// lastLineWriter remembers the last complete line written to it.
+type lastLineWriter struct {
+	last []byte
+	cur  []byte
+}
+
+// maxLastLine bounds the bytes lastLineWriter keeps of a single line.
+const maxLastLine = 4096
+
+func (w *lastLineWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		switch b {
+		case '\n':
+			w.last = append(w.last[:0], w.cur...)
+			w.cur = w.cur[:0]
+		case '\r':
+		default:
+			if len(w.cur) < maxLastLine {
+				w.cur = append(w.cur, b)
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (w *lastLineWriter) line() string {
+	return string(w.last)
+}
@@ -0,0 +1,83 @@
+package shai
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/colony-2/shai/internal/shai/runtime/bootstrap"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecCommand(t *testing.T) {
+	cmd, env, err := execCommand(ExecSpec{
+		Command: []string{"go", "test", "./..."},
+		Env:     map[string]string{"GOFLAGS": "-count=1", "CI": "1"},
+		Workdir: "/src/pkg",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		execHelperPath, "--workdir", "/src/pkg",
+		"--env", "CI", "--env", "GOFLAGS",
+		"--", "go", "test", "./...",
+	}, cmd)
+	assert.Equal(t, []string{"CI=1", "GOFLAGS=-count=1"}, env)
+
+	cmd, env, err = execCommand(ExecSpec{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{execHelperPath, "--"}, cmd)
+	assert.Empty(t, env)
+
+	_, _, err = execCommand(ExecSpec{Env: map[string]string{"BAD-NAME": "x"}})
+	assert.ErrorContains(t, err, "BAD-NAME")
+}
+
+func TestExecExitErrorSeparatesHelperFailures(t *testing.T) {
+	err := execExitError(ExitCodeSetup, "shai-exec: sandbox is still starting; try again shortly")
+	assert.Equal(t, ExitPhaseSetup, err.Phase)
+	assert.Equal(t, ExitCodeSetup, err.Code)
+	assert.EqualError(t, err, "exec: sandbox is still starting; try again shortly")
+
+	err = execExitError(ExitCodeSetup, "docker: invalid reference format")
+	assert.Equal(t, ExitPhaseCommand, err.Phase)
+	assert.Equal(t, ExitCodeSetup, err.Code)
+
+	err = execExitError(1, "shai-exec: not from the helper")
+	assert.Equal(t, ExitPhaseCommand, err.Phase)
+	assert.Equal(t, 1, err.Code)
+}
+
+func TestLastLineWriter(t *testing.T) {
+	w := &lastLineWriter{}
+	_, _ = w.Write([]byte("first\r\nshai-exec: fa"))
+	assert.Equal(t, "first", w.line())
+	_, _ = w.Write([]byte("iled\n"))
+	assert.Equal(t, "shai-exec: failed", w.line())
+}
+
+func TestExecHelperFailsAsSetup(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	script := filepath.Join(t.TempDir(), "exec")
+	require.NoError(t, os.WriteFile(script, bootstrap.ExecScript, 0o755))
+
+	cmd := exec.Command("bash", script, "--", "true")
+	cmd.Env = append(os.Environ(), "SHAI_RUN_DIR="+t.TempDir())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr), "expected exit error, got %v", err)
+
+	w := &lastLineWriter{}
+	_, _ = w.Write(stderr.Bytes())
+	got := execExitError(exitErr.ExitCode(), w.line())
+	assert.Equal(t, ExitPhaseSetup, got.Phase)
+	assert.EqualError(t, got, "exec: sandbox is still starting; try again shortly")
+}
@@ -0,0 +1,87 @@
+package shai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Exit codes reserved for failures outside the sandboxed command. Every other
+// code is the command's own status.
+const (
+	// ExitCodeBootstrap is used when the sandbox fails before the command
+	// starts; bootstrap exits with the same code.
+	ExitCodeBootstrap = 90
+	// ExitCodeSetup is used when shai cannot prepare or run the sandbox, for
+	// example an invalid config or an unreachable Docker daemon. It matches
+	// docker run.
+	ExitCodeSetup = 125
+)
+
+// ExitPhase names the stage of a session that produced an ExitError.
+type ExitPhase string
+
+const (
+	ExitPhaseSetup     ExitPhase = "setup"
+	ExitPhaseBootstrap ExitPhase = "bootstrap"
+	ExitPhaseCommand   ExitPhase = "command"
+)
+
+// ExitError reports a session that ended unsuccessfully. Code is the exit
+// status the shai CLI uses: the command's own status in the command phase and
+// ExitCodeBootstrap or ExitCodeSetup otherwise.
+type ExitError struct {
+	Code  int
+	Phase ExitPhase
+	// Err is the underlying failure, if any.
+	Err error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	switch e.Phase {
+	case ExitPhaseCommand:
+		return fmt.Sprintf("command exited with status %d", e.Code)
+	case ExitPhaseBootstrap:
+		return fmt.Sprintf("sandbox bootstrap failed with status %d", e.Code)
+	}
+	return fmt.Sprintf("sandbox setup failed with status %d", e.Code)
+}
+
+// ExitCode returns Code.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// asSetupError marks err as a setup failure unless it already carries an
+// exit code or reports cancellation.
+func asSetupError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	var coded interface{ ExitCode() int }
+	if errors.As(err, &coded) {
+		return err
+	}
+	return &ExitError{Code: ExitCodeSetup, Phase: ExitPhaseSetup, Err: err}
+}
+
+// containerExitError classifies a non-zero container status. Bootstrap prints
+// the start marker right before it execs the command, so a status seen before
+// the marker belongs to bootstrap.
+func containerExitError(status int64, commandStarted bool) *ExitError {
+	if !commandStarted {
+		return &ExitError{
+			Code:  ExitCodeBootstrap,
+			Phase: ExitPhaseBootstrap,
+			Err:   fmt.Errorf("sandbox bootstrap failed with status %d", status),
+		}
+	}
+	return &ExitError{Code: int(status), Phase: ExitPhaseCommand}
+}
@@ -0,0 +1,43 @@
+package shai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerExitErrorPhases(t *testing.T) {
+	err := containerExitError(3, true)
+	assert.Equal(t, ExitPhaseCommand, err.Phase)
+	assert.Equal(t, 3, err.ExitCode())
+	assert.Equal(t, "command exited with status 3", err.Error())
+
+	err = containerExitError(1, false)
+	assert.Equal(t, ExitPhaseBootstrap, err.Phase)
+	assert.Equal(t, ExitCodeBootstrap, err.ExitCode())
+	assert.Contains(t, err.Error(), "bootstrap failed with status 1")
+}
+
+func TestAsSetupError(t *testing.T) {
+	assert.NoError(t, asSetupError(nil))
+
+	cause := errors.New("docker unavailable")
+	var exitErr *ExitError
+	require.ErrorAs(t, asSetupError(cause), &exitErr)
+	assert.Equal(t, ExitPhaseSetup, exitErr.Phase)
+	assert.Equal(t, ExitCodeSetup, exitErr.ExitCode())
+	assert.ErrorIs(t, exitErr, cause)
+	assert.Equal(t, "docker unavailable", exitErr.Error())
+
+	coded := fmt.Errorf("run: %w", &ExitError{Code: 2, Phase: ExitPhaseCommand})
+	assert.Same(t, coded, asSetupError(coded))
+	limit := &SessionLimitError{Limit: "max-duration", Duration: time.Hour}
+	assert.Same(t, error(limit), asSetupError(limit))
+	assert.ErrorIs(t, asSetupError(context.Canceled), context.Canceled)
+	assert.NotErrorAs(t, asSetupError(context.Canceled), &exitErr)
+}
@@ -0,0 +1,88 @@
+package shai
+
+import (
+	_ "embed"
+	"os"
+	"strings"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+)
+
+// seccompProfile is Docker's default profile (moby v28.3.0,
+// profiles/seccomp/default.json), which denies anything it does not list,
+// tightened further: mount, namespace, kernel-module, clock and tracing
+// syscalls are left off the allowlist even for capabilities that would
+// normally unlock them, and clone never accepts namespace flags. It replaces
+// the daemon's default, so it must stay at least as strict; it is passed
+// inline.
+//
+//go:embed seccomp.json
+var seccompProfile []byte
+
+// hardenedDropCaps are removed from the container's capability set. Bootstrap
+// still needs the remaining defaults (plus NET_ADMIN) for its root setup; the
+// user command then runs with an empty bounding set.
+var hardenedDropCaps = []string{"MKNOD", "NET_RAW", "SYS_CHROOT"}
+
+// hardenedCopyDirs stay writable for bootstrap's user and proxy setup. Each is
+// an anonymous volume, which the daemon seeds with the image's contents and
+// discards with the container.
+var hardenedCopyDirs = []string{"/etc", "/home", "/root"}
+
+// hardenedTmpfsDirs are scratch space on an otherwise read-only rootfs.
+var hardenedTmpfsDirs = []string{"/tmp", "/var/tmp", "/run", "/var/log"}
+
+// hardenedExecDir is the tmpfs bootstrap installs shai's helpers under
+// (shai-remote, git-credential-shai and the exec helper, in /run/shai). The
+// daemon mounts tmpfs noexec unless told otherwise.
+const hardenedExecDir = "/run"
+
+// hardeningEnabled reports whether the hardened profile applies. It is on by
+// default, off for privileged sandboxes, and any active resource set can opt
+// out with options.hardening: off.
+func hardeningEnabled(privileged bool, resources []*configpkg.ResolvedResource) bool {
+	if privileged {
+		return false
+	}
+	for _, res := range resources {
+		if res.Spec != nil && strings.EqualFold(strings.TrimSpace(res.Spec.Options.Hardening), "off") {
+			return false
+		}
+	}
+	return true
+}
+
+// applyHardening makes the rootfs read-only and tightens the container's
+// security options.
+func applyHardening(hostCfg *container.HostConfig) {
+	hostCfg.ReadonlyRootfs = true
+	hostCfg.CapDrop = append(hostCfg.CapDrop, hardenedDropCaps...)
+	hostCfg.SecurityOpt = append(hostCfg.SecurityOpt,
+		"no-new-privileges:true",
+		"seccomp="+string(seccompProfile),
+	)
+	for _, dir := range hardenedCopyDirs {
+		hostCfg.Mounts = append(hostCfg.Mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Target: dir,
+		})
+	}
+	for _, dir := range hardenedTmpfsDirs {
+		mode := os.FileMode(0o755)
+		if dir == "/tmp" || dir == "/var/tmp" {
+			// The daemon formats the mode numerically, so this is 1777.
+			mode = 0o1777
+		}
+		opts := &mount.TmpfsOptions{Mode: mode}
+		if dir == hardenedExecDir {
+			opts.Options = [][]string{{"exec"}}
+		}
+		hostCfg.Mounts = append(hostCfg.Mounts, mount.Mount{
+			Type:         mount.TypeTmpfs,
+			Target:       dir,
+			TmpfsOptions: opts,
+		})
+	}
+}
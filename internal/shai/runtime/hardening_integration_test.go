@@ -0,0 +1,38 @@
+//go:build integration
+// +build integration
+
+package shai_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHardenedSandboxBlocksUserNamespaces(t *testing.T) {
+	workspace := setupAliasWorkspace(t)
+	build := exec.Command("go", "build", "-o", filepath.Join(workspace, "nsprobe"), "./testdata/nsprobe")
+	build.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+runtime.GOARCH, "CGO_ENABLED=0")
+	out, err := build.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	cmd := `
+if unshare -U true 2>/dev/null; then echo "UNSHARE_NEWUSER:allowed"; else echo "UNSHARE_NEWUSER:denied"; fi
+/src/nsprobe
+`
+	lines, err := runInSandbox(t, workspace, cmd)
+	require.NoError(t, err, "logs: %v", lines)
+	// shai-base ships util-linux, which bootstrap needs for setpriv.
+	assertContainsSubstring(t, lines, "UNSHARE_NEWUSER:denied")
+	assertContainsSubstring(t, lines, "CLONE_NEWUSER:denied")
+	for _, line := range lines {
+		require.NotContains(t, line, ":allowed", "hardened sandbox allowed a user namespace: %v", lines)
+	}
+	// wait second or container rm will fail due to macos conccurrency issues with virtiofs
+	time.Sleep(1 * time.Second)
+}
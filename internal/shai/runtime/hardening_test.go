@@ -0,0 +1,87 @@
+package shai
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildDockerConfigsHardenedByDefault(t *testing.T) {
+	tDir := t.TempDir()
+	mountBuilder, err := NewMountBuilder(tDir, "", nil)
+	require.NoError(t, err)
+	runner := &EphemeralRunner{
+		config:       EphemeralConfig{WorkingDir: tDir},
+		shaiConfig:   &configpkg.Config{User: "shai", Workspace: "/src"},
+		resources:    []*configpkg.ResolvedResource{{Name: "base", Spec: &configpkg.ResourceSet{}}},
+		mountBuilder: mountBuilder,
+		image:        "example",
+		hostEnv:      map[string]string{},
+	}
+
+	cfg, hostCfg, err := runner.buildDockerConfigs(false, "sandbox-test")
+	require.NoError(t, err)
+	require.True(t, hostCfg.ReadonlyRootfs)
+	require.Contains(t, hostCfg.SecurityOpt, "no-new-privileges:true")
+	var seccomp bool
+	for _, opt := range hostCfg.SecurityOpt {
+		seccomp = seccomp || strings.HasPrefix(opt, "seccomp={")
+	}
+	require.True(t, seccomp, "bundled seccomp profile should be passed inline")
+	targets := map[string]mount.Type{}
+	for _, m := range hostCfg.Mounts {
+		targets[m.Target] = m.Type
+		if m.Target == "/run" {
+			require.Equal(t, [][]string{{"exec"}}, m.TmpfsOptions.Options, "helpers under /run/shai must be executable")
+		}
+	}
+	require.Equal(t, mount.TypeTmpfs, targets["/run"])
+	require.Equal(t, mount.TypeTmpfs, targets["/tmp"])
+	require.Equal(t, mount.TypeVolume, targets["/home"])
+	require.Equal(t, mount.TypeVolume, targets["/etc"])
+	require.Contains(t, cfg.Cmd, "--hardened")
+
+	runner.resources[0].Spec.Options.Hardening = "off"
+	cfg, hostCfg, err = runner.buildDockerConfigs(false, "sandbox-test")
+	require.NoError(t, err)
+	require.False(t, hostCfg.ReadonlyRootfs)
+	require.Empty(t, hostCfg.SecurityOpt)
+	require.NotContains(t, cfg.Cmd, "--hardened")
+
+	runner.resources[0].Spec.Options = configpkg.ResourceOptions{Privileged: true}
+	_, hostCfg, err = runner.buildDockerConfigs(false, "sandbox-test")
+	require.NoError(t, err)
+	require.False(t, hostCfg.ReadonlyRootfs, "privileged sandboxes are not hardened")
+}
+
+func TestSeccompProfileDeniesByDefault(t *testing.T) {
+	var profile struct {
+		DefaultAction string `json:"defaultAction"`
+		Syscalls      []struct {
+			Names  []string `json:"names"`
+			Action string   `json:"action"`
+			Args   []struct {
+				Op string `json:"op"`
+			} `json:"args"`
+		} `json:"syscalls"`
+	}
+	require.NoError(t, json.Unmarshal(seccompProfile, &profile))
+	require.Equal(t, "SCMP_ACT_ERRNO", profile.DefaultAction)
+
+	denied := []string{"unshare", "setns", "mount", "umount2", "pivot_root", "clone3", "keyctl", "bpf", "init_module", "io_uring_setup"}
+	for _, rule := range profile.Syscalls {
+		if rule.Action != "SCMP_ACT_ALLOW" {
+			continue
+		}
+		for _, name := range rule.Names {
+			require.NotContains(t, denied, name)
+			if name == "clone" || name == "personality" {
+				require.NotEmpty(t, rule.Args, "%s must only be allowed with argument filters", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package hostports
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dialTimeout = 5 * time.Second
+
+// Relay accepts connections from the sandbox and forwards them to a port on
+// the host's loopback interface.
+type Relay struct {
+	listener net.Listener
+	target   string
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Start binds a relay on bindAddr (typically "<gateway>:0") that forwards to
+// 127.0.0.1:hostPort. The relay does not authenticate its peers, so it
+// refuses to listen on every interface: that would expose a loopback-only
+// service to the network.
+func Start(bindAddr string, hostPort int) (*Relay, error) {
+	if hostPort < 1 || hostPort > 65535 {
+		return nil, fmt.Errorf("invalid host port %d", hostPort)
+	}
+	bindAddr = strings.TrimSpace(bindAddr)
+	if bindAddr == "" {
+		bindAddr = "127.0.0.1:0"
+	}
+	host, _, err := net.SplitHostPort(bindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bind address %q: %w", bindAddr, err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		return nil, fmt.Errorf("refusing to relay host port %d on all interfaces (%s)", hostPort, bindAddr)
+	}
+	ln, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", bindAddr, err)
+	}
+	r := &Relay{
+		listener: ln,
+		target:   net.JoinHostPort("127.0.0.1", strconv.Itoa(hostPort)),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	r.wg.Add(1)
+	go r.acceptLoop()
+	return r, nil
+}
+
+// Port returns the TCP port the relay listens on.
+func (r *Relay) Port() int {
+	if addr, ok := r.listener.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
+
+// Target returns the host address connections are forwarded to.
+func (r *Relay) Target() string {
+	return r.target
+}
+
+// Close stops accepting connections and tears down active ones.
+func (r *Relay) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	for c := range r.conns {
+		_ = c.Close()
+	}
+	r.mu.Unlock()
+
+	err := r.listener.Close()
+	r.wg.Wait()
+	return err
+}
+
+func (r *Relay) acceptLoop() {
+	defer r.wg.Done()
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		if !r.track(conn) {
+			_ = conn.Close()
+			return
+		}
+		r.wg.Add(1)
+		go r.forward(conn)
+	}
+}
+
+func (r *Relay) forward(src net.Conn) {
+	defer r.wg.Done()
+	defer r.untrack(src)
+
+	dst, err := net.DialTimeout("tcp", r.target, dialTimeout)
+	if err != nil {
+		return
+	}
+	if !r.track(dst) {
+		_ = dst.Close()
+		return
+	}
+	defer r.untrack(dst)
+
+	done := make(chan struct{}, 2)
+	pipe := func(to, from net.Conn) {
+		_, _ = io.Copy(to, from)
+		if tcp, ok := to.(*net.TCPConn); ok {
+			_ = tcp.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go pipe(dst, src)
+	go pipe(src, dst)
+	<-done
+	<-done
+}
+
+func (r *Relay) track(c net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.conns[c] = struct{}{}
+	return true
+}
+
+func (r *Relay) untrack(c net.Conn) {
+	r.mu.Lock()
+	delete(r.conns, c)
+	r.mu.Unlock()
+	_ = c.Close()
+}
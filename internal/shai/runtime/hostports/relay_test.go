@@ -0,0 +1,107 @@
+package hostports
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func startEchoServer(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				line, err := bufio.NewReader(c).ReadString('\n')
+				if err != nil {
+					return
+				}
+				_, _ = c.Write([]byte("echo:" + line))
+			}(conn)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestRelayForwardsToHostPort(t *testing.T) {
+	port := startEchoServer(t)
+
+	relay, err := Start("127.0.0.1:0", port)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer relay.Close()
+
+	if relay.Port() == 0 {
+		t.Fatalf("expected relay to report a port")
+	}
+	if relay.Target() != "127.0.0.1:"+strconv.Itoa(port) {
+		t.Fatalf("unexpected target %q", relay.Target())
+	}
+
+	conn, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(relay.Port()), time.Second)
+	if err != nil {
+		t.Fatalf("dial relay: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got != "echo:ping\n" {
+		t.Fatalf("unexpected response %q", got)
+	}
+}
+
+func TestRelayRejectsInvalidPort(t *testing.T) {
+	if _, err := Start("127.0.0.1:0", 0); err == nil {
+		t.Fatalf("expected error for port 0")
+	}
+	if _, err := Start("127.0.0.1:0", 70000); err == nil {
+		t.Fatalf("expected error for port 70000")
+	}
+}
+
+func TestRelayCloseStopsListener(t *testing.T) {
+	port := startEchoServer(t)
+	relay, err := Start("127.0.0.1:0", port)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	addr := "127.0.0.1:" + strconv.Itoa(relay.Port())
+	if err := relay.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if conn, err := net.DialTimeout("tcp", addr, 200*time.Millisecond); err == nil {
+		conn.Close()
+		t.Fatalf("expected relay listener to be closed")
+	}
+	if err := relay.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestStartRefusesAllInterfaces(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", "[::]:0", ":0"} {
+		if relay, err := Start(addr, 5432); err == nil {
+			_ = relay.Close()
+			t.Fatalf("Start(%q) listened on all interfaces", addr)
+		}
+	}
+}
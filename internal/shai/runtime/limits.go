@@ -0,0 +1,135 @@
+package shai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+)
+
+// collectLimits merges the config's top-level limits, the limits of every
+// active resource set and the caller's overrides; the most restrictive value
+// of each field wins.
+func collectLimits(shaiCfg *configpkg.Config, resources []*configpkg.ResolvedResource, cfg EphemeralConfig) (configpkg.ResolvedLimits, error) {
+	merged, err := shaiCfg.Limits.Resolve()
+	if err != nil {
+		return merged, fmt.Errorf("limits: %w", err)
+	}
+	for _, res := range resources {
+		if res == nil || res.Spec == nil {
+			continue
+		}
+		l, err := res.Spec.Limits.Resolve()
+		if err != nil {
+			return merged, fmt.Errorf("resource %s limits: %w", res.Name, err)
+		}
+		merged = merged.Merge(l)
+	}
+	override, err := configpkg.Limits{CPUs: cfg.CPUs, Memory: cfg.Memory}.Resolve()
+	if err != nil {
+		return merged, err
+	}
+	if cfg.MaxDuration < 0 || cfg.IdleTimeout < 0 {
+		return merged, errors.New("max-duration and idle-timeout must be positive")
+	}
+	override.MaxDuration = cfg.MaxDuration
+	override.IdleTimeout = cfg.IdleTimeout
+	return merged.Merge(override), nil
+}
+
+// applyLimits sets the container's resource limits. Tmpfs mounts created by
+// shai without an explicit size get the tmpfs limit.
+func applyLimits(hostCfg *container.HostConfig, limits configpkg.ResolvedLimits) {
+	hostCfg.NanoCPUs = limits.NanoCPUs
+	hostCfg.Memory = limits.Memory
+	hostCfg.MemorySwap = limits.MemorySwap
+	if limits.Pids > 0 {
+		pids := limits.Pids
+		hostCfg.PidsLimit = &pids
+	}
+	if limits.Storage > 0 {
+		hostCfg.StorageOpt = map[string]string{"size": fmt.Sprintf("%d", limits.Storage)}
+	}
+	if limits.Tmpfs > 0 {
+		for i := range hostCfg.Mounts {
+			m := &hostCfg.Mounts[i]
+			if m.Type != mount.TypeTmpfs {
+				continue
+			}
+			if m.TmpfsOptions == nil {
+				m.TmpfsOptions = &mount.TmpfsOptions{}
+			}
+			if m.TmpfsOptions.SizeBytes == 0 {
+				m.TmpfsOptions.SizeBytes = limits.Tmpfs
+			}
+		}
+	}
+}
+
+// storageOptUnsupported reports whether container creation failed because the
+// storage driver cannot enforce a size limit.
+func storageOptUnsupported(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "storage-opt") || strings.Contains(msg, "storage opt")
+}
+
+// watchOOM returns a channel that is closed if the daemon reports an OOM kill
+// for the container. The subscription ends when ctx is cancelled.
+func watchOOM(ctx context.Context, docker *client.Client, containerID string) <-chan struct{} {
+	oom := make(chan struct{})
+	msgs, errs := docker.Events(ctx, events.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("container", containerID),
+			filters.Arg("event", string(events.ActionOOM)),
+		),
+	})
+	go func() {
+		select {
+		case _, ok := <-msgs:
+			if ok {
+				close(oom)
+			}
+		case <-errs:
+		case <-ctx.Done():
+		}
+	}()
+	return oom
+}
+
+// oomKilled reports whether a container that exited with status was killed
+// for exceeding its memory. The event can trail the exit, so a SIGKILL exit
+// waits briefly for it.
+func oomKilled(oom <-chan struct{}, status int64) bool {
+	select {
+	case <-oom:
+		return true
+	default:
+	}
+	if status != 137 {
+		return false
+	}
+	select {
+	case <-oom:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+// oomError describes an OOM kill, including the memory limit when one was set.
+func oomError(limits configpkg.ResolvedLimits) error {
+	if limits.Memory > 0 {
+		return fmt.Errorf("sandbox was killed after running out of memory (limit %s)", units.BytesSize(float64(limits.Memory)))
+	}
+	return errors.New("sandbox was killed after running out of memory")
+}
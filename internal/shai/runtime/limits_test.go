@@ -0,0 +1,48 @@
+package shai
+
+import (
+	"testing"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectLimitsMostRestrictiveWins(t *testing.T) {
+	shaiCfg := &configpkg.Config{Limits: configpkg.Limits{Memory: "8g", Pids: 512}}
+	resources := []*configpkg.ResolvedResource{
+		{Name: "build", Spec: &configpkg.ResourceSet{Limits: configpkg.Limits{CPUs: 4, Memory: "16g"}}},
+		{Name: "tests", Spec: &configpkg.ResourceSet{Limits: configpkg.Limits{Pids: 128}}},
+	}
+	limits, err := collectLimits(shaiCfg, resources, EphemeralConfig{CPUs: 2})
+	require.NoError(t, err)
+	require.Equal(t, configpkg.ResolvedLimits{NanoCPUs: 2e9, Memory: 8 << 30, Pids: 128}, limits)
+
+	_, err = collectLimits(shaiCfg, resources, EphemeralConfig{Memory: "huge"})
+	require.ErrorContains(t, err, "memory has invalid size")
+}
+
+func TestApplyLimits(t *testing.T) {
+	hostCfg := &container.HostConfig{Mounts: []mount.Mount{
+		{Type: mount.TypeTmpfs, Target: "/tmp"},
+		{Type: mount.TypeTmpfs, Target: secretsMountDir, TmpfsOptions: &mount.TmpfsOptions{SizeBytes: 1 << 20}},
+		{Type: mount.TypeBind, Source: "/src", Target: "/src"},
+	}}
+	applyLimits(hostCfg, configpkg.ResolvedLimits{NanoCPUs: 1e9, Memory: 1 << 30, Pids: 64, Tmpfs: 32 << 20, Storage: 5 << 30})
+	require.EqualValues(t, 1e9, hostCfg.NanoCPUs)
+	require.EqualValues(t, 1<<30, hostCfg.Memory)
+	require.EqualValues(t, 64, *hostCfg.PidsLimit)
+	require.Equal(t, map[string]string{"size": "5368709120"}, hostCfg.StorageOpt)
+	require.EqualValues(t, 32<<20, hostCfg.Mounts[0].TmpfsOptions.SizeBytes)
+	require.EqualValues(t, 1<<20, hostCfg.Mounts[1].TmpfsOptions.SizeBytes)
+	require.Nil(t, hostCfg.Mounts[2].TmpfsOptions)
+}
+
+func TestOOMError(t *testing.T) {
+	require.EqualError(t, oomError(configpkg.ResolvedLimits{Memory: 2 << 30}), "sandbox was killed after running out of memory (limit 2GiB)")
+	oom := make(chan struct{})
+	close(oom)
+	require.True(t, oomKilled(oom, 137))
+	require.False(t, oomKilled(make(chan struct{}), 1))
+}
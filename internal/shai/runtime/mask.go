@@ -0,0 +1,270 @@
+package shai
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/docker/docker/api/types/mount"
+)
+
+// defaultMaskPatterns hide common secret files from the workspace mount. A
+// config can drop one with a "!pattern" entry.
+var defaultMaskPatterns = []string{".env*", "*.pem", ".git-credentials", ".netrc"}
+
+// maxMaskedPaths bounds the number of mask mounts; each match costs a mount.
+// Past it, the directories holding the most matches are masked whole.
+const maxMaskedPaths = 512
+
+// maskSkipDirs are not searched for masked paths. .git is handled separately
+// by sanitizing its config.
+var maskSkipDirs = map[string]bool{".git": true, "node_modules": true}
+
+// maskPatterns returns the default patterns plus those from the config and
+// the active resource sets, minus any "!pattern" exclusions.
+func maskPatterns(shaiCfg *configpkg.Config, resources []*configpkg.ResolvedResource) []string {
+	var entries []string
+	entries = append(entries, defaultMaskPatterns...)
+	if shaiCfg != nil {
+		entries = append(entries, shaiCfg.Mask...)
+	}
+	for _, res := range resources {
+		if res != nil && res.Spec != nil {
+			entries = append(entries, res.Spec.Mask...)
+		}
+	}
+	excluded := map[string]bool{}
+	for _, e := range entries {
+		if e = strings.TrimSpace(e); strings.HasPrefix(e, "!") {
+			excluded[strings.TrimSpace(e[1:])] = true
+		}
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" || strings.HasPrefix(e, "!") || excluded[e] || seen[e] {
+			continue
+		}
+		seen[e] = true
+		out = append(out, e)
+	}
+	return out
+}
+
+// maskMatches reports whether the workspace-relative slash path rel matches
+// pattern. Patterns without a slash match a base name at any depth; patterns
+// with one (including a leading slash) are anchored at the workspace root. A
+// trailing slash matches directories only.
+func maskMatches(pattern, rel string, isDir bool) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if dirOnly && !isDir {
+		return false
+	}
+	name := rel
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(rel)
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// findMaskedPaths walks root and returns workspace-relative paths matching
+// patterns. Matched directories are not descended into. When there are more
+// than maxMaskedPaths matches, collapsed lists the directories that are
+// masked whole in place of the matches inside them.
+func findMaskedPaths(root string, patterns []string) (files, dirs, collapsed []string, err error) {
+	if len(patterns) == 0 {
+		return nil, nil, nil, nil
+	}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if p == root {
+				return walkErr
+			}
+			// Unreadable entries are not visible in the sandbox either.
+			return nil
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() && maskSkipDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		for _, pattern := range patterns {
+			if !maskMatches(pattern, rel, d.IsDir()) {
+				continue
+			}
+			if d.IsDir() {
+				dirs = append(dirs, rel)
+				return filepath.SkipDir
+			}
+			files = append(files, rel)
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("scan workspace for masked paths: %w", err)
+	}
+	for len(files)+len(dirs) > maxMaskedPaths {
+		dir := busiestMaskDir(files, dirs)
+		if dir == "" {
+			return nil, nil, nil, fmt.Errorf("mask patterns matched %d paths at the workspace root (limit %d); narrow the mask list", len(files)+len(dirs), maxMaskedPaths)
+		}
+		files = slices.DeleteFunc(files, func(rel string) bool { return strings.HasPrefix(rel, dir+"/") })
+		dirs = slices.DeleteFunc(dirs, func(rel string) bool { return strings.HasPrefix(rel, dir+"/") })
+		collapsed = slices.DeleteFunc(collapsed, func(rel string) bool { return strings.HasPrefix(rel, dir+"/") })
+		dirs = append(dirs, dir)
+		collapsed = append(collapsed, dir)
+	}
+	slices.Sort(collapsed)
+	return files, dirs, collapsed, nil
+}
+
+// busiestMaskDir returns the directory holding the most masked paths
+// directly, or "" if they all sit at the workspace root.
+func busiestMaskDir(files, dirs []string) string {
+	counts := map[string]int{}
+	for _, rel := range append(slices.Clone(files), dirs...) {
+		if parent := path.Dir(rel); parent != "." {
+			counts[parent]++
+		}
+	}
+	best := ""
+	for dir, n := range counts {
+		if n > counts[best] || (n == counts[best] && dir < best) {
+			best = dir
+		}
+	}
+	return best
+}
+
+// MaskMounts hides workspace paths matching patterns: files are covered by
+// /dev/null and directories by empty read-only tmpfs mounts. When
+// .git/config embeds credentials, a sanitized copy staged in stageDir is
+// mounted over it so git keeps working without exposing them, unless .git is
+// writable (see GitConfigExposed). collapsed lists the directories masked
+// whole because the patterns matched more than maxMaskedPaths paths; callers
+// should tell the user about them.
+func (m *MountBuilder) MaskMounts(patterns []string, stageDir string) (mounts []mount.Mount, collapsed []string, err error) {
+	files, dirs, collapsed, err := findMaskedPaths(m.WorkingDir, patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, rel := range files {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   os.DevNull,
+			Target:   path.Join(m.Target, rel),
+			ReadOnly: true,
+		})
+	}
+	for _, rel := range dirs {
+		mounts = append(mounts, mount.Mount{
+			Type:         mount.TypeTmpfs,
+			Target:       path.Join(m.Target, rel),
+			ReadOnly:     true,
+			TmpfsOptions: &mount.TmpfsOptions{SizeBytes: 1 << 16, Mode: 0o555},
+		})
+	}
+
+	if stageDir == "" || m.gitWritable() {
+		return mounts, collapsed, nil
+	}
+	sanitized, changed := m.sanitizedGitConfig()
+	if !changed {
+		return mounts, collapsed, nil
+	}
+	staged := filepath.Join(stageDir, "git-config")
+	if err := os.WriteFile(staged, sanitized, 0o644); err != nil {
+		return nil, nil, fmt.Errorf("stage sanitized git config: %w", err)
+	}
+	mounts = append(mounts, mount.Mount{
+		Type:     mount.TypeBind,
+		Source:   staged,
+		Target:   path.Join(m.Target, ".git", "config"),
+		ReadOnly: true,
+	})
+	return mounts, collapsed, nil
+}
+
+// GitConfigExposed reports whether .git/config embeds credentials that
+// MaskMounts leaves visible because .git is writable in the sandbox. git
+// rewrites its config by renaming a lock file over it, which fails on a bind
+// mounted file, so a sanitized copy would break git remote add, git config
+// and push -u there.
+func (m *MountBuilder) GitConfigExposed() bool {
+	if !m.gitWritable() {
+		return false
+	}
+	_, changed := m.sanitizedGitConfig()
+	return changed
+}
+
+// gitWritable reports whether the workspace's .git directory is mounted
+// read-write.
+func (m *MountBuilder) gitWritable() bool {
+	for _, rwPath := range m.ReadWritePaths {
+		if rwPath == "." || rwPath == ".git" {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizedGitConfig reads the workspace's .git/config and strips
+// credentials from it. changed is false when there is no config or nothing
+// to strip.
+func (m *MountBuilder) sanitizedGitConfig() (sanitized []byte, changed bool) {
+	data, err := os.ReadFile(filepath.Join(m.WorkingDir, ".git", "config"))
+	if err != nil {
+		return nil, false
+	}
+	return sanitizeGitConfig(data)
+}
+
+var (
+	// httpUserinfoRx matches credentials in http(s) remote URLs.
+	httpUserinfoRx = regexp.MustCompile(`(?i)(https?://)[^/@\s]+@`)
+	// passwordUserinfoRx matches user:password pairs in other URL schemes,
+	// keeping the user name (e.g. ssh://git@host stays intact).
+	passwordUserinfoRx = regexp.MustCompile(`(?i)([a-z][a-z0-9+.-]*://[^/:@\s]+):[^/@\s]+@`)
+	// extraHeaderRx matches http.extraheader entries, where CI checkouts
+	// store bearer tokens.
+	extraHeaderRx = regexp.MustCompile(`(?i)^\s*extraheader\s*=`)
+)
+
+// sanitizeGitConfig strips credentials from a git config file. It reports
+// whether anything was removed.
+func sanitizeGitConfig(data []byte) ([]byte, bool) {
+	var out bytes.Buffer
+	changed := false
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if extraHeaderRx.MatchString(line) {
+			changed = true
+			continue
+		}
+		clean := httpUserinfoRx.ReplaceAllString(line, "$1")
+		clean = passwordUserinfoRx.ReplaceAllString(clean, "$1@")
+		if clean != line {
+			changed = true
+		}
+		out.WriteString(clean)
+	}
+	return out.Bytes(), changed
+}
@@ -3,34 +3,50 @@ package shai
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/colony-2/shai/internal/shai/runtime/overlay"
 	"github.com/docker/docker/api/types/mount"
 )
 
 // MountBuilder builds selective read-write mount configurations
 type MountBuilder struct {
-	WorkingDir     string
+	WorkingDir string
+	// Target is the in-container path the working directory is mounted at.
+	Target         string
 	ReadWritePaths []string
+	// Overlay, when set, backs the read-write paths with overlayfs so writes
+	// land in the session's scratch layer instead of the working directory.
+	Overlay *overlay.Session
 }
 
-// NewMountBuilder creates a mount builder for selective RW access
-func NewMountBuilder(workingDir string, rwPaths []string) (*MountBuilder, error) {
+// NewMountBuilder creates a mount builder for selective RW access. The
+// working directory is mounted at target, or at the default workspace when
+// target is empty.
+func NewMountBuilder(workingDir, target string, rwPaths []string) (*MountBuilder, error) {
 	// Validate working directory exists
 	if _, err := os.Stat(workingDir); err != nil {
 		return nil, fmt.Errorf("working directory does not exist: %w", err)
 	}
+	if target == "" {
+		target = configpkg.DefaultWorkspace
+	}
+	if !path.IsAbs(target) {
+		return nil, fmt.Errorf("workspace %q must be an absolute path", target)
+	}
 
 	// Clean and validate all paths
 	cleanedPaths := make([]string, 0, len(rwPaths))
-	for _, path := range rwPaths {
+	for _, rwPath := range rwPaths {
 		// Clean the path
-		cleanPath := filepath.Clean(path)
+		cleanPath := filepath.Clean(rwPath)
 
 		// Ensure path doesn't escape working directory
 		if strings.HasPrefix(cleanPath, "..") {
-			return nil, fmt.Errorf("path %q escapes working directory", path)
+			return nil, fmt.Errorf("path %q escapes working directory", rwPath)
 		}
 
 		// Check if path exists
@@ -45,6 +61,7 @@ func NewMountBuilder(workingDir string, rwPaths []string) (*MountBuilder, error)
 	// Validate no conflicts
 	mb := &MountBuilder{
 		WorkingDir:     workingDir,
+		Target:         path.Clean(target),
 		ReadWritePaths: cleanedPaths,
 	}
 
@@ -63,7 +80,7 @@ func (m *MountBuilder) BuildMounts() []mount.Mount {
 		{
 			Type:     mount.TypeBind,
 			Source:   m.WorkingDir,
-			Target:   "/src",
+			Target:   m.Target,
 			ReadOnly: true,
 		},
 	}
@@ -72,7 +89,17 @@ func (m *MountBuilder) BuildMounts() []mount.Mount {
 
 	// Add read-write overlays
 	// These will override the read-only base mount for specific paths
-	for _, rwPath := range m.ReadWritePaths {
+	for i, rwPath := range m.ReadWritePaths {
+		if m.Overlay != nil {
+			target := path.Join(m.Target, rwPath)
+			if rwPath == "." {
+				mounts[0] = m.overlayMount(i, target)
+				protectConfigDir = true
+			} else {
+				mounts = append(mounts, m.overlayMount(i, target))
+			}
+			continue
+		}
 		// Handle special case for current directory
 		if rwPath == "." {
 			// Override the base mount to be read-write
@@ -82,7 +109,7 @@ func (m *MountBuilder) BuildMounts() []mount.Mount {
 			mounts = append(mounts, mount.Mount{
 				Type:     mount.TypeBind,
 				Source:   filepath.Join(m.WorkingDir, rwPath),
-				Target:   filepath.Join("/src", rwPath),
+				Target:   path.Join(m.Target, rwPath),
 				ReadOnly: false,
 			})
 		}
@@ -94,7 +121,7 @@ func (m *MountBuilder) BuildMounts() []mount.Mount {
 			mounts = append(mounts, mount.Mount{
 				Type:     mount.TypeBind,
 				Source:   configDir,
-				Target:   filepath.Join("/src", ConfigDirName),
+				Target:   path.Join(m.Target, ConfigDirName),
 				ReadOnly: true,
 			})
 		}
@@ -103,6 +130,25 @@ func (m *MountBuilder) BuildMounts() []mount.Mount {
 	return mounts
 }
 
+// overlayMount mounts the i-th read-write path at target through an anonymous
+// overlayfs volume whose upper layer lives in the overlay session.
+func (m *MountBuilder) overlayMount(i int, target string) mount.Mount {
+	return mount.Mount{
+		Type:   mount.TypeVolume,
+		Target: target,
+		VolumeOptions: &mount.VolumeOptions{
+			DriverConfig: &mount.Driver{
+				Name: "local",
+				Options: map[string]string{
+					"type":   "overlay",
+					"device": "overlay",
+					"o":      m.Overlay.MountOptions(i),
+				},
+			},
+		},
+	}
+}
+
 // ValidateNoConflicts ensures mount paths don't conflict
 func (m *MountBuilder) ValidateNoConflicts() error {
 	// Check for overlapping paths
@@ -145,14 +191,16 @@ func isParentPath(parent, child string) bool {
 	return strings.HasPrefix(child, parent)
 }
 
-// BuildMountStrings returns mount specifications as strings for Docker CLI
+// BuildMountStrings returns mount specifications as strings for Docker CLI.
+// They describe plain bind mounts and ignore Overlay.
 func (m *MountBuilder) BuildMountStrings() []string {
 	var mountStrings []string
 
 	// Base mount
 	mountStrings = append(mountStrings, fmt.Sprintf(
-		"%s:/src:ro",
+		"%s:%s:ro",
 		m.WorkingDir,
+		m.Target,
 	))
 
 	protectConfigDir := false
@@ -162,15 +210,16 @@ func (m *MountBuilder) BuildMountStrings() []string {
 		if rwPath == "." {
 			// Override base mount to be read-write
 			mountStrings[0] = fmt.Sprintf(
-				"%s:/src:rw",
+				"%s:%s:rw",
 				m.WorkingDir,
+				m.Target,
 			)
 			protectConfigDir = true
 		} else {
 			mountStrings = append(mountStrings, fmt.Sprintf(
-				"%s:/src/%s:rw",
+				"%s:%s:rw",
 				filepath.Join(m.WorkingDir, rwPath),
-				rwPath,
+				path.Join(m.Target, rwPath),
 			))
 		}
 	}
@@ -179,9 +228,9 @@ func (m *MountBuilder) BuildMountStrings() []string {
 		configDir := filepath.Join(m.WorkingDir, ConfigDirName)
 		if info, err := os.Stat(configDir); err == nil && info.IsDir() {
 			mountStrings = append(mountStrings, fmt.Sprintf(
-				"%s:/src/%s:ro",
+				"%s:%s:ro",
 				configDir,
-				ConfigDirName,
+				path.Join(m.Target, ConfigDirName),
 			))
 		}
 	}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/colony-2/shai/internal/shai/runtime/overlay"
 	"github.com/docker/docker/api/types/mount"
 )
 
@@ -74,7 +75,7 @@ func TestNewMountBuilder(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mb, err := NewMountBuilder(tt.workDir, tt.rwPaths)
+			mb, err := NewMountBuilder(tt.workDir, "", tt.rwPaths)
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("expected error containing %q, got nil", tt.errMsg)
@@ -171,7 +172,7 @@ func TestBuildMounts(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mb, err := NewMountBuilder(tempDir, tt.rwPaths)
+			mb, err := NewMountBuilder(tempDir, "", tt.rwPaths)
 			if err != nil {
 				t.Fatalf("unexpected error creating MountBuilder: %v", err)
 			}
@@ -269,7 +270,7 @@ func TestBuildMountStrings(t *testing.T) {
 	os.MkdirAll(testDir1, 0755)
 	os.MkdirAll(filepath.Join(tempDir, ".shai"), 0755)
 
-	mb, err := NewMountBuilder(tempDir, []string{"dir1"})
+	mb, err := NewMountBuilder(tempDir, "", []string{"dir1"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -289,7 +290,7 @@ func TestBuildMountStringsProtectsConfigDir(t *testing.T) {
 	tempDir := t.TempDir()
 	os.MkdirAll(filepath.Join(tempDir, ".shai"), 0755)
 
-	mb, err := NewMountBuilder(tempDir, []string{"."})
+	mb, err := NewMountBuilder(tempDir, "", []string{"."})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -305,6 +306,72 @@ func TestBuildMountStringsProtectsConfigDir(t *testing.T) {
 	}
 }
 
+func TestBuildMountsUsesWorkspaceTarget(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "dir1"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, ".shai"), 0755)
+
+	mb, err := NewMountBuilder(tempDir, "/work/", []string{"dir1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []mount.Mount{
+		{Type: mount.TypeBind, Source: tempDir, Target: "/work", ReadOnly: true},
+		{Type: mount.TypeBind, Source: filepath.Join(tempDir, "dir1"), Target: "/work/dir1"},
+	}
+	if mounts := mb.BuildMounts(); !reflect.DeepEqual(mounts, expected) {
+		t.Errorf("BuildMounts() = %v, want %v", mounts, expected)
+	}
+
+	mb, err = NewMountBuilder(tempDir, "/work", []string{"."})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantStrings := []string{
+		tempDir + ":/work:rw",
+		filepath.Join(tempDir, ".shai") + ":/work/.shai:ro",
+	}
+	if got := mb.BuildMountStrings(); !reflect.DeepEqual(got, wantStrings) {
+		t.Errorf("BuildMountStrings() = %v, want %v", got, wantStrings)
+	}
+
+	if _, err := NewMountBuilder(tempDir, "work", nil); err == nil {
+		t.Fatal("expected relative workspace target to be rejected")
+	}
+}
+
+func TestBuildMountsOverlay(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "dir1"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, ".shai"), 0755)
+
+	mb, err := NewMountBuilder(tempDir, "", []string{"dir1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	session, err := overlay.Create(t.TempDir(), tempDir, mb.ReadWritePaths)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mb.Overlay = session
+
+	mounts := mb.BuildMounts()
+	if len(mounts) != 2 {
+		t.Fatalf("expected base and overlay mounts, got %v", mounts)
+	}
+	if !mounts[0].ReadOnly || mounts[0].Type != mount.TypeBind {
+		t.Errorf("expected read-only bind base mount, got %+v", mounts[0])
+	}
+	rw := mounts[1]
+	if rw.Type != mount.TypeVolume || rw.Target != "/src/dir1" || rw.Source != "" {
+		t.Fatalf("expected anonymous volume at /src/dir1, got %+v", rw)
+	}
+	opts := rw.VolumeOptions.DriverConfig.Options
+	if opts["type"] != "overlay" || opts["o"] != session.MountOptions(0) {
+		t.Errorf("unexpected overlay options %v", opts)
+	}
+}
+
 // Helper function
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && s[:len(substr)] == substr ||
@@ -0,0 +1,321 @@
+package overlay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"syscall"
+)
+
+// ChangeKind classifies a pending change.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Modified
+	Deleted
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Modified:
+		return "modified"
+	case Deleted:
+		return "deleted"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", int(k))
+	}
+}
+
+// Change is one pending change; Path is relative to the workspace root.
+type Change struct {
+	Path string
+	Kind ChangeKind
+}
+
+// errMarkersUnreadable is returned for sessions whose overlay markers live in
+// trusted.* xattrs when not running as root.
+var errMarkersUnreadable = errors.New("the session's overlay markers are only readable by root; run as root or discard the session")
+
+// geteuid is a variable so tests can run as either root or a user.
+var geteuid = os.Geteuid
+
+// Changes lists the session's pending changes in path order. Files whose
+// content, mode and type match the workspace (for example after a touch) are
+// not reported. Entries of a directory that was deleted and recreated in the
+// sandbox are reported as deleted unless they were recreated too.
+func (s *Session) Changes() ([]Change, error) {
+	var changes []Change
+	err := s.walk(func(rel, upper, lower string, d fs.DirEntry) error {
+		if isWhiteout(d) {
+			changes = append(changes, Change{Path: rel, Kind: Deleted})
+			return nil
+		}
+		lowerInfo, lowerErr := os.Lstat(lower)
+		if d.IsDir() {
+			if lowerErr == nil && lowerInfo.IsDir() {
+				gone, err := s.replacedEntries(upper, lower)
+				if err != nil {
+					return fmt.Errorf("%s: %w", rel, err)
+				}
+				for _, name := range gone {
+					changes = append(changes, Change{Path: path.Join(rel, name), Kind: Deleted})
+				}
+				return nil
+			}
+			if empty, _ := isEmptyDir(upper); empty {
+				changes = append(changes, Change{Path: rel + "/", Kind: Added})
+			}
+			return nil
+		}
+		if lowerErr != nil {
+			changes = append(changes, Change{Path: rel, Kind: Added})
+			return nil
+		}
+		same, err := sameFile(upper, lower, lowerInfo)
+		if err != nil {
+			return err
+		}
+		if !same {
+			changes = append(changes, Change{Path: rel, Kind: Modified})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// Apply writes the pending changes into the workspace and discards the
+// session. Apply is not atomic: everything that can be checked up front
+// (file types, overlay markers) is checked before the workspace is touched,
+// but an I/O error partway through leaves part of the changes applied and
+// keeps the session. Each step is idempotent, so calling Apply again
+// finishes the job.
+func (s *Session) Apply() error {
+	// lower directory -> entries to drop because the sandbox replaced it.
+	replaced := map[string][]string{}
+	err := s.walk(func(rel, upper, lower string, d fs.DirEntry) error {
+		if isWhiteout(d) {
+			return nil
+		}
+		if d.IsDir() {
+			if info, err := os.Lstat(lower); err == nil && info.IsDir() {
+				gone, err := s.replacedEntries(upper, lower)
+				if err != nil {
+					return fmt.Errorf("%s: %w", rel, err)
+				}
+				replaced[lower] = gone
+			}
+			return nil
+		}
+		if t := d.Type(); t != 0 && t&fs.ModeSymlink == 0 {
+			return fmt.Errorf("%s: unsupported file type %s", rel, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("apply session %s: %w", s.ID, err)
+	}
+
+	err = s.walk(func(rel, upper, lower string, d fs.DirEntry) error {
+		if isWhiteout(d) {
+			return os.RemoveAll(lower)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		lowerInfo, lowerErr := os.Lstat(lower)
+		switch {
+		case d.IsDir():
+			if lowerErr == nil && !lowerInfo.IsDir() {
+				if err := os.Remove(lower); err != nil {
+					return err
+				}
+			}
+			if err := os.MkdirAll(lower, info.Mode().Perm()); err != nil {
+				return err
+			}
+			for _, name := range replaced[lower] {
+				if err := os.RemoveAll(filepath.Join(lower, name)); err != nil {
+					return err
+				}
+			}
+			return os.Chmod(lower, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(upper)
+			if err != nil {
+				return err
+			}
+			if lowerErr == nil {
+				if err := os.RemoveAll(lower); err != nil {
+					return err
+				}
+			}
+			return os.Symlink(target, lower)
+		case info.Mode().IsRegular():
+			if lowerErr == nil && lowerInfo.IsDir() {
+				if err := os.RemoveAll(lower); err != nil {
+					return err
+				}
+			}
+			return copyFile(upper, lower, info.Mode().Perm())
+		default:
+			return fmt.Errorf("%s: unsupported file type %s", rel, info.Mode().Type())
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("apply session %s: %w", s.ID, err)
+	}
+	return s.Discard()
+}
+
+// replacedEntries lists the entries of lower that the sandbox removed by
+// deleting and recreating the directory. overlayfs marks such an upper
+// directory opaque, hiding everything below it in lower.
+func (s *Session) replacedEntries(upper, lower string) ([]string, error) {
+	attr := "user.overlay.opaque"
+	if s.Markers != userMarkers {
+		if geteuid() != 0 {
+			return nil, errMarkersUnreadable
+		}
+		attr = "trusted.overlay.opaque"
+	}
+	value, err := readXattr(upper, attr)
+	if err != nil {
+		return nil, fmt.Errorf("read overlay marker: %w", err)
+	}
+	if value != "y" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(lower)
+	if err != nil {
+		return nil, err
+	}
+	var gone []string
+	for _, e := range entries {
+		if _, err := os.Lstat(filepath.Join(upper, e.Name())); errors.Is(err, fs.ErrNotExist) {
+			gone = append(gone, e.Name())
+		}
+	}
+	return gone, nil
+}
+
+// walk calls fn for every entry of each upper directory with its
+// workspace-relative path and the matching upper and lower host paths.
+// Whiteouts and files are not descended into.
+func (s *Session) walk(fn func(rel, upper, lower string, d fs.DirEntry) error) error {
+	for i, base := range s.Paths {
+		root := s.UpperDir(i)
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p == root {
+				return nil
+			}
+			sub, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			rel := path.Join(filepath.ToSlash(base), filepath.ToSlash(sub))
+			return fn(rel, p, filepath.Join(s.LowerDir(i), sub), d)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isWhiteout reports whether d is an overlayfs whiteout: a 0/0 character
+// device marking a deleted lower entry.
+func isWhiteout(d fs.DirEntry) bool {
+	if d.Type()&fs.ModeCharDevice == 0 {
+		return false
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Rdev == 0
+}
+
+func isEmptyDir(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	return err == io.EOF, nil
+}
+
+// sameFile reports whether the upper entry matches the lower one in type,
+// mode and content.
+func sameFile(upper, lower string, lowerInfo fs.FileInfo) (bool, error) {
+	upperInfo, err := os.Lstat(upper)
+	if err != nil {
+		return false, err
+	}
+	if upperInfo.Mode() != lowerInfo.Mode() {
+		return false, nil
+	}
+	if upperInfo.Mode()&fs.ModeSymlink != 0 {
+		a, errA := os.Readlink(upper)
+		b, errB := os.Readlink(lower)
+		return errA == nil && errB == nil && a == b, nil
+	}
+	if !upperInfo.Mode().IsRegular() || upperInfo.Size() != lowerInfo.Size() {
+		return false, nil
+	}
+	a, err := os.ReadFile(upper)
+	if err != nil {
+		return false, err
+	}
+	b, err := os.ReadFile(lower)
+	if err != nil {
+		return false, nil
+	}
+	return bytes.Equal(a, b), nil
+}
+
+// copyFile replaces dst with the content of src through a temporary file in
+// the same directory.
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".shai-apply-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
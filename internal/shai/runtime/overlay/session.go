@@ -0,0 +1,164 @@
+// Package overlay backs writable sandbox paths with overlayfs so that changes
+// land in a scratch layer on the host and can be reviewed, applied or
+// discarded after the session ends.
+package overlay
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const metadataFile = "session.json"
+
+// userMarkers is the Session.Markers value of sessions mounted with the
+// userxattr option.
+const userMarkers = "user"
+
+// Session records the scratch layers of one overlay sandbox session. Each
+// writable path gets an upper directory that collects its changes and a work
+// directory used by overlayfs.
+type Session struct {
+	ID         string    `json:"id"`
+	WorkingDir string    `json:"working_dir"`
+	Paths      []string  `json:"paths"`
+	Created    time.Time `json:"created"`
+	// Markers is the xattr namespace overlayfs keeps its markers in. New
+	// sessions use "user", which the host user can read; older ones used
+	// "trusted", which only root can.
+	Markers string `json:"markers,omitempty"`
+
+	dir string
+}
+
+// DefaultDir returns ~/.local/state/shai/sessions.
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "shai", "sessions"), nil
+}
+
+// Create starts a session under root for the workspace-relative paths of
+// workingDir.
+func Create(root, workingDir string, paths []string) (*Session, error) {
+	if strings.ContainsAny(workingDir, ",:") {
+		return nil, fmt.Errorf("overlay mode does not support workspace paths containing ',' or ':' (%s)", workingDir)
+	}
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s := &Session{
+		ID:         now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		WorkingDir: workingDir,
+		Paths:      append([]string(nil), paths...),
+		Created:    now.UTC(),
+		Markers:    userMarkers,
+	}
+	s.dir = filepath.Join(root, s.ID)
+	for i := range s.Paths {
+		for _, dir := range []string{s.UpperDir(i), s.WorkDir(i)} {
+			if err := os.MkdirAll(dir, 0o700); err != nil {
+				return nil, fmt.Errorf("create overlay session: %w", err)
+			}
+		}
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, metadataFile), data, 0o600); err != nil {
+		return nil, fmt.Errorf("write overlay session: %w", err)
+	}
+	return s, nil
+}
+
+// Open loads the session id from root.
+func Open(root, id string) (*Session, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("invalid session id %q", id)
+	}
+	dir := filepath.Join(root, id)
+	data, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("no pending session %q", id)
+		}
+		return nil, fmt.Errorf("read overlay session: %w", err)
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse overlay session %s: %w", id, err)
+	}
+	s.dir = dir
+	return &s, nil
+}
+
+// List returns the sessions under root, oldest first.
+func List(root string) ([]*Session, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sessions []*Session
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		s, err := Open(root, e.Name())
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Created.Before(sessions[j].Created) })
+	return sessions, nil
+}
+
+// LowerDir returns the host directory backing the i-th writable path.
+func (s *Session) LowerDir(i int) string {
+	return filepath.Join(s.WorkingDir, s.Paths[i])
+}
+
+// UpperDir returns the directory collecting changes to the i-th writable path.
+func (s *Session) UpperDir(i int) string {
+	return filepath.Join(s.dir, "upper", fmt.Sprint(i))
+}
+
+// WorkDir returns the overlayfs work directory of the i-th writable path.
+func (s *Session) WorkDir(i int) string {
+	return filepath.Join(s.dir, "work", fmt.Sprint(i))
+}
+
+// MountOptions returns the overlayfs options for the i-th writable path.
+// userxattr keeps the markers for deleted and recreated directories in
+// xattrs the host user can read after the session.
+func (s *Session) MountOptions(i int) string {
+	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", s.LowerDir(i), s.UpperDir(i), s.WorkDir(i))
+	if s.Markers == userMarkers {
+		opts += ",userxattr"
+	}
+	return opts
+}
+
+// Discard drops the session and its pending changes.
+func (s *Session) Discard() error {
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("discard session %s: %w", s.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestSessionChangesAndApply(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "app", "main.go"), "package main\n")
+	writeFile(t, filepath.Join(workspace, "app", "same.txt"), "same\n")
+	writeFile(t, filepath.Join(workspace, "app", "old.txt"), "old\n")
+	writeFile(t, filepath.Join(workspace, "other.txt"), "untouched\n")
+
+	root := t.TempDir()
+	s, err := Create(root, workspace, []string{"app"})
+	require.NoError(t, err)
+
+	upper := s.UpperDir(0)
+	writeFile(t, filepath.Join(upper, "main.go"), "package main\n\nfunc main() {}\n")
+	writeFile(t, filepath.Join(upper, "same.txt"), "same\n")
+	writeFile(t, filepath.Join(upper, "pkg", "new.go"), "package pkg\n")
+	whiteout := filepath.Join(upper, "old.txt")
+	if err := syscall.Mknod(whiteout, syscall.S_IFCHR, 0); err != nil {
+		t.Logf("cannot create whiteout (%v); skipping deletion checks", err)
+		whiteout = ""
+	}
+
+	changes, err := s.Changes()
+	require.NoError(t, err)
+	want := []Change{
+		{Path: "app/main.go", Kind: Modified},
+		{Path: "app/pkg/new.go", Kind: Added},
+	}
+	if whiteout != "" {
+		want = []Change{
+			{Path: "app/main.go", Kind: Modified},
+			{Path: "app/old.txt", Kind: Deleted},
+			{Path: "app/pkg/new.go", Kind: Added},
+		}
+	}
+	assert.Equal(t, want, changes)
+
+	reopened, err := Open(root, s.ID)
+	require.NoError(t, err)
+	assert.Equal(t, workspace, reopened.WorkingDir)
+	sessions, err := List(root)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+
+	require.NoError(t, reopened.Apply())
+	data, err := os.ReadFile(filepath.Join(workspace, "app", "main.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nfunc main() {}\n", string(data))
+	assert.FileExists(t, filepath.Join(workspace, "app", "pkg", "new.go"))
+	if whiteout != "" {
+		assert.NoFileExists(t, filepath.Join(workspace, "app", "old.txt"))
+	}
+	assert.NoDirExists(t, filepath.Join(root, s.ID))
+}
+
+func TestSessionDiscardKeepsWorkspace(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "a.txt"), "a\n")
+
+	root := t.TempDir()
+	s, err := Create(root, workspace, []string{"."})
+	require.NoError(t, err)
+	writeFile(t, filepath.Join(s.UpperDir(0), "a.txt"), "changed\n")
+	assert.Contains(t, s.MountOptions(0), "lowerdir="+workspace+",")
+
+	require.NoError(t, s.Discard())
+	data, err := os.ReadFile(filepath.Join(workspace, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\n", string(data))
+	_, err = Open(root, s.ID)
+	assert.ErrorContains(t, err, "no pending session")
+	_, err = Open(root, "../escape")
+	assert.ErrorContains(t, err, "invalid session id")
+}
+
+func TestSessionRecreatedDirectoryDropsOldEntries(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "build", "a.o"), "a\n")
+	writeFile(t, filepath.Join(workspace, "build", "b.o"), "b\n")
+
+	root := t.TempDir()
+	s, err := Create(root, workspace, []string{"."})
+	require.NoError(t, err)
+	assert.Contains(t, s.MountOptions(0), ",userxattr")
+
+	// rm -rf build && mkdir build && touch build/b.o build/c.o, as overlayfs
+	// records it with userxattr.
+	upperBuild := filepath.Join(s.UpperDir(0), "build")
+	writeFile(t, filepath.Join(upperBuild, "b.o"), "b\n")
+	writeFile(t, filepath.Join(upperBuild, "c.o"), "c\n")
+	if err := syscall.Setxattr(upperBuild, "user.overlay.opaque", []byte("y"), 0); err != nil {
+		t.Skipf("cannot set user xattrs here: %v", err)
+	}
+
+	changes, err := s.Changes()
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Path: "build/a.o", Kind: Deleted},
+		{Path: "build/c.o", Kind: Added},
+	}, changes)
+
+	require.NoError(t, s.Apply())
+	assert.NoFileExists(t, filepath.Join(workspace, "build", "a.o"))
+	assert.FileExists(t, filepath.Join(workspace, "build", "b.o"))
+	assert.FileExists(t, filepath.Join(workspace, "build", "c.o"))
+}
+
+func TestSessionWithRootOnlyMarkersIsRefused(t *testing.T) {
+	orig := geteuid
+	geteuid = func() int { return 1000 }
+	t.Cleanup(func() { geteuid = orig })
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "build", "a.o"), "a\n")
+	root := t.TempDir()
+	s, err := Create(root, workspace, []string{"."})
+	require.NoError(t, err)
+	s.Markers = ""
+	writeFile(t, filepath.Join(s.UpperDir(0), "build", "c.o"), "c\n")
+
+	_, err = s.Changes()
+	assert.ErrorIs(t, err, errMarkersUnreadable)
+	assert.ErrorIs(t, s.Apply(), errMarkersUnreadable)
+	assert.NoFileExists(t, filepath.Join(workspace, "build", "c.o"), "nothing is written when the check fails")
+}
@@ -0,0 +1,20 @@
+package overlay
+
+import (
+	"errors"
+	"syscall"
+)
+
+// readXattr returns the value of the extended attribute name on path, or ""
+// when it is not set.
+func readXattr(path, name string) (string, error) {
+	buf := make([]byte, 64)
+	n, err := syscall.Getxattr(path, name, buf)
+	if errors.Is(err, syscall.ENODATA) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package overlay
+
+import "errors"
+
+// readXattr is only needed for sessions, which require a Linux host.
+func readXattr(path, name string) (string, error) {
+	return "", errors.New("overlay markers can only be read on Linux")
+}
@@ -0,0 +1,49 @@
+package shai
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/colony-2/shai/internal/shai/runtime/overlay"
+)
+
+// validateRWMode checks EphemeralConfig.RWMode.
+func validateRWMode(mode string) error {
+	switch strings.TrimSpace(mode) {
+	case "", RWModeBind, RWModeOverlay:
+		return nil
+	default:
+		return fmt.Errorf("invalid rw mode %q (expected %s or %s)", mode, RWModeBind, RWModeOverlay)
+	}
+}
+
+// startOverlaySession creates the overlay session backing rwPaths when cfg
+// asks for overlay mode. It returns nil in bind mode or when nothing is
+// writable.
+func startOverlaySession(cfg EphemeralConfig, rwPaths []string) (*overlay.Session, error) {
+	if strings.TrimSpace(cfg.RWMode) != RWModeOverlay || len(rwPaths) == 0 {
+		return nil, nil
+	}
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("rw mode %s requires a Linux Docker host", RWModeOverlay)
+	}
+	dir := cfg.OverlayDir
+	if dir == "" {
+		var err error
+		if dir, err = overlay.DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	session, err := overlay.Create(dir, cfg.WorkingDir, rwPaths)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Overlay returns the overlay session holding the sandbox's pending changes,
+// or nil when read-write paths are bind mounted.
+func (r *EphemeralRunner) Overlay() *overlay.Session {
+	return r.overlay
+}
@@ -0,0 +1,425 @@
+package shai
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/colony-2/shai/internal/shai/runtime/trust"
+)
+
+// Plan describes the sandbox a request resolves to. It is built from the
+// config and host files alone: Docker is not contacted and no variable values
+// are read.
+type Plan struct {
+	ConfigFile string `json:"config_file"`
+	// Includes lists the files the config pulled in with include:.
+	Includes []string `json:"includes,omitempty"`
+	// Overlay is the user config merged over the workspace config, and
+	// OverlayIgnored the fields it set that the workspace config locks.
+	Overlay        string   `json:"overlay,omitempty"`
+	OverlayIgnored []string `json:"overlay_ignored,omitempty"`
+	// DefaultConfig is set when no config file exists and the built-in
+	// default is used.
+	DefaultConfig bool `json:"default_config"`
+	// Trust is "trusted", "changed" or "untrusted"; it is empty for the
+	// default config, which needs no approval.
+	Trust string `json:"trust,omitempty"`
+
+	Image string `json:"image"`
+	// ImageSource says why Image was chosen: "cli" for --image, "apply" when
+	// the apply rule for ImageRule matched the read-write path ImagePath, or
+	// "config" for the config's image.
+	ImageSource string `json:"image_source"`
+	ImageRule   string `json:"image_rule,omitempty"`
+	ImagePath   string `json:"image_path,omitempty"`
+	// ImageFile is the config file that set Image; empty for --image.
+	ImageFile string `json:"image_file,omitempty"`
+
+	User string `json:"user"`
+	// UserFile is the config file that set User; empty for --user and the
+	// default user.
+	UserFile       string   `json:"user_file,omitempty"`
+	Workspace      string   `json:"workspace"`
+	ReadWritePaths []string `json:"read_write_paths,omitempty"`
+	RWMode         string   `json:"rw_mode"`
+	Worktree       bool     `json:"worktree,omitempty"`
+
+	ResourceSets   []PlanResourceSet   `json:"resource_sets,omitempty"`
+	Mounts         []PlanMount         `json:"mounts"`
+	Env            []PlanVar           `json:"env,omitempty"`
+	HTTP           []string            `json:"http,omitempty"`
+	Ports          []string            `json:"ports,omitempty"`
+	HostPorts      []PlanHostPort      `json:"host_ports,omitempty"`
+	PublishedPorts []PlanPublishedPort `json:"published_ports,omitempty"`
+	Calls          []PlanCall          `json:"calls,omitempty"`
+	RootCommands   []string            `json:"root_commands,omitempty"`
+	SSHAgent       bool                `json:"ssh_agent,omitempty"`
+
+	Privileged bool `json:"privileged"`
+	// PrivilegedBy names what asks for privileged mode: "--privileged" or
+	// resource sets with options.privileged.
+	PrivilegedBy []string `json:"privileged_by,omitempty"`
+	Hardened     bool     `json:"hardened"`
+}
+
+// PlanResourceSet is an activated resource set and why it is active.
+type PlanResourceSet struct {
+	Name string `json:"name"`
+	// Files lists the config files that define the set; more than one when
+	// the user overlay adds to a workspace set.
+	Files []string `json:"files,omitempty"`
+	// Requested is set when the set was asked for with --resource-set.
+	Requested bool `json:"requested,omitempty"`
+	// Matches lists the apply rules that activated the set.
+	Matches []PlanApplyMatch `json:"matches,omitempty"`
+}
+
+// PlanApplyMatch records an apply rule matching a workspace path: "." for
+// the whole workspace or one of the read-write paths.
+type PlanApplyMatch struct {
+	Rule string `json:"rule"`
+	Path string `json:"path"`
+	// File is the config file the rule is in.
+	File string `json:"file"`
+}
+
+// PlanMount is a mount the sandbox would get.
+type PlanMount struct {
+	Source string `json:"source,omitempty"`
+	Target string `json:"target"`
+	// Mode is "ro", "rw", "overlay", "masked" or "sanitized" (a copy of
+	// .git/config without credentials).
+	Mode string `json:"mode"`
+	// Origin is "workspace", "mask" or "resource:<name>".
+	Origin string `json:"origin"`
+	// Missing marks resource mounts whose source does not exist; they are
+	// skipped at start.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// PlanVar names a variable set in the sandbox. Values are never included.
+type PlanVar struct {
+	Name     string `json:"name"`
+	Resource string `json:"resource"`
+	// From is "env", "file", "command" or "keychain".
+	From   string `json:"from"`
+	AsFile bool   `json:"as_file,omitempty"`
+}
+
+// PlanHostPort forwards host loopback Port to localhost:Target in the sandbox.
+type PlanHostPort struct {
+	Port   int `json:"port"`
+	Target int `json:"target"`
+}
+
+// PlanPublishedPort publishes sandbox Port on host loopback HostPort; 0 picks
+// a port at start.
+type PlanPublishedPort struct {
+	Port     int `json:"port"`
+	HostPort int `json:"host_port"`
+}
+
+// PlanCall is a host command exposed to the sandbox.
+type PlanCall struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Command     string `json:"command"`
+	AllowedArgs string `json:"allowed_args,omitempty"`
+	Resource    string `json:"resource"`
+}
+
+// PlanSandbox resolves cfg as NewEphemeralRunner does and describes the
+// sandbox it would start. Trust is reported rather than enforced, so an
+// unapproved config can be reviewed first.
+func PlanSandbox(cfg EphemeralConfig) (*Plan, error) {
+	cfg.RequireTrust = false
+	cfg.ConfirmTrust = nil
+	resolved, err := resolveSandbox(cfg)
+	if err != nil {
+		return nil, asSetupError(err)
+	}
+	plan, err := resolved.plan()
+	return plan, asSetupError(err)
+}
+
+func (s *resolvedSandbox) plan() (*Plan, error) {
+	p := &Plan{
+		ConfigFile:     s.configPath,
+		DefaultConfig:  s.usedDefault,
+		Includes:       s.shaiCfg.Includes(),
+		Overlay:        s.shaiCfg.Overlay(),
+		OverlayIgnored: s.shaiCfg.OverlayIgnored(),
+		Image:          s.image,
+		ImageSource:    s.imageSource,
+		User:           s.shaiCfg.User,
+		Workspace:      s.workspace,
+		ReadWritePaths: s.mountBuilder.ReadWritePaths,
+		RWMode:         s.cfg.RWMode,
+		Worktree:       s.cfg.Worktree,
+		HTTP:           uniqueHTTPHosts(s.resources),
+		Ports:          uniquePortEntries(s.resources),
+		RootCommands:   collectRootCommands(s.resources),
+	}
+	if p.RWMode == "" {
+		p.RWMode = RWModeBind
+	}
+	if s.cfg.UserOverride != "" {
+		p.User = s.cfg.UserOverride
+	} else {
+		p.UserFile = lastOrigin(s.shaiCfg.Origin("user"))
+	}
+	if !s.usedDefault {
+		status, err := planTrust(s.cfg, s.configPath, s.shaiCfg.Includes())
+		if err != nil {
+			return nil, err
+		}
+		p.Trust = status
+	}
+
+	paths := orderedResourcePaths(s.mountBuilder.ReadWritePaths)
+	switch p.ImageSource {
+	case "":
+		p.ImageSource = "config"
+		p.ImageFile = lastOrigin(s.shaiCfg.Origin("image"))
+	case "apply":
+		for _, rw := range paths[1:] {
+			if rule, ok := s.shaiCfg.ImageRuleForPath(rw); ok {
+				p.ImageRule, p.ImagePath, p.ImageFile = rule.Path, rw, rule.Origin()
+				break
+			}
+		}
+	}
+
+	p.ResourceSets = s.planResourceSets(paths)
+	mounts, err := s.planMounts()
+	if err != nil {
+		return nil, err
+	}
+	p.Mounts = mounts
+	p.Env = planVars(s.resources)
+	p.Calls = planCalls(s.resources)
+
+	seenHostPorts := map[int]bool{}
+	for _, res := range s.resources {
+		if res == nil || res.Spec == nil {
+			continue
+		}
+		for _, hp := range res.Spec.HostPorts {
+			if seenHostPorts[hp.ContainerPort()] {
+				continue
+			}
+			seenHostPorts[hp.ContainerPort()] = true
+			p.HostPorts = append(p.HostPorts, PlanHostPort{Port: hp.Port, Target: hp.ContainerPort()})
+		}
+		if res.Spec.SSHAgent != nil {
+			p.SSHAgent = true
+		}
+		if res.Spec.Options.Privileged {
+			p.PrivilegedBy = append(p.PrivilegedBy, res.Name)
+		}
+	}
+	sort.Slice(p.HostPorts, func(i, j int) bool { return p.HostPorts[i].Target < p.HostPorts[j].Target })
+	for _, pp := range collectPublishedPorts(s.cfg.PublishedPorts, s.resources) {
+		p.PublishedPorts = append(p.PublishedPorts, PlanPublishedPort{Port: pp.Port, HostPort: pp.HostPort})
+	}
+
+	if s.cfg.Privileged {
+		p.PrivilegedBy = append([]string{"--privileged"}, p.PrivilegedBy...)
+	}
+	p.Privileged = len(p.PrivilegedBy) > 0
+	p.Hardened = hardeningEnabled(p.Privileged, s.resources)
+	return p, nil
+}
+
+// planTrust reports the approval state of the config at configPath and the
+// files it includes.
+func planTrust(cfg EphemeralConfig, configPath string, includes []string) (string, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", err
+	}
+	if data, err = trust.Content(data, includes); err != nil {
+		return "", err
+	}
+	dir := cfg.TrustStoreDir
+	if dir == "" {
+		if dir, err = trust.DefaultDir(); err != nil {
+			return "", err
+		}
+	}
+	status, err := trust.NewStore(dir).Check(configPath, data)
+	if err != nil {
+		return "", err
+	}
+	switch status {
+	case trust.Trusted:
+		return "trusted", nil
+	case trust.Changed:
+		return "changed", nil
+	}
+	return "untrusted", nil
+}
+
+// planResourceSets explains each active resource set: requested explicitly,
+// matched by apply rules for paths, or both.
+func (s *resolvedSandbox) planResourceSets(paths []string) []PlanResourceSet {
+	requested := map[string]bool{}
+	for _, name := range s.cfg.ResourceSets {
+		requested[strings.TrimSpace(name)] = true
+	}
+	matches := map[string][]PlanApplyMatch{}
+	// A rule is reported once per set, for the first path it matched.
+	matchedRule := map[string]bool{}
+	for _, p := range paths {
+		for _, rule := range s.shaiCfg.ApplyRulesForPath(p) {
+			for _, name := range rule.Resources {
+				if matchedRule[name+"\x00"+rule.Path] {
+					continue
+				}
+				matchedRule[name+"\x00"+rule.Path] = true
+				matches[name] = append(matches[name], PlanApplyMatch{Rule: rule.Path, Path: p, File: rule.Origin()})
+			}
+		}
+	}
+	out := make([]PlanResourceSet, 0, len(s.resourceNames))
+	for _, name := range s.resourceNames {
+		out = append(out, PlanResourceSet{
+			Name:      name,
+			Files:     s.shaiCfg.Origin("resources." + name),
+			Requested: requested[name],
+			Matches:   matches[name],
+		})
+	}
+	return out
+}
+
+// lastOrigin returns the file that set a value last, or "" for a default.
+func lastOrigin(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	return files[len(files)-1]
+}
+
+// planMounts lists the workspace, resource and mask mounts in the order
+// buildDockerConfigs adds them. Internal mounts such as the bootstrap
+// directory are left out.
+func (s *resolvedSandbox) planMounts() ([]PlanMount, error) {
+	var out []PlanMount
+	overlay := s.cfg.RWMode == RWModeOverlay
+	for _, m := range s.mountBuilder.BuildMounts() {
+		mode := "rw"
+		switch {
+		case m.ReadOnly:
+			mode = "ro"
+		case overlay:
+			mode = "overlay"
+		}
+		out = append(out, PlanMount{Source: m.Source, Target: m.Target, Mode: mode, Origin: "workspace"})
+	}
+
+	for _, res := range s.resources {
+		if res == nil || res.Spec == nil {
+			continue
+		}
+		for _, m := range res.Spec.Mounts {
+			source := m.Source
+			if !filepath.IsAbs(source) {
+				source = filepath.Join(s.cfg.WorkingDir, source)
+			}
+			mode := "ro"
+			if m.Mode == "rw" {
+				mode = "rw"
+			}
+			_, statErr := os.Stat(source)
+			out = append(out, PlanMount{
+				Source:  source,
+				Target:  m.Target,
+				Mode:    mode,
+				Origin:  "resource:" + res.Name,
+				Missing: statErr != nil,
+			})
+		}
+	}
+
+	files, dirs, _, err := findMaskedPaths(s.mountBuilder.WorkingDir, maskPatterns(s.shaiCfg, s.resources))
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range append(files, dirs...) {
+		out = append(out, PlanMount{Target: path.Join(s.mountBuilder.Target, rel), Mode: "masked", Origin: "mask"})
+	}
+	if data, err := os.ReadFile(filepath.Join(s.mountBuilder.WorkingDir, ".git", "config")); err == nil {
+		if _, changed := sanitizeGitConfig(data); changed {
+			out = append(out, PlanMount{Target: path.Join(s.mountBuilder.Target, ".git", "config"), Mode: "sanitized", Origin: "mask"})
+		}
+	}
+	return out, nil
+}
+
+// planVars lists the variables collectEnvMappings would set, by name. A
+// later resource set overrides an earlier one with the same target.
+func planVars(resources []*configpkg.ResolvedResource) []PlanVar {
+	byName := map[string]PlanVar{}
+	var names []string
+	for _, res := range resources {
+		if res == nil || res.Spec == nil {
+			continue
+		}
+		for _, vm := range res.Spec.Vars {
+			target := strings.TrimSpace(vm.Target)
+			if target == "" {
+				target = strings.TrimSpace(vm.Source)
+			}
+			from := "env"
+			switch {
+			case strings.TrimSpace(vm.File) != "":
+				from = "file"
+			case strings.TrimSpace(vm.Command) != "":
+				from = "command"
+			case strings.TrimSpace(vm.Keychain) != "":
+				from = "keychain"
+			}
+			if _, ok := byName[target]; !ok {
+				names = append(names, target)
+			}
+			byName[target] = PlanVar{Name: target, Resource: res.Name, From: from, AsFile: vm.AsFile}
+		}
+	}
+	sort.Strings(names)
+	out := make([]PlanVar, 0, len(names))
+	for _, name := range names {
+		out = append(out, byName[name])
+	}
+	return out
+}
+
+// planCalls lists the calls callEntriesFromResources would expose; the first
+// resource set defining a name wins.
+func planCalls(resources []*configpkg.ResolvedResource) []PlanCall {
+	var out []PlanCall
+	seen := map[string]bool{}
+	for _, res := range resources {
+		if res == nil || res.Spec == nil {
+			continue
+		}
+		for _, c := range res.Spec.Calls {
+			if seen[c.Name] {
+				continue
+			}
+			seen[c.Name] = true
+			out = append(out, PlanCall{
+				Name:        c.Name,
+				Description: c.Description,
+				Command:     c.Command,
+				AllowedArgs: c.AllowedArgs,
+				Resource:    res.Name,
+			})
+		}
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package shai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanSandboxExplainsSelection(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".env":       "TOKEN=1",
+		"web/app.js": "",
+		".shai/config.yaml": `
+type: shai-sandbox
+version: 1
+image: example/base:1
+resources:
+  base:
+    vars:
+      - source: GITHUB_TOKEN
+      - command: echo secret
+        target: NPM_TOKEN
+        as-file: true
+    http: [github.com]
+    calls:
+      - name: deploy
+        command: ./deploy.sh
+  web:
+    ports: [{host: registry.npmjs.org, port: 443}]
+    root-commands: ["apt-get install -y jq"]
+    mounts:
+      - source: /nonexistent-shai-cache
+        target: /cache
+    options:
+      privileged: true
+apply:
+  - path: ./
+    resources: [base]
+  - path: web
+    resources: [web]
+    image: example/node:20
+`,
+	})
+
+	plan, err := PlanSandbox(EphemeralConfig{
+		WorkingDir:     dir,
+		ReadWritePaths: []string{"web"},
+		TrustStoreDir:  t.TempDir(),
+		RequireTrust:   true,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "untrusted", plan.Trust)
+	assert.Equal(t, "example/node:20", plan.Image)
+	assert.Equal(t, "apply", plan.ImageSource)
+	assert.Equal(t, "web", plan.ImageRule)
+	assert.Equal(t, "web", plan.ImagePath)
+	configFile := filepath.Join(dir, ".shai", "config.yaml")
+	assert.Equal(t, configFile, plan.ImageFile)
+	assert.Empty(t, plan.UserFile)
+	assert.Equal(t, []PlanResourceSet{
+		{Name: "base", Files: []string{configFile}, Matches: []PlanApplyMatch{{Rule: "./", Path: ".", File: configFile}}},
+		{Name: "web", Files: []string{configFile}, Matches: []PlanApplyMatch{{Rule: "web", Path: "web", File: configFile}}},
+	}, plan.ResourceSets)
+	assert.Equal(t, []PlanVar{
+		{Name: "GITHUB_TOKEN", Resource: "base", From: "env"},
+		{Name: "NPM_TOKEN", Resource: "base", From: "command", AsFile: true},
+	}, plan.Env)
+	assert.Equal(t, []string{"github.com"}, plan.HTTP)
+	assert.Equal(t, []string{"registry.npmjs.org:443"}, plan.Ports)
+	assert.Equal(t, []PlanCall{{Name: "deploy", Command: "./deploy.sh", Resource: "base"}}, plan.Calls)
+	assert.Equal(t, []string{"apt-get install -y jq"}, plan.RootCommands)
+	assert.True(t, plan.Privileged)
+	assert.Equal(t, []string{"web"}, plan.PrivilegedBy)
+	assert.False(t, plan.Hardened)
+
+	assert.Contains(t, plan.Mounts, PlanMount{Source: dir, Target: "/src", Mode: "ro", Origin: "workspace"})
+	assert.Contains(t, plan.Mounts, PlanMount{Source: filepath.Join(dir, "web"), Target: "/src/web", Mode: "rw", Origin: "workspace"})
+	assert.Contains(t, plan.Mounts, PlanMount{Source: "/nonexistent-shai-cache", Target: "/cache", Mode: "ro", Origin: "resource:web", Missing: true})
+	assert.Contains(t, plan.Mounts, PlanMount{Target: "/src/.env", Mode: "masked", Origin: "mask"})
+}
+
+func TestPlanSandboxImageOverrideAndDefaultConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "app"), 0o755))
+
+	plan, err := PlanSandbox(EphemeralConfig{WorkingDir: dir, ImageOverride: "example/other:2", Privileged: true})
+	require.NoError(t, err)
+	assert.True(t, plan.DefaultConfig)
+	assert.Empty(t, plan.Trust)
+	assert.Equal(t, "example/other:2", plan.Image)
+	assert.Equal(t, "cli", plan.ImageSource)
+	assert.Equal(t, []string{"--privileged"}, plan.PrivilegedBy)
+}
@@ -0,0 +1,463 @@
+package shai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// poolIdleCommand keeps a pooled sandbox running until it is handed out.
+var poolIdleCommand = []string{"sleep", "infinity"}
+
+// PoolConfig describes a pool of pre-bootstrapped sandboxes.
+type PoolConfig struct {
+	// Sandbox is the template every pooled sandbox is created from. Its
+	// WorkingDir and ConfigFile locate the config; the image and resource
+	// sets are those that apply to the whole workspace plus ResourceSets.
+	// Relative mount sources and vars files resolve against WorkingDir.
+	// ReadWritePaths and PostSetupExec are ignored, and the worktree and
+	// overlay modes are not supported. MaxDuration and IdleTimeout run from
+	// Acquire, not from warm-up.
+	Sandbox EphemeralConfig
+	// Size is the number of sandboxes kept ready.
+	Size int
+	// Dir holds the workspace copies of pooled sandboxes (default
+	// ~/.local/state/shai/pool).
+	Dir string
+}
+
+// PoolStats reports the state of a pool.
+type PoolStats struct {
+	Size    int
+	Ready   int
+	Warming int
+	InUse   int
+	// Acquired counts handed out sandboxes; Waited counts the acquisitions
+	// that found no ready sandbox and had to wait for one.
+	Acquired int
+	Waited   int
+	// WarmFailures counts sandboxes that failed to start.
+	WarmFailures int
+	// AvgWarmup is the mean time from create to ready.
+	AvgWarmup time.Duration
+}
+
+// PoolJob describes the workspace a pooled sandbox is handed out for.
+type PoolJob struct {
+	WorkingDir string
+	// ReadWritePaths are synced back into WorkingDir on Release, apart from
+	// .shai; writes elsewhere are discarded.
+	ReadWritePaths []string
+}
+
+// Pool keeps sandboxes bootstrapped ahead of demand. Each pooled sandbox
+// mounts an empty host directory read-write as its workspace. Acquire copies
+// the job's workspace into it, leaving out masked paths, and Release copies
+// the job's read-write paths back before destroying the sandbox.
+type Pool struct {
+	template   EphemeralConfig
+	size       int
+	dir        string
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	ready      []*poolSlot
+	warming    int
+	inUse      int
+	closed     bool
+	lastErr    error
+	changed    chan struct{}
+	acquired   int
+	waited     int
+	failures   int
+	warmed     int
+	warmupTime time.Duration
+}
+
+type poolSlot struct {
+	dir      string
+	runner   *EphemeralRunner
+	session  *Session
+	patterns []string
+	// limitsStart is closed when the slot is handed out, which starts its
+	// max-duration and idle-timeout clocks.
+	limitsStart chan struct{}
+}
+
+// DefaultPoolDir returns ~/.local/state/shai/pool.
+func DefaultPoolDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "shai", "pool"), nil
+}
+
+// NewPool checks the template config, including trust, and starts warming
+// cfg.Size sandboxes in the background.
+func NewPool(cfg PoolConfig) (*Pool, error) {
+	if cfg.Size < 1 {
+		return nil, errors.New("pool size must be at least 1")
+	}
+	template := cfg.Sandbox
+	if template.Worktree || template.RWMode == RWModeOverlay {
+		return nil, errors.New("pooled sandboxes do not support worktree or overlay mode")
+	}
+	template.ReadWritePaths = nil
+	resolved, err := resolveSandbox(template)
+	if err != nil {
+		return nil, asSetupError(err)
+	}
+	template = resolved.cfg
+	template.ConfigFile = resolved.configPath
+	// Slots run in empty directories; relative resource paths still mean
+	// the template's workspace.
+	template.resourceDir = template.resourceBaseDir()
+	// Trust was settled above; pooled sandboxes must not prompt.
+	template.RequireTrust = false
+	template.ConfirmTrust = nil
+
+	dir := cfg.Dir
+	if dir == "" {
+		if dir, err = DefaultPoolDir(); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create pool directory: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		template: template,
+		size:     cfg.Size,
+		dir:      dir,
+		ctx:      ctx,
+		cancel:   cancel,
+		changed:  make(chan struct{}),
+	}
+	p.mu.Lock()
+	p.fillLocked()
+	p.mu.Unlock()
+	return p, nil
+}
+
+// notifyLocked wakes Acquire calls waiting for a sandbox.
+func (p *Pool) notifyLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// fillLocked starts warming sandboxes until ready plus warming reach the
+// pool size.
+func (p *Pool) fillLocked() {
+	for !p.closed && len(p.ready)+p.warming < p.size {
+		p.warming++
+		p.wg.Add(1)
+		go p.warm()
+	}
+}
+
+func (p *Pool) warm() {
+	defer p.wg.Done()
+	start := time.Now()
+	slot, err := p.newSlot()
+
+	p.mu.Lock()
+	p.warming--
+	closed := p.closed
+	switch {
+	case err != nil:
+		p.failures++
+		p.lastErr = err
+	case !closed:
+		p.warmed++
+		p.warmupTime += time.Since(start)
+		p.ready = append(p.ready, slot)
+		p.wg.Add(1)
+		go p.watchSlot(slot)
+	}
+	p.notifyLocked()
+	p.mu.Unlock()
+	if err == nil && closed {
+		p.destroy(slot)
+	}
+}
+
+func (p *Pool) newSlot() (*poolSlot, error) {
+	dir, err := os.MkdirTemp(p.dir, "slot-")
+	if err != nil {
+		return nil, fmt.Errorf("create pool slot: %w", err)
+	}
+	cfg := p.template
+	cfg.WorkingDir = dir
+	cfg.ReadWritePaths = []string{"."}
+	cfg.PostSetupExec = &ExecSpec{Command: poolIdleCommand}
+	cfg.Stdin = strings.NewReader("")
+	cfg.Stdout = io.Discard
+	cfg.Stderr = io.Discard
+	cfg.ShowProgress = false
+	cfg.ContainerName = ""
+	runner, err := newEphemeralRunner(cfg)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	slot := &poolSlot{
+		dir:         dir,
+		runner:      runner,
+		patterns:    maskPatterns(runner.shaiConfig, runner.resources),
+		limitsStart: make(chan struct{}),
+	}
+	// A ready sandbox only idles; its time limits apply once it is in use.
+	runner.limitsStart = slot.limitsStart
+	slot.session, err = runner.Start(p.ctx)
+	if err == nil {
+		err = slot.session.WaitReady(p.ctx)
+	}
+	if err != nil {
+		p.destroy(slot)
+		return nil, fmt.Errorf("warm pooled sandbox: %w", err)
+	}
+	return slot, nil
+}
+
+// watchSlot drops slot from the ready list and warms a replacement if its
+// sandbox exits before it is handed out.
+func (p *Pool) watchSlot(slot *poolSlot) {
+	defer p.wg.Done()
+	_ = slot.session.Wait(p.ctx)
+	if p.ctx.Err() != nil {
+		return
+	}
+	p.mu.Lock()
+	i := slices.Index(p.ready, slot)
+	if i >= 0 {
+		p.ready = slices.Delete(p.ready, i, i+1)
+		p.fillLocked()
+		p.notifyLocked()
+	}
+	p.mu.Unlock()
+	if i >= 0 {
+		p.destroy(slot)
+	}
+}
+
+// running reports whether the slot's container is still running.
+func (slot *poolSlot) running(ctx context.Context) bool {
+	info, err := slot.session.docker.ContainerInspect(ctx, slot.session.ContainerID)
+	return err == nil && info.State != nil && info.State.Running
+}
+
+// destroy removes a slot's container and workspace copy.
+func (p *Pool) destroy(slot *poolSlot) {
+	if slot.session != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		_ = slot.session.remove(ctx)
+		cancel()
+		_ = slot.session.Close()
+	}
+	_ = slot.runner.Close()
+	_ = os.RemoveAll(slot.dir)
+}
+
+// Acquire hands out a ready sandbox with job's workspace copied in, waiting
+// for one to finish warming if needed.
+func (p *Pool) Acquire(ctx context.Context, job PoolJob) (*PooledSandbox, error) {
+	if job.WorkingDir == "" {
+		return nil, errors.New("pool job needs a working directory")
+	}
+	workingDir, err := filepath.Abs(job.WorkingDir)
+	if err != nil {
+		return nil, asSetupError(err)
+	}
+	mounts, err := NewMountBuilder(workingDir, "", job.ReadWritePaths)
+	if err != nil {
+		return nil, asSetupError(err)
+	}
+
+	waited := false
+	var slot *poolSlot
+	for slot == nil {
+		p.mu.Lock()
+		switch {
+		case p.closed:
+			p.mu.Unlock()
+			return nil, errors.New("pool is closed")
+		case len(p.ready) > 0:
+			slot = p.ready[0]
+			p.ready = p.ready[1:]
+			p.inUse++
+			p.fillLocked()
+			p.mu.Unlock()
+			// The sandbox may have exited before watchSlot noticed.
+			if !slot.running(ctx) {
+				p.release(slot)
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				slot = nil
+				continue
+			}
+			p.mu.Lock()
+			p.acquired++
+			if waited {
+				p.waited++
+			}
+			p.mu.Unlock()
+			continue
+		case p.warming == 0 && p.lastErr != nil:
+			err := p.lastErr
+			p.lastErr = nil
+			p.fillLocked()
+			p.mu.Unlock()
+			return nil, asSetupError(err)
+		}
+		p.fillLocked()
+		changed := p.changed
+		p.mu.Unlock()
+		waited = true
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+
+	copied, err := copyWorkspace(mounts.WorkingDir, slot.dir, slot.patterns)
+	if err != nil {
+		p.release(slot)
+		return nil, asSetupError(err)
+	}
+	close(slot.limitsStart)
+	return &PooledSandbox{
+		ContainerID: slot.session.ContainerID,
+		pool:        p,
+		slot:        slot,
+		workspace:   mounts.WorkingDir,
+		rwPaths:     mounts.ReadWritePaths,
+		copied:      copied,
+	}, nil
+}
+
+// release destroys a handed out slot.
+func (p *Pool) release(slot *poolSlot) {
+	p.destroy(slot)
+	p.mu.Lock()
+	p.inUse--
+	p.notifyLocked()
+	p.mu.Unlock()
+}
+
+// Stats returns the pool's current counters.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := PoolStats{
+		Size:         p.size,
+		Ready:        len(p.ready),
+		Warming:      p.warming,
+		InUse:        p.inUse,
+		Acquired:     p.acquired,
+		Waited:       p.waited,
+		WarmFailures: p.failures,
+	}
+	if p.warmed > 0 {
+		stats.AvgWarmup = p.warmupTime / time.Duration(p.warmed)
+	}
+	return stats
+}
+
+// Close destroys the ready sandboxes and stops warming new ones. Sandboxes
+// already handed out stay usable until released.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	ready := p.ready
+	p.ready = nil
+	p.notifyLocked()
+	p.mu.Unlock()
+
+	for _, slot := range ready {
+		p.destroy(slot)
+	}
+	// Abort sandboxes still warming; handed out ones keep running.
+	p.cancel()
+	p.wg.Wait()
+	return nil
+}
+
+// PooledSandbox is a sandbox handed out by a Pool.
+type PooledSandbox struct {
+	ContainerID string
+
+	pool      *Pool
+	slot      *poolSlot
+	workspace string
+	rwPaths   []string
+	copied    map[string]bool
+	once      sync.Once
+}
+
+// Exec runs spec in the sandbox as the sandbox user. The workspace is the
+// copy of the job's working directory.
+func (s *PooledSandbox) Exec(ctx context.Context, spec ExecSpec) error {
+	return s.slot.session.Exec(ctx, spec)
+}
+
+// Release syncs the job's read-write paths back into its working directory
+// and destroys the sandbox. Later calls do nothing.
+func (s *PooledSandbox) Release() error {
+	var err error
+	s.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		_ = s.slot.session.remove(ctx)
+		cancel()
+		err = syncWorkspace(s.slot.dir, s.workspace, s.rwPaths, s.copied, s.slot.patterns)
+		s.pool.release(s.slot)
+	})
+	return err
+}
+
+// WaitReady blocks until bootstrap has handed over to the session's command,
+// so Exec can start processes in it.
+func (s *Session) WaitReady(ctx context.Context) error {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		ready, err := execStateReady(ctx, s.docker, s.ContainerID)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// remove kills the session's container and removes it with its volumes.
+func (s *Session) remove(ctx context.Context) error {
+	if s.ContainerID == "" {
+		return nil
+	}
+	return s.docker.ContainerRemove(ctx, s.ContainerID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+}
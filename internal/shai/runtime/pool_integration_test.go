@@ -0,0 +1,93 @@
+//go:build integration
+// +build integration
+
+package shai_test
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	shai "github.com/colony-2/shai/internal/shai/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolIntegrationReadySandboxesOutliveTimeLimits(t *testing.T) {
+	workspace := setupAliasWorkspace(t)
+	pool, err := shai.NewPool(shai.PoolConfig{
+		Sandbox: shai.EphemeralConfig{
+			WorkingDir:  workspace,
+			MaxDuration: 2 * time.Second,
+			IdleTimeout: time.Second,
+		},
+		Size: 1,
+		Dir:  t.TempDir(),
+	})
+	require.NoError(t, err)
+	defer pool.Close()
+	waitPoolReady(t, pool)
+
+	// Longer than both limits: a ready sandbox must not be stopped while it
+	// waits to be handed out.
+	time.Sleep(3 * time.Second)
+	require.Equal(t, 1, pool.Stats().Ready)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	sandbox, err := pool.Acquire(ctx, shai.PoolJob{WorkingDir: workspace})
+	require.NoError(t, err)
+	defer sandbox.Release()
+
+	var out bytes.Buffer
+	require.NoError(t, sandbox.Exec(ctx, shai.ExecSpec{Command: []string{"echo", "pooled-ok"}, Stdout: &out}))
+	require.Contains(t, out.String(), "pooled-ok")
+}
+
+func TestPoolIntegrationReplacesExitedSandboxes(t *testing.T) {
+	workspace := setupAliasWorkspace(t)
+	poolDir := t.TempDir()
+	pool, err := shai.NewPool(shai.PoolConfig{
+		Sandbox: shai.EphemeralConfig{WorkingDir: workspace},
+		Size:    1,
+		Dir:     poolDir,
+	})
+	require.NoError(t, err)
+	defer pool.Close()
+	waitPoolReady(t, pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Kill the ready sandbox behind the pool's back.
+	sessions, err := shai.ListSessions(ctx)
+	require.NoError(t, err)
+	killed := 0
+	for _, s := range sessions {
+		if strings.HasPrefix(s.Workspace, poolDir) {
+			require.NoError(t, exec.Command("docker", "kill", s.ContainerID).Run())
+			killed++
+		}
+	}
+	require.Equal(t, 1, killed)
+
+	sandbox, err := pool.Acquire(ctx, shai.PoolJob{WorkingDir: workspace})
+	require.NoError(t, err)
+	defer sandbox.Release()
+	var echo bytes.Buffer
+	require.NoError(t, sandbox.Exec(ctx, shai.ExecSpec{Command: []string{"echo", "replacement-ok"}, Stdout: &echo}))
+	require.Contains(t, echo.String(), "replacement-ok")
+}
+
+func waitPoolReady(t *testing.T, pool *shai.Pool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Minute)
+	for pool.Stats().Ready == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool never became ready: %+v", pool.Stats())
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
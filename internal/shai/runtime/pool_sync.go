@@ -0,0 +1,248 @@
+package shai
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// poolMasked reports whether the workspace-relative slash path rel is kept
+// out of pooled sandboxes. As with MaskMounts, .git and node_modules are not
+// searched.
+func poolMasked(rel string, isDir bool, patterns []string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if maskSkipDirs[part] {
+			return false
+		}
+	}
+	for _, pattern := range patterns {
+		if maskMatches(pattern, rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitConfigRel is the workspace path whose credentials are stripped when it
+// is copied into a pooled sandbox.
+const gitConfigRel = ".git/config"
+
+// copyWorkspace copies the workspace src into the empty pool slot dst and
+// returns the slash paths it copied. Paths matching patterns are left out and
+// .git/config loses any credentials. Modification times are kept so
+// syncWorkspace can spot changed files.
+func copyWorkspace(src, dst string, patterns []string) (map[string]bool, error) {
+	copied := map[string]bool{}
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if p == src {
+				return walkErr
+			}
+			// Unreadable entries are not visible in the sandbox either.
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		slash := filepath.ToSlash(rel)
+		if poolMasked(slash, d.IsDir(), patterns) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if slash == gitConfigRel {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return nil
+			}
+			clean, _ := sanitizeGitConfig(data)
+			copied[slash] = true
+			return os.WriteFile(filepath.Join(dst, rel), clean, 0o644)
+		}
+		if err := copyEntry(p, filepath.Join(dst, rel), d); err != nil {
+			return err
+		}
+		copied[slash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("copy workspace into pooled sandbox: %w", err)
+	}
+	return copied, nil
+}
+
+// syncWorkspace mirrors the read-write paths rwPaths of the pool slot back
+// into the workspace: new and changed entries are copied, and entries of
+// copied (as returned by copyWorkspace) that the job removed are deleted.
+// Masked paths are never touched, nor is a .git/config whose credentials were
+// stripped on the way in. Like the read-only .shai mount in bind mode, the
+// job cannot change the workspace's Shai config.
+func syncWorkspace(slot, workspace string, rwPaths []string, copied map[string]bool, patterns []string) error {
+	skip := func(rel string, isDir bool) bool {
+		if rel == ConfigDirName || strings.HasPrefix(rel, ConfigDirName+"/") {
+			return true
+		}
+		if poolMasked(rel, isDir, patterns) {
+			return true
+		}
+		if rel != gitConfigRel {
+			return false
+		}
+		data, err := os.ReadFile(filepath.Join(workspace, filepath.FromSlash(rel)))
+		if err != nil {
+			return false
+		}
+		_, hasCredentials := sanitizeGitConfig(data)
+		return hasCredentials
+	}
+	for _, rw := range rwPaths {
+		if err := syncTree(slot, workspace, rw, copied, skip); err != nil {
+			return fmt.Errorf("sync %s back to workspace: %w", rw, err)
+		}
+	}
+	return nil
+}
+
+func syncTree(slot, workspace, root string, copied map[string]bool, skip func(rel string, isDir bool) bool) error {
+	relOf := func(base, p string) (string, error) {
+		rel, err := filepath.Rel(base, p)
+		return filepath.ToSlash(rel), err
+	}
+	start := filepath.Join(slot, root)
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if p == start && errors.Is(walkErr, fs.ErrNotExist) {
+				// The job removed the path; the pass below deletes it.
+				return nil
+			}
+			return walkErr
+		}
+		rel, err := relOf(slot, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." && skip(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(workspace, filepath.FromSlash(rel))
+		if rel == "." {
+			// The workspace root itself always exists.
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if existing, err := os.Lstat(target); err == nil {
+			switch {
+			case unchanged(info, existing):
+				return nil
+			case info.IsDir() && existing.IsDir():
+				return os.Chmod(target, info.Mode().Perm())
+			}
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+		return copyEntry(p, target, d)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remove what the job deleted.
+	return filepath.WalkDir(filepath.Join(workspace, root), func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if errors.Is(walkErr, fs.ErrNotExist) {
+				return nil
+			}
+			return walkErr
+		}
+		rel, err := relOf(workspace, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !copied[rel] {
+			// The job never saw it, e.g. it appeared on the host meanwhile.
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if skip(rel, d.IsDir()) {
+			return nil
+		}
+		if _, err := os.Lstat(filepath.Join(slot, filepath.FromSlash(rel))); errors.Is(err, fs.ErrNotExist) {
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+}
+
+// unchanged reports whether a workspace entry already matches its copy. Only
+// regular files are compared; copyWorkspace preserves modification times.
+func unchanged(copied, existing fs.FileInfo) bool {
+	return copied.Mode().IsRegular() && existing.Mode().IsRegular() &&
+		copied.Mode() == existing.Mode() &&
+		copied.Size() == existing.Size() &&
+		copied.ModTime().Equal(existing.ModTime())
+}
+
+// copyEntry copies the directory, symlink or regular file at src to dst.
+// Other file types are skipped.
+func copyEntry(src, dst string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.IsDir():
+		if err := os.Mkdir(dst, info.Mode().Perm()|0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		return nil
+	case info.Mode()&fs.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		_ = os.Remove(dst)
+		return os.Symlink(link, dst)
+	case info.Mode().IsRegular():
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package shai
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/docker/go-connections/nat"
+)
+
+// publishHostIP is the only host address sandbox ports are published on.
+const publishHostIP = "127.0.0.1"
+
+// PublishedPort requests that a sandbox port be reachable from the host.
+// HostPort 0 reuses Port when it is free on the host, otherwise any free port.
+type PublishedPort struct {
+	Port     int
+	HostPort int
+}
+
+// PortBinding reports where a published sandbox port is reachable on the host.
+type PortBinding struct {
+	ContainerPort int
+	HostIP        string
+	HostPort      int
+}
+
+// URL returns an http URL for the binding, convenient for dev servers.
+func (b PortBinding) URL() string {
+	return fmt.Sprintf("http://%s", net.JoinHostPort(b.HostIP, strconv.Itoa(b.HostPort)))
+}
+
+// ParsePublishedPort parses a CLI publish spec: "3000" or "8080:3000" (host:container).
+func ParsePublishedPort(spec string) (PublishedPort, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return PublishedPort{}, fmt.Errorf("empty publish spec")
+	}
+	hostPart, containerPart := "", spec
+	if idx := strings.LastIndex(spec, ":"); idx >= 0 {
+		hostPart, containerPart = spec[:idx], spec[idx+1:]
+	}
+	containerPart = strings.TrimSuffix(containerPart, "/tcp")
+	port, err := strconv.Atoi(containerPart)
+	if err != nil || port < 1 || port > 65535 {
+		return PublishedPort{}, fmt.Errorf("invalid publish spec %q: bad container port", spec)
+	}
+	pp := PublishedPort{Port: port}
+	if hostPart != "" {
+		hostPort, err := strconv.Atoi(hostPart)
+		if err != nil || hostPort < 0 || hostPort > 65535 {
+			return PublishedPort{}, fmt.Errorf("invalid publish spec %q: bad host port", spec)
+		}
+		pp.HostPort = hostPort
+	}
+	return pp, nil
+}
+
+// collectPublishedPorts merges CLI/API requests with resource-set ports-out
+// entries. Explicit requests win when the same container port appears twice.
+func collectPublishedPorts(requested []PublishedPort, resources []*configpkg.ResolvedResource) []PublishedPort {
+	byPort := make(map[int]PublishedPort)
+	for _, res := range resources {
+		if res == nil || res.Spec == nil {
+			continue
+		}
+		for _, pp := range res.Spec.PortsOut {
+			if pp.Port == 0 {
+				continue
+			}
+			if _, ok := byPort[pp.Port]; !ok {
+				byPort[pp.Port] = PublishedPort{Port: pp.Port, HostPort: pp.HostPort}
+			}
+		}
+	}
+	for _, pp := range requested {
+		if pp.Port == 0 {
+			continue
+		}
+		byPort[pp.Port] = pp
+	}
+	out := make([]PublishedPort, 0, len(byPort))
+	for _, pp := range byPort {
+		out = append(out, pp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Port < out[j].Port })
+	return out
+}
+
+// dockerPortConfig converts published ports into docker exposed ports and
+// loopback-only bindings.
+func dockerPortConfig(ports []PublishedPort) (nat.PortSet, nat.PortMap) {
+	if len(ports) == 0 {
+		return nil, nil
+	}
+	exposed := make(nat.PortSet, len(ports))
+	bindings := make(nat.PortMap, len(ports))
+	for _, pp := range ports {
+		port := nat.Port(fmt.Sprintf("%d/tcp", pp.Port))
+		exposed[port] = struct{}{}
+		hostPort := ""
+		switch {
+		case pp.HostPort > 0:
+			hostPort = strconv.Itoa(pp.HostPort)
+		case hostPortFree(pp.Port):
+			hostPort = strconv.Itoa(pp.Port)
+		}
+		bindings[port] = []nat.PortBinding{{HostIP: publishHostIP, HostPort: hostPort}}
+	}
+	return exposed, bindings
+}
+
+// portBindingsFromMap extracts the bindings docker actually assigned.
+func portBindingsFromMap(ports nat.PortMap) []PortBinding {
+	var out []PortBinding
+	for port, bindings := range ports {
+		if port.Proto() != "tcp" {
+			continue
+		}
+		for _, b := range bindings {
+			hostPort, err := strconv.Atoi(b.HostPort)
+			if err != nil {
+				continue
+			}
+			hostIP := b.HostIP
+			if hostIP == "" || hostIP == "0.0.0.0" {
+				hostIP = publishHostIP
+			}
+			out = append(out, PortBinding{
+				ContainerPort: port.Int(),
+				HostIP:        hostIP,
+				HostPort:      hostPort,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ContainerPort != out[j].ContainerPort {
+			return out[i].ContainerPort < out[j].ContainerPort
+		}
+		return out[i].HostPort < out[j].HostPort
+	})
+	return out
+}
+
+func hostPortFree(port int) bool {
+	ln, err := net.Listen("tcp", net.JoinHostPort(publishHostIP, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	_ = ln.Close()
+	return true
+}
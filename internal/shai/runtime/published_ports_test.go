@@ -0,0 +1,79 @@
+package shai
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePublishedPort(t *testing.T) {
+	pp, err := ParsePublishedPort("3000")
+	require.NoError(t, err)
+	require.Equal(t, PublishedPort{Port: 3000}, pp)
+
+	pp, err = ParsePublishedPort("8080:3000")
+	require.NoError(t, err)
+	require.Equal(t, PublishedPort{Port: 3000, HostPort: 8080}, pp)
+
+	pp, err = ParsePublishedPort("5173/tcp")
+	require.NoError(t, err)
+	require.Equal(t, PublishedPort{Port: 5173}, pp)
+
+	for _, bad := range []string{"", "abc", "0", "70000", "x:3000", "3000:"} {
+		_, err := ParsePublishedPort(bad)
+		require.Error(t, err, "spec %q", bad)
+	}
+}
+
+func TestCollectPublishedPortsPrefersExplicitRequests(t *testing.T) {
+	resources := []*configpkg.ResolvedResource{
+		{
+			Name: "web",
+			Spec: &configpkg.ResourceSet{
+				PortsOut: []configpkg.PublishedPort{{Port: 3000, HostPort: 13000}, {Port: 5173}},
+			},
+		},
+	}
+	got := collectPublishedPorts([]PublishedPort{{Port: 3000}, {Port: 8080, HostPort: 18080}}, resources)
+	require.Equal(t, []PublishedPort{
+		{Port: 3000},
+		{Port: 5173},
+		{Port: 8080, HostPort: 18080},
+	}, got)
+}
+
+func TestDockerPortConfigBindsLoopbackOnly(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	busy := ln.Addr().(*net.TCPAddr).Port
+
+	exposed, bindings := dockerPortConfig([]PublishedPort{{Port: busy}, {Port: 3000, HostPort: 13000}})
+	require.Len(t, exposed, 2)
+
+	busyKey := nat.Port(strconv.Itoa(busy) + "/tcp")
+	require.Equal(t, []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: ""}}, bindings[busyKey])
+	require.Equal(t, []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: "13000"}}, bindings["3000/tcp"])
+
+	exposed, bindings = dockerPortConfig(nil)
+	require.Nil(t, exposed)
+	require.Nil(t, bindings)
+}
+
+func TestPortBindingsFromMap(t *testing.T) {
+	got := portBindingsFromMap(nat.PortMap{
+		"5173/tcp": {{HostIP: "127.0.0.1", HostPort: "49153"}},
+		"3000/tcp": {{HostIP: "", HostPort: "3000"}},
+		"53/udp":   {{HostIP: "127.0.0.1", HostPort: "5353"}},
+		"8080/tcp": nil,
+	})
+	require.Equal(t, []PortBinding{
+		{ContainerPort: 3000, HostIP: "127.0.0.1", HostPort: 3000},
+		{ContainerPort: 5173, HostIP: "127.0.0.1", HostPort: 49153},
+	}, got)
+	require.Equal(t, "http://127.0.0.1:49153", got[1].URL())
+}
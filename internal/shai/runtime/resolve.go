@@ -0,0 +1,170 @@
+package shai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/colony-2/shai/internal/shai/runtime/alias"
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+)
+
+// resolvedSandbox is everything a sandbox is derived from: the loaded config
+// and what it selects for the request. Resolving touches neither Docker nor
+// the host beyond reading files.
+type resolvedSandbox struct {
+	// cfg is the request with defaults filled in.
+	cfg           EphemeralConfig
+	configPath    string
+	usedDefault   bool
+	hostEnv       map[string]string
+	shaiCfg       *configpkg.Config
+	mountBuilder  *MountBuilder
+	workspace     string
+	resources     []*configpkg.ResolvedResource
+	resourceNames []string
+	callEntries   []*alias.Entry
+	limits        configpkg.ResolvedLimits
+	image         string
+	// imageSource is "cli", "apply" or empty for the config's image.
+	imageSource string
+}
+
+// resolveSandbox loads the config for cfg, checks that it is trusted and
+// resolves the resources, mounts, limits and image it selects.
+func resolveSandbox(cfg EphemeralConfig) (*resolvedSandbox, error) {
+	if cfg.WorkingDir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get working directory: %w", err)
+		}
+		cfg.WorkingDir = wd
+	}
+
+	if !cfg.Verbose && os.Getenv("SHAI_FORCE_VERBOSE") == "1" {
+		cfg.Verbose = true
+	}
+
+	hostEnv := hostEnvMap()
+	if strings.TrimSpace(cfg.HostUID) == "" || strings.TrimSpace(cfg.HostGID) == "" {
+		uid, gid := hostUserIDs()
+		if strings.TrimSpace(cfg.HostUID) == "" {
+			cfg.HostUID = uid
+		}
+		if strings.TrimSpace(cfg.HostGID) == "" {
+			cfg.HostGID = gid
+		}
+	}
+	configPath := cfg.ConfigFile
+	if configPath == "" {
+		configPath = filepath.Join(cfg.WorkingDir, DefaultConfigRelPath)
+	}
+	shaiCfg, usedDefault, err := configpkg.LoadOrDefault(configPath, hostEnv, cfg.TemplateVars, configpkg.LoadOptions{UserConfig: cfg.UserConfig, WorkingDir: cfg.resourceBaseDir()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shai config: %w", err)
+	}
+	if err := checkTrust(cfg, configPath, usedDefault, shaiCfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Worktree {
+		if len(cfg.ReadWritePaths) > 0 {
+			return nil, errors.New("worktree mode mounts its checkout read-write; it cannot be combined with read-write paths")
+		}
+		cfg.ReadWritePaths = []string{"."}
+	}
+	mountBuilder, err := NewMountBuilder(cfg.WorkingDir, shaiCfg.Workspace, cfg.ReadWritePaths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mount builder: %w", err)
+	}
+	if err := validateRWMode(cfg.RWMode); err != nil {
+		return nil, err
+	}
+
+	workspace := effectiveWorkspace(shaiCfg.Workspace, mountBuilder.ReadWritePaths)
+	shaiCfg.Workspace = workspace
+
+	resources, resourceNames, applyImageOverride, err := resolvedResources(shaiCfg, mountBuilder.ReadWritePaths, cfg.ResourceSets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve resources: %w", err)
+	}
+	callEntries, err := callEntriesFromResources(resources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve calls: %w", err)
+	}
+	limits, err := collectLimits(shaiCfg, resources, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve limits: %w", err)
+	}
+	image, imageSource := chooseImage(shaiCfg.Image, cfg.ImageOverride, applyImageOverride)
+
+	return &resolvedSandbox{
+		cfg:           cfg,
+		configPath:    configPath,
+		usedDefault:   usedDefault,
+		hostEnv:       hostEnv,
+		shaiCfg:       shaiCfg,
+		mountBuilder:  mountBuilder,
+		workspace:     workspace,
+		resources:     resources,
+		resourceNames: resourceNames,
+		callEntries:   callEntries,
+		limits:        limits,
+		image:         image,
+		imageSource:   imageSource,
+	}, nil
+}
+
+// fingerprint identifies what the sandbox is built from: the rendered config,
+// image, user, mounts and runtime options. A kept sandbox whose fingerprint no
+// longer matches is replaced.
+func (s *resolvedSandbox) fingerprint() (string, error) {
+	data, err := json.Marshal(struct {
+		WorkingDir     string
+		Config         *configpkg.Config
+		Image          string
+		User           string
+		ReadWritePaths []string
+		RWMode         string
+		ResourceSets   []string
+		Privileged     bool
+		PublishedPorts []PublishedPort
+		Limits         configpkg.ResolvedLimits
+		HostUID        string
+		HostGID        string
+	}{
+		WorkingDir:     s.cfg.WorkingDir,
+		Config:         s.shaiCfg,
+		Image:          s.image,
+		User:           s.cfg.UserOverride,
+		ReadWritePaths: s.mountBuilder.ReadWritePaths,
+		RWMode:         s.cfg.RWMode,
+		ResourceSets:   s.resourceNames,
+		Privileged:     s.cfg.Privileged,
+		PublishedPorts: s.cfg.PublishedPorts,
+		Limits:         s.limits,
+		HostUID:        s.cfg.HostUID,
+		HostGID:        s.cfg.HostGID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("fingerprint sandbox: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:12]), nil
+}
+
+// Fingerprint resolves cfg as NewEphemeralRunner does, including the trust
+// check, and returns the fingerprint its container is labelled with.
+func Fingerprint(cfg EphemeralConfig) (string, error) {
+	resolved, err := resolveSandbox(cfg)
+	if err != nil {
+		return "", asSetupError(err)
+	}
+	fp, err := resolved.fingerprint()
+	return fp, asSetupError(err)
+}
@@ -0,0 +1,59 @@
+package shai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprintTracksConfigImageAndReadWriteSet(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "app"), 0o755))
+	base := EphemeralConfig{WorkingDir: dir}
+
+	fp, err := Fingerprint(base)
+	require.NoError(t, err)
+	again, err := Fingerprint(base)
+	require.NoError(t, err)
+	assert.Equal(t, fp, again)
+
+	withCommand := base
+	withCommand.PostSetupExec = &ExecSpec{Command: []string{"make", "test"}}
+	withCommand.ContainerName = "agent-1"
+	same, err := Fingerprint(withCommand)
+	require.NoError(t, err)
+	assert.Equal(t, fp, same, "commands and names do not change the sandbox")
+
+	image := base
+	image.ImageOverride = "example/other:latest"
+	changed, err := Fingerprint(image)
+	require.NoError(t, err)
+	assert.NotEqual(t, fp, changed)
+
+	rw := base
+	rw.ReadWritePaths = []string{"app"}
+	changed, err = Fingerprint(rw)
+	require.NoError(t, err)
+	assert.NotEqual(t, fp, changed)
+
+	configDir := filepath.Join(dir, ".shai")
+	require.NoError(t, os.Mkdir(configDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(`
+type: shai-sandbox
+version: 1
+image: example/custom:1
+resources:
+  test:
+    http:
+      - example.com
+apply:
+  - path: ./
+    resources: [test]
+`), 0o644))
+	changed, err = Fingerprint(base)
+	require.NoError(t, err)
+	assert.NotEqual(t, fp, changed)
+}
@@ -0,0 +1,112 @@
+package shai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+)
+
+const (
+	// secretsMountDir is the tmpfs that receives vars delivered with as-file.
+	secretsMountDir = "/run/shai-secrets"
+	// secretsStageDir is where as-file values are staged under
+	// bootstrapPrivateDir; bootstrap moves them onto the tmpfs and deletes the
+	// staged copy.
+	secretsStageDir = "secrets"
+
+	secretCommandTimeout = 30 * time.Second
+)
+
+// keychainCommand returns the host command used to read a keychain entry.
+// It is a variable so tests can substitute a fake lookup.
+var keychainCommand = func(name string) ([]string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"security", "find-generic-password", "-s", name, "-w"}, nil
+	case "linux":
+		return []string{"secret-tool", "lookup", "service", name}, nil
+	default:
+		return nil, fmt.Errorf("keychain lookups are not supported on %s", runtime.GOOS)
+	}
+}
+
+// resolveVar produces the value for a vars entry on the host.
+func (r *EphemeralRunner) resolveVar(vm configpkg.VarMapping) (string, error) {
+	switch {
+	case strings.TrimSpace(vm.Source) != "":
+		source := strings.TrimSpace(vm.Source)
+		value, ok := r.hostEnv[source]
+		if !ok {
+			return "", fmt.Errorf("host env %q not set", source)
+		}
+		return value, nil
+	case strings.TrimSpace(vm.File) != "":
+		return r.readSecretFile(strings.TrimSpace(vm.File))
+	case strings.TrimSpace(vm.Command) != "":
+		args := []string{"/bin/sh", "-c", vm.Command}
+		value, err := r.runSecretCommand(args)
+		if err != nil {
+			return "", fmt.Errorf("secret command %q: %w", vm.Command, err)
+		}
+		return value, nil
+	case strings.TrimSpace(vm.Keychain) != "":
+		args, err := keychainCommand(strings.TrimSpace(vm.Keychain))
+		if err != nil {
+			return "", err
+		}
+		value, err := r.runSecretCommand(args)
+		if err != nil {
+			return "", fmt.Errorf("keychain entry %q: %w", vm.Keychain, err)
+		}
+		return value, nil
+	default:
+		return "", errors.New("vars entry missing source")
+	}
+}
+
+func (r *EphemeralRunner) readSecretFile(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home := strings.TrimSpace(r.hostEnv["HOME"])
+		if home == "" {
+			return "", fmt.Errorf("secret file %s: HOME not set", path)
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(r.config.resourceBaseDir(), path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func (r *EphemeralRunner) runSecretCommand(args []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = r.config.resourceBaseDir()
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("timed out after %s", secretCommandTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
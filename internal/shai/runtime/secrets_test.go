@@ -0,0 +1,115 @@
+package shai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectEnvMappingsResolvesSecretSources(t *testing.T) {
+	home := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".config", "openai"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".config", "openai", "key"), []byte("sk-file\n"), 0o600))
+
+	orig := keychainCommand
+	keychainCommand = func(name string) ([]string, error) {
+		return []string{"/bin/sh", "-c", "echo keychain-" + name}, nil
+	}
+	t.Cleanup(func() { keychainCommand = orig })
+
+	runner := &EphemeralRunner{
+		config:  EphemeralConfig{WorkingDir: t.TempDir()},
+		hostEnv: map[string]string{"HOME": home, "TOKEN": "from-env"},
+		resources: []*configpkg.ResolvedResource{
+			{
+				Name: "secrets",
+				Spec: &configpkg.ResourceSet{
+					Vars: []configpkg.VarMapping{
+						{Source: "TOKEN"},
+						{File: "~/.config/openai/key", Target: "OPENAI_API_KEY"},
+						{Command: "printf 'cmd-secret\\n'", Target: "VAULT_TOKEN", AsFile: true},
+						{Keychain: "npm", Target: "NPM_TOKEN"},
+					},
+				},
+			},
+		},
+	}
+
+	envs, files, err := runner.collectEnvMappings()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"TOKEN":          "from-env",
+		"OPENAI_API_KEY": "sk-file",
+		"NPM_TOKEN":      "keychain-npm",
+	}, envs)
+	require.Equal(t, map[string]string{"VAULT_TOKEN": "cmd-secret"}, files)
+}
+
+func TestCollectEnvMappingsReportsFailingCommand(t *testing.T) {
+	runner := &EphemeralRunner{
+		config:  EphemeralConfig{WorkingDir: t.TempDir()},
+		hostEnv: map[string]string{},
+		resources: []*configpkg.ResolvedResource{
+			{
+				Name: "secrets",
+				Spec: &configpkg.ResourceSet{
+					Vars: []configpkg.VarMapping{
+						{Command: "echo locked >&2; exit 1", Target: "VAULT_TOKEN"},
+					},
+				},
+			},
+		},
+	}
+	_, _, err := runner.collectEnvMappings()
+	require.ErrorContains(t, err, "locked")
+}
+
+func TestSecretFilesStagedOnTmpfs(t *testing.T) {
+	tDir := t.TempDir()
+	mountBuilder, err := NewMountBuilder(tDir, "", nil)
+	require.NoError(t, err)
+
+	runner := &EphemeralRunner{
+		config:       EphemeralConfig{WorkingDir: tDir},
+		shaiConfig:   &configpkg.Config{User: "shai", Workspace: "/src"},
+		mountBuilder: mountBuilder,
+		image:        "example",
+		hostEnv:      map[string]string{"TOKEN": "super-secret"},
+		resources: []*configpkg.ResolvedResource{
+			{
+				Name: "secrets",
+				Spec: &configpkg.ResourceSet{
+					Vars: []configpkg.VarMapping{{Source: "TOKEN", Target: "API_TOKEN", AsFile: true}},
+				},
+			},
+		},
+	}
+	defer runner.Close()
+
+	cfg, hostCfg, err := runner.buildDockerConfigs(false, "sandbox-test")
+	require.NoError(t, err)
+	require.Contains(t, cfg.Cmd, "--secret-file")
+	require.Contains(t, cfg.Cmd, "API_TOKEN")
+	for _, arg := range cfg.Cmd {
+		require.NotContains(t, arg, "super-secret")
+	}
+
+	archive, err := runner.privateArchive()
+	require.NoError(t, err)
+	entries := readPrivateArchive(t, archive)
+	require.Equal(t, []string{"private/", "private/secrets/", "private/secrets/API_TOKEN"}, sortedEntryNames(entries))
+	require.Equal(t, "super-secret", entries["private/secrets/API_TOKEN"].data)
+
+	var tmpfs *mount.Mount
+	for i := range hostCfg.Mounts {
+		if hostCfg.Mounts[i].Target == secretsMountDir {
+			tmpfs = &hostCfg.Mounts[i]
+		}
+	}
+	require.NotNil(t, tmpfs)
+	require.Equal(t, mount.TypeTmpfs, tmpfs.Type)
+}
@@ -0,0 +1,212 @@
+package shai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// ExitCodeSessionLimit is the process exit code used when a session is
+// stopped for exceeding max-duration or idle-timeout, matching timeout(1).
+const ExitCodeSessionLimit = 124
+
+// SessionLimitError reports that shai stopped a session because a time limit
+// fired.
+type SessionLimitError struct {
+	// Limit names the limit that fired: "max-duration" or "idle-timeout".
+	Limit    string
+	Duration time.Duration
+}
+
+func (e *SessionLimitError) Error() string {
+	if e.Limit == "idle-timeout" {
+		return fmt.Sprintf("session stopped after %s without terminal activity or running commands (idle-timeout)", e.Duration)
+	}
+	return fmt.Sprintf("session stopped after reaching its %s limit (max-duration)", e.Duration)
+}
+
+// ExitCode returns ExitCodeSessionLimit.
+func (e *SessionLimitError) ExitCode() int {
+	return ExitCodeSessionLimit
+}
+
+// activityTracker records the last time terminal input or output was seen.
+type activityTracker struct {
+	last atomic.Int64
+}
+
+func newActivityTracker() *activityTracker {
+	a := &activityTracker{}
+	a.touch()
+	return a
+}
+
+func (a *activityTracker) touch() {
+	a.last.Store(time.Now().UnixNano())
+}
+
+func (a *activityTracker) idleFor() time.Duration {
+	return time.Since(time.Unix(0, a.last.Load()))
+}
+
+func (a *activityTracker) reader(r io.Reader) io.Reader {
+	return activityReader{r: r, a: a}
+}
+
+func (a *activityTracker) writer(w io.Writer) io.Writer {
+	return activityWriter{w: w, a: a}
+}
+
+type activityReader struct {
+	r io.Reader
+	a *activityTracker
+}
+
+func (r activityReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.a.touch()
+	}
+	return n, err
+}
+
+type activityWriter struct {
+	w io.Writer
+	a *activityTracker
+}
+
+func (w activityWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.a.touch()
+	}
+	return w.w.Write(p)
+}
+
+// watchSessionLimits delivers a *SessionLimitError when the session runs past
+// maxDuration or stays idle for idleTimeout. Zero disables either check. The
+// channel is never written when neither limit is set. Before the session
+// counts as idle, busy, when set, is asked whether something without
+// terminal traffic, such as an exec, is still running in it. Both clocks
+// start when start is closed, or at once if it is nil.
+func watchSessionLimits(ctx context.Context, maxDuration, idleTimeout time.Duration, activity *activityTracker, busy func(context.Context) bool, start <-chan struct{}) <-chan *SessionLimitError {
+	out := make(chan *SessionLimitError, 1)
+	if maxDuration <= 0 && idleTimeout <= 0 {
+		return out
+	}
+	interval := time.Second
+	for _, d := range []time.Duration{maxDuration, idleTimeout} {
+		if d > 0 && d/4 < interval {
+			interval = d / 4
+		}
+	}
+	go func() {
+		if start != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-start:
+			}
+			activity.touch()
+		}
+		started := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if maxDuration > 0 && time.Since(started) >= maxDuration {
+				out <- &SessionLimitError{Limit: "max-duration", Duration: maxDuration}
+				return
+			}
+			if idleTimeout > 0 && activity.idleFor() >= idleTimeout {
+				if busy != nil && busy(ctx) {
+					activity.touch()
+					continue
+				}
+				out <- &SessionLimitError{Limit: "idle-timeout", Duration: idleTimeout}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// execRunning reports whether a docker exec, such as one started by Exec or
+// shai exec, is running in the container.
+func execRunning(ctx context.Context, docker *client.Client, containerID string) bool {
+	info, err := docker.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return false
+	}
+	for _, id := range info.ExecIDs {
+		exec, err := docker.ContainerExecInspect(ctx, id)
+		if err == nil && exec.Running {
+			return true
+		}
+	}
+	return false
+}
+
+// stopForSessionLimit warns inside the container, then stops it gracefully
+// within GracefulStopTimeout.
+func (r *EphemeralRunner) stopForSessionLimit(ctx context.Context, containerID string, limitErr *SessionLimitError) {
+	r.warnInContainer(ctx, containerID, fmt.Sprintf("shai: %s; stopping the sandbox", limitErr.Error()))
+
+	timeout := r.config.GracefulStopTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	secs := int(timeout.Seconds())
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout+10*time.Second)
+	defer cancel()
+	if err := r.docker.ContainerStop(stopCtx, containerID, container.StopOptions{Timeout: &secs}); err != nil {
+		fmt.Fprintf(os.Stderr, "shai: failed to stop sandbox: %v\n", err)
+	}
+}
+
+// warnInContainer writes msg to the terminal of the sandbox's main process so
+// the agent or user sees why the session is ending. Opening another process's
+// fds needs a matching uid, so the sandbox user is tried before root (which
+// owns PID 1 when bootstrap switched users with su).
+func (r *EphemeralRunner) warnInContainer(ctx context.Context, containerID, msg string) {
+	execCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	users := []string{"root"}
+	if r.hostUID != "" {
+		users = []string{r.hostUID, "root"}
+	}
+	for _, user := range users {
+		resp, err := r.docker.ContainerExecCreate(execCtx, containerID, container.ExecOptions{
+			User: user,
+			Cmd:  []string{"/bin/sh", "-c", `printf '\r\n%s\r\n' "$1" >/proc/1/fd/1`, "sh", msg},
+		})
+		if err != nil {
+			return
+		}
+		if err := r.docker.ContainerExecStart(execCtx, resp.ID, container.ExecStartOptions{Detach: true}); err != nil {
+			return
+		}
+		for {
+			info, err := r.docker.ContainerExecInspect(execCtx, resp.ID)
+			if err != nil {
+				return
+			}
+			if !info.Running {
+				if info.ExitCode == 0 {
+					return
+				}
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
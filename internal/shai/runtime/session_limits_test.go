@@ -0,0 +1,103 @@
+package shai
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchSessionLimitsMaxDuration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	activity := newActivityTracker()
+	w := activity.writer(io.Discard)
+
+	limitCh := watchSessionLimits(ctx, 80*time.Millisecond, time.Hour, activity, nil, nil)
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case limitErr := <-limitCh:
+			require.Equal(t, "max-duration", limitErr.Limit)
+			require.Equal(t, ExitCodeSessionLimit, limitErr.ExitCode())
+			require.Contains(t, limitErr.Error(), "80ms")
+			return
+		case <-deadline:
+			t.Fatal("max-duration did not fire")
+		case <-time.After(10 * time.Millisecond):
+			_, _ = w.Write([]byte("busy"))
+		}
+	}
+}
+
+func TestWatchSessionLimitsIdleTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	activity := newActivityTracker()
+
+	limitCh := watchSessionLimits(ctx, 0, 60*time.Millisecond, activity, nil, nil)
+	select {
+	case limitErr := <-limitCh:
+		require.Equal(t, "idle-timeout", limitErr.Limit)
+		require.Contains(t, limitErr.Error(), "without terminal activity or running commands")
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle-timeout did not fire")
+	}
+}
+
+func TestWatchSessionLimitsDisabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	limitCh := watchSessionLimits(ctx, 0, 0, newActivityTracker(), nil, nil)
+	select {
+	case <-limitCh:
+		t.Fatal("no limit should fire when none are set")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchSessionLimitsIdleTimeoutWaitsForBusySession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var running atomic.Bool
+	running.Store(true)
+	busy := func(context.Context) bool { return running.Load() }
+
+	limitCh := watchSessionLimits(ctx, 0, 40*time.Millisecond, newActivityTracker(), busy, nil)
+	select {
+	case <-limitCh:
+		t.Fatal("idle-timeout fired while an exec was running")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	running.Store(false)
+	select {
+	case limitErr := <-limitCh:
+		require.Equal(t, "idle-timeout", limitErr.Limit)
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle-timeout did not fire once the exec ended")
+	}
+}
+
+func TestWatchSessionLimitsWaitForStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := make(chan struct{})
+
+	limitCh := watchSessionLimits(ctx, 40*time.Millisecond, 40*time.Millisecond, newActivityTracker(), nil, start)
+	select {
+	case <-limitCh:
+		t.Fatal("a limit fired before the clocks started")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(start)
+	select {
+	case <-limitCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no limit fired after the clocks started")
+	}
+}
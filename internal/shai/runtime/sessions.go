@@ -0,0 +1,296 @@
+package shai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/moby/term"
+)
+
+// Labels recorded on every sandbox container.
+const (
+	LabelSession      = "shai.session"
+	LabelWorkspace    = "shai.workspace"
+	LabelReadWrite    = "shai.read-write"
+	LabelResourceSets = "shai.resource-sets"
+	LabelStarted      = "shai.started"
+	LabelHostPID      = "shai.host-pid"
+	LabelFingerprint  = "shai.fingerprint"
+)
+
+// SessionInfo describes a running sandbox container.
+type SessionInfo struct {
+	Name           string
+	ContainerID    string
+	State          string
+	Workspace      string
+	ReadWritePaths []string
+	ResourceSets   []string
+	Started        time.Time
+	// HostPID is the shai process that launched the sandbox.
+	HostPID int
+	// Fingerprint identifies the config, image and mounts the sandbox was
+	// created from.
+	Fingerprint string
+}
+
+// sessionLabels describes the runner's session for shai ps.
+func (r *EphemeralRunner) sessionLabels() map[string]string {
+	return map[string]string{
+		LabelSession:      "1",
+		LabelWorkspace:    r.config.WorkingDir,
+		LabelReadWrite:    strings.Join(r.mountBuilder.ReadWritePaths, ","),
+		LabelResourceSets: strings.Join(r.resourceNames, ","),
+		LabelStarted:      time.Now().UTC().Format(time.RFC3339),
+		LabelHostPID:      strconv.Itoa(os.Getpid()),
+		LabelFingerprint:  r.fingerprint,
+	}
+}
+
+// sessionNamePattern is the container name syntax docker accepts.
+var sessionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// NewSessionName returns a fresh name of the form shai-<random>, as used when
+// no container name is configured.
+func NewSessionName() string {
+	return generateContainerName()
+}
+
+// ValidateSessionName reports whether name can be used as a container name.
+func ValidateSessionName(name string) error {
+	if !sessionNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid session name %q (use letters, digits, '_', '.' and '-')", name)
+	}
+	return nil
+}
+
+// ListSessions returns the running sandboxes, oldest first.
+func ListSessions(ctx context.Context) ([]SessionInfo, error) {
+	docker, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer docker.Close()
+	containers, err := docker.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelSession)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+	sessions := make([]SessionInfo, 0, len(containers))
+	for _, c := range containers {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		sessions = append(sessions, sessionFromLabels(name, c.ID, c.State, c.Labels))
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Started.Before(sessions[j].Started) })
+	return sessions, nil
+}
+
+func sessionFromLabels(name, id, state string, labels map[string]string) SessionInfo {
+	info := SessionInfo{
+		Name:           name,
+		ContainerID:    id,
+		State:          state,
+		Workspace:      labels[LabelWorkspace],
+		ReadWritePaths: splitLabelList(labels[LabelReadWrite]),
+		ResourceSets:   splitLabelList(labels[LabelResourceSets]),
+		Fingerprint:    labels[LabelFingerprint],
+	}
+	info.Started, _ = time.Parse(time.RFC3339, labels[LabelStarted])
+	info.HostPID, _ = strconv.Atoi(labels[LabelHostPID])
+	return info
+}
+
+func splitLabelList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// findSession inspects the sandbox container called name, refusing
+// containers that shai did not start.
+func findSession(ctx context.Context, docker *client.Client, name string) (container.InspectResponse, error) {
+	info, err := docker.ContainerInspect(ctx, name)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return info, fmt.Errorf("no shai session named %q", name)
+		}
+		return info, fmt.Errorf("inspect %s: %w", name, err)
+	}
+	if info.Config == nil || info.Config.Labels[LabelSession] == "" {
+		return info, fmt.Errorf("container %q is not a shai session", name)
+	}
+	if info.State == nil || !info.State.Running {
+		return info, fmt.Errorf("shai session %q is not running", name)
+	}
+	return info, nil
+}
+
+// AttachSession connects the terminal to a running sandbox until it exits or
+// the user detaches with ctrl-p ctrl-q.
+func AttachSession(ctx context.Context, name string) error {
+	docker, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+	info, err := findSession(ctx, docker, name)
+	if err != nil {
+		return err
+	}
+	hijacked, err := docker.ContainerAttach(ctx, info.ID, container.AttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("attach container: %w", err)
+	}
+	defer hijacked.Close()
+
+	stdinFD := os.Stdin.Fd()
+	useTTY := info.Config.Tty
+	if useTTY && term.IsTerminal(stdinFD) {
+		if st, err := term.MakeRaw(stdinFD); err == nil {
+			defer term.RestoreTerminal(stdinFD, st)
+		}
+		resize := func(opts container.ResizeOptions) error {
+			return docker.ContainerResize(context.Background(), info.ID, opts)
+		}
+		if stop := startTTYResizeWatcher(ctx, stdinFD, resize); stop != nil {
+			defer stop()
+		}
+	}
+
+	go func() {
+		_, _ = io.Copy(hijacked.Conn, os.Stdin)
+	}()
+	if useTTY {
+		_, err = io.Copy(os.Stdout, hijacked.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(os.Stdout, os.Stderr, hijacked.Reader)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// StopSession stops a running sandbox, giving it timeout to exit before it
+// is killed.
+func StopSession(ctx context.Context, name string, timeout time.Duration) error {
+	docker, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+	info, err := findSession(ctx, docker, name)
+	if err != nil {
+		return err
+	}
+	secs := int(timeout.Seconds())
+	if err := docker.ContainerStop(ctx, info.ID, container.StopOptions{Timeout: &secs}); err != nil {
+		return fmt.Errorf("stop %s: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveSession kills and removes the sandbox called name. Unlike
+// StopSession it returns only once the name is free again.
+func RemoveSession(ctx context.Context, name string) error {
+	docker, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+	info, err := docker.ContainerInspect(ctx, name)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("inspect %s: %w", name, err)
+	}
+	if info.Config == nil || info.Config.Labels[LabelSession] == "" {
+		return fmt.Errorf("container %q is not a shai session", name)
+	}
+	err = docker.ContainerRemove(ctx, info.ID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("remove %s: %w", name, err)
+	}
+	return nil
+}
+
+// WaitSessionReady blocks until bootstrap in the sandbox called name has
+// handed over to its command, so exec can start processes in it.
+func WaitSessionReady(ctx context.Context, name string) error {
+	docker, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer docker.Close()
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		info, err := findSession(ctx, docker, name)
+		if err != nil {
+			return err
+		}
+		ready, err := execStateReady(ctx, docker, info.ID)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// execStateReady reports whether bootstrap has written the exec state.
+func execStateReady(ctx context.Context, docker *client.Client, containerID string) (bool, error) {
+	created, err := docker.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		User: "root",
+		Cmd:  []string{"test", "-r", execStatePath},
+	})
+	if err != nil {
+		return false, fmt.Errorf("create exec: %w", err)
+	}
+	if err := docker.ContainerExecStart(ctx, created.ID, container.ExecStartOptions{}); err != nil {
+		return false, fmt.Errorf("start exec: %w", err)
+	}
+	for {
+		result, err := docker.ContainerExecInspect(ctx, created.ID)
+		if err != nil {
+			return false, fmt.Errorf("inspect exec: %w", err)
+		}
+		if !result.Running {
+			return result.ExitCode == 0, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package shai
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildDockerConfigsLabelsSession(t *testing.T) {
+	tDir := t.TempDir()
+	require.NoError(t, os.Mkdir(tDir+"/app", 0o755))
+	mountBuilder, err := NewMountBuilder(tDir, "", []string{"app"})
+	require.NoError(t, err)
+
+	runner := &EphemeralRunner{
+		config:        EphemeralConfig{WorkingDir: tDir},
+		shaiConfig:    &configpkg.Config{User: "shai", Workspace: "/src"},
+		mountBuilder:  mountBuilder,
+		image:         "example",
+		resourceNames: []string{"base", "go"},
+	}
+	defer runner.Close()
+
+	cfg, _, err := runner.buildDockerConfigs(false, "sandbox-test")
+	require.NoError(t, err)
+
+	info := sessionFromLabels("sandbox-test", "abc", "running", cfg.Labels)
+	assert.Equal(t, tDir, info.Workspace)
+	assert.Equal(t, []string{"app"}, info.ReadWritePaths)
+	assert.Equal(t, []string{"base", "go"}, info.ResourceSets)
+	assert.Equal(t, os.Getpid(), info.HostPID)
+	assert.False(t, info.Started.IsZero())
+	assert.Equal(t, "1", cfg.Labels[LabelSession])
+	assert.Equal(t, strconv.Itoa(os.Getpid()), cfg.Labels[LabelHostPID])
+}
+
+func TestSessionFromLabelsEmptyLists(t *testing.T) {
+	info := sessionFromLabels("shai-1", "abc", "running", map[string]string{LabelSession: "1"})
+	assert.Nil(t, info.ReadWritePaths)
+	assert.Nil(t, info.ResourceSets)
+	assert.True(t, info.Started.IsZero())
+}
+
+func TestValidateSessionName(t *testing.T) {
+	assert.NoError(t, ValidateSessionName(NewSessionName()))
+	assert.NoError(t, ValidateSessionName("agent-1.b_c"))
+	for _, name := range []string{"", "a", "-agent", "../x", "a/b", "a b"} {
+		assert.Error(t, ValidateSessionName(name), name)
+	}
+}
@@ -0,0 +1,146 @@
+package sshagent
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Destination is a host the proxy may sign for, typically from a resource
+// set's ports list.
+type Destination struct {
+	Host string
+	Port int
+}
+
+// knownHost is a single known_hosts entry.
+type knownHost struct {
+	patterns []string
+	keyBlob  []byte
+}
+
+// KnownHosts matches host keys against OpenSSH known_hosts entries.
+type KnownHosts struct {
+	entries []knownHost
+}
+
+// LoadKnownHosts reads the given known_hosts files, skipping missing ones.
+func LoadKnownHosts(paths ...string) (*KnownHosts, error) {
+	kh := &KnownHosts{}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		kh.entries = append(kh.entries, parseKnownHosts(data)...)
+	}
+	return kh, nil
+}
+
+func parseKnownHosts(data []byte) []knownHost {
+	var out []knownHost
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if strings.HasPrefix(fields[0], "@") {
+			// @cert-authority and @revoked entries never vouch for a plain host key.
+			continue
+		}
+		if len(fields) < 3 {
+			continue
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			continue
+		}
+		out = append(out, knownHost{patterns: strings.Split(fields[0], ","), keyBlob: blob})
+	}
+	return out
+}
+
+// Allows reports whether hostKey is recorded for any of the destinations.
+func (k *KnownHosts) Allows(hostKey []byte, dests []Destination) bool {
+	if k == nil {
+		return false
+	}
+	for _, entry := range k.entries {
+		if !bytes.Equal(entry.keyBlob, hostKey) {
+			continue
+		}
+		for _, dest := range dests {
+			if entry.matches(dest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e knownHost) matches(dest Destination) bool {
+	name := strings.ToLower(strings.TrimSpace(dest.Host))
+	if name == "" {
+		return false
+	}
+	if dest.Port != 0 && dest.Port != 22 {
+		name = "[" + name + "]:" + strconv.Itoa(dest.Port)
+	}
+	matched := false
+	for _, pattern := range e.patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if !hostPatternMatches(pattern, name) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+func hostPatternMatches(pattern, name string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[3:], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+		want, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(name))
+		return hmac.Equal(mac.Sum(nil), want)
+	}
+	pattern = strings.ToLower(pattern)
+	if ok, err := path.Match(pattern, name); err == nil && ok {
+		return true
+	}
+	// Plain entries may also be recorded by IP; accept exact literal matches.
+	if ip := net.ParseIP(strings.Trim(pattern, "[]")); ip != nil {
+		return pattern == name
+	}
+	return false
+}
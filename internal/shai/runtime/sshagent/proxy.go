@@ -0,0 +1,252 @@
+package sshagent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Config controls which signing requests the proxy forwards upstream.
+type Config struct {
+	// Upstream is the host agent socket (usually $SSH_AUTH_SOCK).
+	Upstream string
+	// SocketPath is where the proxy listens; its directory is mounted into the sandbox.
+	SocketPath string
+	// Keys are the fingerprints the sandbox may list and sign with.
+	Keys []string
+	// Destinations restricts signing to sessions bound to these hosts when non-empty.
+	Destinations []Destination
+	// KnownHosts vouches for destination host keys; required with Destinations.
+	KnownHosts *KnownHosts
+}
+
+// Proxy is a filtering ssh-agent that exposes a subset of the host agent's
+// keys. Private keys never leave the upstream agent; the proxy only relays
+// list and sign requests and refuses everything else.
+type Proxy struct {
+	cfg      Config
+	allowed  map[string]bool
+	listener net.Listener
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Start listens on cfg.SocketPath and begins serving agent requests.
+func Start(cfg Config) (*Proxy, error) {
+	if strings.TrimSpace(cfg.Upstream) == "" {
+		return nil, errors.New("ssh-agent forwarding requires SSH_AUTH_SOCK on the host")
+	}
+	if len(cfg.Keys) == 0 {
+		return nil, errors.New("ssh-agent forwarding requires at least one key fingerprint")
+	}
+	if len(cfg.Destinations) > 0 && cfg.KnownHosts == nil {
+		return nil, errors.New("ssh-agent host restriction requires known_hosts")
+	}
+	allowed := make(map[string]bool, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		allowed[NormalizeFingerprint(k)] = true
+	}
+	_ = os.Remove(cfg.SocketPath)
+	ln, err := net.Listen("unix", cfg.SocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", cfg.SocketPath, err)
+	}
+	if err := os.Chmod(cfg.SocketPath, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("chmod %s: %w", cfg.SocketPath, err)
+	}
+	p := &Proxy{
+		cfg:      cfg,
+		allowed:  allowed,
+		listener: ln,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	p.wg.Add(1)
+	go p.acceptLoop()
+	return p, nil
+}
+
+// SocketPath returns the path of the proxy socket on the host.
+func (p *Proxy) SocketPath() string {
+	return p.cfg.SocketPath
+}
+
+// SocketDir returns the directory holding the proxy socket.
+func (p *Proxy) SocketDir() string {
+	return filepath.Dir(p.cfg.SocketPath)
+}
+
+// Close stops the proxy and removes its socket.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	for c := range p.conns {
+		_ = c.Close()
+	}
+	p.mu.Unlock()
+
+	err := p.listener.Close()
+	p.wg.Wait()
+	_ = os.Remove(p.cfg.SocketPath)
+	return err
+}
+
+func (p *Proxy) acceptLoop() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		if !p.track(conn) {
+			_ = conn.Close()
+			return
+		}
+		p.wg.Add(1)
+		go p.serve(conn)
+	}
+}
+
+// session tracks per-connection state; ssh binds each connection to the
+// host it is authenticating against before asking for signatures.
+type session struct {
+	// bound maps session identifiers to whether the bound host is allowed.
+	bound map[string]bool
+}
+
+func (p *Proxy) serve(client net.Conn) {
+	defer p.wg.Done()
+	defer p.untrack(client)
+
+	upstream, err := net.Dial("unix", p.cfg.Upstream)
+	if err != nil {
+		return
+	}
+	if !p.track(upstream) {
+		_ = upstream.Close()
+		return
+	}
+	defer p.untrack(upstream)
+
+	sess := &session{bound: make(map[string]bool)}
+	for {
+		req, err := readMessage(client)
+		if err != nil {
+			return
+		}
+		resp, err := p.handle(sess, req, upstream)
+		if err != nil {
+			return
+		}
+		if err := writeMessage(client, resp); err != nil {
+			return
+		}
+	}
+}
+
+func (p *Proxy) handle(sess *session, req []byte, upstream net.Conn) ([]byte, error) {
+	failure := []byte{msgFailure}
+	switch req[0] {
+	case msgRequestIdentities:
+		resp, err := roundTrip(upstream, req)
+		if err != nil {
+			return nil, err
+		}
+		ids, err := parseIdentitiesAnswer(resp)
+		if err != nil {
+			return failure, nil
+		}
+		filtered := ids[:0]
+		for _, id := range ids {
+			if p.allowed[Fingerprint(id.blob)] {
+				filtered = append(filtered, id)
+			}
+		}
+		return marshalIdentitiesAnswer(filtered), nil
+	case msgSignRequest:
+		if !p.signAllowed(sess, req[1:]) {
+			return failure, nil
+		}
+		return roundTrip(upstream, req)
+	case msgExtension:
+		name, rest, err := readString(req[1:])
+		if err != nil || string(name) != sessionBindExtension {
+			return failure, nil
+		}
+		if !p.bindSession(sess, rest) {
+			return failure, nil
+		}
+		return []byte{msgSuccess}, nil
+	default:
+		// Adding, removing, locking and everything else stays on the host.
+		return failure, nil
+	}
+}
+
+func (p *Proxy) signAllowed(sess *session, body []byte) bool {
+	keyBlob, rest, err := readString(body)
+	if err != nil || !p.allowed[Fingerprint(keyBlob)] {
+		return false
+	}
+	if len(p.cfg.Destinations) == 0 {
+		return true
+	}
+	data, _, err := readString(rest)
+	if err != nil {
+		return false
+	}
+	sid, ok := signedSessionID(data)
+	if !ok {
+		return false
+	}
+	return sess.bound[string(sid)]
+}
+
+func (p *Proxy) bindSession(sess *session, body []byte) bool {
+	sb, err := parseSessionBind(body)
+	if err != nil {
+		return false
+	}
+	if err := verifyHostSignature(sb.hostKey, sb.sessionID, sb.signature); err != nil {
+		return false
+	}
+	allowed := len(p.cfg.Destinations) == 0 ||
+		(!sb.isForwarding && p.cfg.KnownHosts.Allows(sb.hostKey, p.cfg.Destinations))
+	sess.bound[string(sb.sessionID)] = allowed
+	return allowed
+}
+
+func roundTrip(upstream net.Conn, req []byte) ([]byte, error) {
+	if err := writeMessage(upstream, req); err != nil {
+		return nil, err
+	}
+	return readMessage(upstream)
+}
+
+func (p *Proxy) track(c net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.conns[c] = struct{}{}
+	return true
+}
+
+func (p *Proxy) untrack(c net.Conn) {
+	p.mu.Lock()
+	delete(p.conns, c)
+	p.mu.Unlock()
+	_ = c.Close()
+}
@@ -0,0 +1,247 @@
+package sshagent
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func ed25519Blob(pub ed25519.PublicKey) []byte {
+	return appendString(appendString(nil, []byte("ssh-ed25519")), pub)
+}
+
+// startFakeAgent serves identities for keys and signs anything it is asked to.
+func startFakeAgent(t *testing.T, keys ...[]byte) string {
+	t.Helper()
+	sock := filepath.Join(shortTempDir(t), "upstream.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				for {
+					req, err := readMessage(c)
+					if err != nil {
+						return
+					}
+					var resp []byte
+					switch req[0] {
+					case msgRequestIdentities:
+						ids := make([]identity, 0, len(keys))
+						for _, k := range keys {
+							ids = append(ids, identity{blob: k, comment: []byte("test")})
+						}
+						resp = marshalIdentitiesAnswer(ids)
+					case msgSignRequest:
+						resp = appendString([]byte{msgSignResponse}, []byte("signature"))
+					default:
+						resp = []byte{msgSuccess}
+					}
+					if err := writeMessage(c, resp); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return sock
+}
+
+// shortTempDir keeps unix socket paths under the platform length limit.
+func shortTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "sa")
+	if err != nil {
+		t.Fatalf("mkdtemp: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func dialProxy(t *testing.T, p *Proxy) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("unix", p.SocketPath())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func call(t *testing.T, conn net.Conn, req []byte) []byte {
+	t.Helper()
+	if err := writeMessage(conn, req); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp, err := readMessage(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return resp
+}
+
+func signRequest(keyBlob, data []byte) []byte {
+	req := appendString([]byte{msgSignRequest}, keyBlob)
+	req = appendString(req, data)
+	return append(req, 0, 0, 0, 0)
+}
+
+func userAuthData(sessionID []byte) []byte {
+	return append(appendString(nil, sessionID), userAuthRequestMsgNum)
+}
+
+func TestProxyFiltersIdentitiesAndSignatures(t *testing.T) {
+	allowedPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	allowed, other := ed25519Blob(allowedPub), ed25519Blob(otherPub)
+
+	p, err := Start(Config{
+		Upstream:   startFakeAgent(t, allowed, other),
+		SocketPath: filepath.Join(shortTempDir(t), "agent.sock"),
+		Keys:       []string{Fingerprint(allowed) + "="},
+	})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer p.Close()
+	conn := dialProxy(t, p)
+
+	ids, err := parseIdentitiesAnswer(call(t, conn, []byte{msgRequestIdentities}))
+	if err != nil {
+		t.Fatalf("parse identities: %v", err)
+	}
+	if len(ids) != 1 || string(ids[0].blob) != string(allowed) {
+		t.Fatalf("expected only the allowed key, got %d identities", len(ids))
+	}
+
+	if resp := call(t, conn, signRequest(allowed, []byte("data"))); resp[0] != msgSignResponse {
+		t.Fatalf("expected sign response, got %d", resp[0])
+	}
+	if resp := call(t, conn, signRequest(other, []byte("data"))); resp[0] != msgFailure {
+		t.Fatalf("expected failure for unlisted key, got %d", resp[0])
+	}
+	// Adding keys (SSH2_AGENTC_ADD_IDENTITY) must never reach the host agent.
+	if resp := call(t, conn, []byte{17}); resp[0] != msgFailure {
+		t.Fatalf("expected failure for add identity, got %d", resp[0])
+	}
+}
+
+func TestProxyRestrictsSigningToBoundHosts(t *testing.T) {
+	userPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	userKey := ed25519Blob(userPub)
+	hostPub, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey := ed25519Blob(hostPub)
+	roguePub, roguePriv, _ := ed25519.GenerateKey(rand.Reader)
+	rogueKey := ed25519Blob(roguePub)
+
+	known := parseKnownHosts([]byte("github.com ssh-ed25519 " + base64.StdEncoding.EncodeToString(hostKey) + "\n"))
+	p, err := Start(Config{
+		Upstream:     startFakeAgent(t, userKey),
+		SocketPath:   filepath.Join(shortTempDir(t), "agent.sock"),
+		Keys:         []string{Fingerprint(userKey)},
+		Destinations: []Destination{{Host: "github.com", Port: 22}},
+		KnownHosts:   &KnownHosts{entries: known},
+	})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer p.Close()
+	conn := dialProxy(t, p)
+
+	bind := func(key []byte, priv ed25519.PrivateKey, sid []byte) byte {
+		sig := appendString(appendString(nil, []byte("ssh-ed25519")), ed25519.Sign(priv, sid))
+		req := appendString([]byte{msgExtension}, []byte(sessionBindExtension))
+		req = appendString(req, key)
+		req = appendString(req, sid)
+		req = appendString(req, sig)
+		req = append(req, 0)
+		return call(t, conn, req)[0]
+	}
+
+	unbound := []byte("unbound-session")
+	if resp := call(t, conn, signRequest(userKey, userAuthData(unbound))); resp[0] != msgFailure {
+		t.Fatalf("expected failure without session bind, got %d", resp[0])
+	}
+
+	rogueSession := []byte("rogue-session")
+	if got := bind(rogueKey, roguePriv, rogueSession); got != msgFailure {
+		t.Fatalf("expected failure binding unknown host, got %d", got)
+	}
+	if resp := call(t, conn, signRequest(userKey, userAuthData(rogueSession))); resp[0] != msgFailure {
+		t.Fatalf("expected failure for unknown host, got %d", resp[0])
+	}
+
+	forged := []byte("forged-session")
+	if got := bind(hostKey, roguePriv, forged); got != msgFailure {
+		t.Fatalf("expected failure for forged bind signature, got %d", got)
+	}
+
+	session := []byte("github-session")
+	if got := bind(hostKey, hostPriv, session); got != msgSuccess {
+		t.Fatalf("expected success binding known host, got %d", got)
+	}
+	if resp := call(t, conn, signRequest(userKey, userAuthData(session))); resp[0] != msgSignResponse {
+		t.Fatalf("expected sign response for bound host, got %d", resp[0])
+	}
+}
+
+func TestStartRequiresUpstreamAndKeys(t *testing.T) {
+	sock := filepath.Join(shortTempDir(t), "agent.sock")
+	if _, err := Start(Config{SocketPath: sock, Keys: []string{"SHA256:x"}}); err == nil {
+		t.Fatal("expected error without upstream")
+	}
+	if _, err := Start(Config{Upstream: "/tmp/none", SocketPath: sock}); err == nil {
+		t.Fatal("expected error without keys")
+	}
+}
+
+func TestKnownHostsMatching(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	key := ed25519Blob(pub)
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("[git.example.com]:2222"))
+	hashed := "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	kh := &KnownHosts{entries: parseKnownHosts([]byte(
+		"# comment\n" +
+			"*.github.com,!evil.github.com ssh-ed25519 " + encoded + "\n" +
+			hashed + " ssh-ed25519 " + encoded + "\n" +
+			"@revoked revoked.example.com ssh-ed25519 " + encoded + "\n",
+	))}
+
+	cases := []struct {
+		dest Destination
+		want bool
+	}{
+		{Destination{Host: "ssh.github.com", Port: 22}, true},
+		{Destination{Host: "evil.github.com", Port: 22}, false},
+		{Destination{Host: "git.example.com", Port: 2222}, true},
+		{Destination{Host: "git.example.com", Port: 22}, false},
+		{Destination{Host: "revoked.example.com", Port: 22}, false},
+	}
+	for _, tc := range cases {
+		if got := kh.Allows(key, []Destination{tc.dest}); got != tc.want {
+			t.Errorf("Allows(%+v) = %v, want %v", tc.dest, got, tc.want)
+		}
+	}
+	if kh.Allows([]byte("other"), []Destination{{Host: "ssh.github.com", Port: 22}}) {
+		t.Error("expected mismatched key to be rejected")
+	}
+}
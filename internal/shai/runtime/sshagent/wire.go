@@ -0,0 +1,285 @@
+package sshagent
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// Agent protocol message numbers (draft-miller-ssh-agent).
+const (
+	msgFailure            = 5
+	msgSuccess            = 6
+	msgRequestIdentities  = 11
+	msgIdentitiesAnswer   = 12
+	msgSignRequest        = 13
+	msgSignResponse       = 14
+	msgExtension          = 27
+	sessionBindExtension  = "session-bind@openssh.com"
+	userAuthRequestMsgNum = 50
+	maxMessageSize        = 256 * 1024
+)
+
+var errShortMessage = errors.New("short agent message")
+
+// Fingerprint returns the OpenSSH SHA256 fingerprint of a public key blob.
+func Fingerprint(keyBlob []byte) string {
+	sum := sha256.Sum256(keyBlob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint canonicalizes user-supplied fingerprints so that
+// "SHA256:abc=" and "sha256:abc" compare equal.
+func NormalizeFingerprint(fp string) string {
+	fp = strings.TrimSpace(fp)
+	if idx := strings.Index(fp, ":"); idx >= 0 && strings.EqualFold(fp[:idx], "sha256") {
+		fp = fp[idx+1:]
+	}
+	return "SHA256:" + strings.TrimRight(fp, "=")
+}
+
+func readMessage(r io.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n == 0 || n > maxMessageSize {
+		return nil, fmt.Errorf("invalid agent message length %d", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func writeMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(buf, uint32(len(msg)))
+	copy(buf[4:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readString(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, errShortMessage
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(n) {
+		return nil, nil, errShortMessage
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
+
+func readUint32(b []byte) (uint32, []byte, error) {
+	if len(b) < 4 {
+		return 0, nil, errShortMessage
+	}
+	return binary.BigEndian.Uint32(b), b[4:], nil
+}
+
+func appendString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// identity is a public key advertised by the upstream agent.
+type identity struct {
+	blob    []byte
+	comment []byte
+}
+
+func parseIdentitiesAnswer(msg []byte) ([]identity, error) {
+	if len(msg) < 1 || msg[0] != msgIdentitiesAnswer {
+		return nil, errors.New("unexpected identities answer")
+	}
+	count, rest, err := readUint32(msg[1:])
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]identity, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var id identity
+		if id.blob, rest, err = readString(rest); err != nil {
+			return nil, err
+		}
+		if id.comment, rest, err = readString(rest); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func marshalIdentitiesAnswer(ids []identity) []byte {
+	out := []byte{msgIdentitiesAnswer}
+	out = binary.BigEndian.AppendUint32(out, uint32(len(ids)))
+	for _, id := range ids {
+		out = appendString(out, id.blob)
+		out = appendString(out, id.comment)
+	}
+	return out
+}
+
+// sessionBind is the payload of the session-bind@openssh.com extension.
+type sessionBind struct {
+	hostKey      []byte
+	sessionID    []byte
+	signature    []byte
+	isForwarding bool
+}
+
+func parseSessionBind(b []byte) (sessionBind, error) {
+	var sb sessionBind
+	var err error
+	if sb.hostKey, b, err = readString(b); err != nil {
+		return sb, err
+	}
+	if sb.sessionID, b, err = readString(b); err != nil {
+		return sb, err
+	}
+	if sb.signature, b, err = readString(b); err != nil {
+		return sb, err
+	}
+	if len(b) < 1 {
+		return sb, errShortMessage
+	}
+	sb.isForwarding = b[0] != 0
+	return sb, nil
+}
+
+// signedSessionID extracts the session identifier that prefixes a
+// publickey userauth request, the only payload ssh clients ask agents to sign.
+func signedSessionID(data []byte) ([]byte, bool) {
+	sid, rest, err := readString(data)
+	if err != nil || len(rest) < 1 || rest[0] != userAuthRequestMsgNum {
+		return nil, false
+	}
+	return sid, true
+}
+
+// verifyHostSignature checks that sig is a valid signature of data by hostKey.
+func verifyHostSignature(hostKey, data, sig []byte) error {
+	keyType, keyRest, err := readString(hostKey)
+	if err != nil {
+		return err
+	}
+	sigFormat, sigRest, err := readString(sig)
+	if err != nil {
+		return err
+	}
+	sigBytes, _, err := readString(sigRest)
+	if err != nil {
+		return err
+	}
+
+	switch string(keyType) {
+	case "ssh-ed25519":
+		pub, _, err := readString(keyRest)
+		if err != nil {
+			return err
+		}
+		if len(pub) != ed25519.PublicKeySize || string(sigFormat) != "ssh-ed25519" {
+			return errors.New("malformed ed25519 host key signature")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(pub), data, sigBytes) {
+			return errors.New("invalid host key signature")
+		}
+		return nil
+	case "ssh-rsa":
+		e, rest, err := readString(keyRest)
+		if err != nil {
+			return err
+		}
+		n, _, err := readString(rest)
+		if err != nil {
+			return err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 {
+			return errors.New("unsupported rsa exponent")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}
+		var (
+			hash   crypto.Hash
+			digest []byte
+		)
+		switch string(sigFormat) {
+		case "rsa-sha2-256":
+			sum := sha256.Sum256(data)
+			hash, digest = crypto.SHA256, sum[:]
+		case "rsa-sha2-512":
+			sum := sha512.Sum512(data)
+			hash, digest = crypto.SHA512, sum[:]
+		case "ssh-rsa":
+			sum := sha1.Sum(data)
+			hash, digest = crypto.SHA1, sum[:]
+		default:
+			return fmt.Errorf("unsupported rsa signature format %q", sigFormat)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, sigBytes); err != nil {
+			return errors.New("invalid host key signature")
+		}
+		return nil
+	case "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521":
+		if string(sigFormat) != string(keyType) {
+			return errors.New("mismatched ecdsa signature format")
+		}
+		_, rest, err := readString(keyRest)
+		if err != nil {
+			return err
+		}
+		point, _, err := readString(rest)
+		if err != nil {
+			return err
+		}
+		var (
+			curve  elliptic.Curve
+			digest []byte
+		)
+		switch string(keyType) {
+		case "ecdsa-sha2-nistp256":
+			sum := sha256.Sum256(data)
+			curve, digest = elliptic.P256(), sum[:]
+		case "ecdsa-sha2-nistp384":
+			sum := sha512.Sum384(data)
+			curve, digest = elliptic.P384(), sum[:]
+		default:
+			sum := sha512.Sum512(data)
+			curve, digest = elliptic.P521(), sum[:]
+		}
+		x, y := elliptic.Unmarshal(curve, point) //nolint:staticcheck // ssh encodes uncompressed points
+		if x == nil {
+			return errors.New("malformed ecdsa host key")
+		}
+		rBytes, rest, err := readString(sigBytes)
+		if err != nil {
+			return err
+		}
+		sBytes, _, err := readString(rest)
+		if err != nil {
+			return err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if !ecdsa.Verify(pub, digest, new(big.Int).SetBytes(rBytes), new(big.Int).SetBytes(sBytes)) {
+			return errors.New("invalid host key signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported host key type %q", keyType)
+	}
+}
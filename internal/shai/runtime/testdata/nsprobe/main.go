@@ -0,0 +1,26 @@
+//go:build linux
+
+// nsprobe reports whether the calling process may start a child in a new
+// user namespace through clone(2). unshare(2) is probed with unshare -U
+// instead, since the kernel refuses it in multithreaded processes anyway.
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+func main() {
+	cmd := exec.Command("/bin/true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWUSER}
+	report("CLONE_NEWUSER", cmd.Run())
+}
+
+func report(probe string, err error) {
+	if err != nil {
+		fmt.Printf("%s:denied (%v)\n", probe, err)
+		return
+	}
+	fmt.Printf("%s:allowed\n", probe)
+}
@@ -0,0 +1,61 @@
+package shai
+
+import (
+	"fmt"
+	"os"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/colony-2/shai/internal/shai/runtime/trust"
+)
+
+// TrustRequest is passed to EphemeralConfig.ConfirmTrust when a config has
+// not been approved, or has changed since it was approved.
+type TrustRequest struct {
+	ConfigPath   string
+	Changed      bool
+	Capabilities []string
+}
+
+// checkTrust enforces approval of the config at configPath before any of its
+// resources take effect. The built-in default config is always trusted.
+func checkTrust(cfg EphemeralConfig, configPath string, usedDefault bool, shaiCfg *configpkg.Config) error {
+	if !cfg.RequireTrust || usedDefault {
+		return nil
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("read shai config: %w", err)
+	}
+	if data, err = trust.Content(data, shaiCfg.Includes()); err != nil {
+		return err
+	}
+	dir := cfg.TrustStoreDir
+	if dir == "" {
+		if dir, err = trust.DefaultDir(); err != nil {
+			return err
+		}
+	}
+	store := trust.NewStore(dir)
+	status, err := store.Check(configPath, data)
+	if err != nil {
+		return err
+	}
+	if status == trust.Trusted {
+		return nil
+	}
+	if cfg.ConfirmTrust == nil {
+		return fmt.Errorf("shai config %s is not trusted; review it and run \"shai trust %s\"", configPath, configPath)
+	}
+	ok, err := cfg.ConfirmTrust(TrustRequest{
+		ConfigPath:   configPath,
+		Changed:      status == trust.Changed,
+		Capabilities: trust.Summary(shaiCfg),
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("shai config %s was not trusted", configPath)
+	}
+	return store.Trust(configPath, data)
+}
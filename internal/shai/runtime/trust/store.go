@@ -0,0 +1,136 @@
+package trust
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Status describes whether a config has been approved.
+type Status int
+
+const (
+	// Untrusted means the config path has never been approved.
+	Untrusted Status = iota
+	// Changed means the config was approved but its content differs now.
+	Changed
+	// Trusted means the current content was approved.
+	Trusted
+)
+
+// Store records approved config hashes, one file per config path, in the
+// spirit of direnv's allow list.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a store rooted at dir.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// DefaultDir returns ~/.config/shai/trusted.
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "shai", "trusted"), nil
+}
+
+// Hash returns the content hash recorded for approved configs.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Content returns what is hashed for a config: its own bytes followed by the
+// path and bytes of every file it includes, so editing a shared resource
+// library requires approval again too.
+func Content(data []byte, includes []string) ([]byte, error) {
+	if len(includes) == 0 {
+		return data, nil
+	}
+	out := append([]byte(nil), data...)
+	for _, path := range includes {
+		inc, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read included shai config: %w", err)
+		}
+		out = fmt.Appendf(out, "\x00%s\x00", path)
+		out = append(out, inc...)
+	}
+	return out, nil
+}
+
+// Check reports whether data is the approved content for path.
+func (s *Store) Check(path string, data []byte) (Status, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Untrusted, err
+	}
+	recorded, err := os.ReadFile(s.recordPath(abs))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Untrusted, nil
+		}
+		return Untrusted, fmt.Errorf("read trust record: %w", err)
+	}
+	if recordHash(recorded) == Hash(data) {
+		return Trusted, nil
+	}
+	return Changed, nil
+}
+
+// Trust approves the current content of path.
+func (s *Store) Trust(path string, data []byte) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("create trust dir: %w", err)
+	}
+	record := fmt.Sprintf("%s\n%s\n", Hash(data), abs)
+	if err := os.WriteFile(s.recordPath(abs), []byte(record), 0o600); err != nil {
+		return fmt.Errorf("write trust record: %w", err)
+	}
+	return nil
+}
+
+// Untrust revokes approval for path. It reports whether a record existed.
+func (s *Store) Untrust(path string) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	if err := os.Remove(s.recordPath(abs)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("remove trust record: %w", err)
+	}
+	return true, nil
+}
+
+func (s *Store) recordPath(abs string) string {
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// recordHash returns the hash line of a trust record. The second line holds
+// the config path so records stay readable when inspected by hand.
+func recordHash(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if scanner.Scan() {
+		return strings.TrimSpace(scanner.Text())
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package trust
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreLifecycle(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "trusted"))
+	path := filepath.Join(t.TempDir(), ".shai", "config.yaml")
+	original := []byte("image: one\n")
+
+	status, err := store.Check(path, original)
+	require.NoError(t, err)
+	require.Equal(t, Untrusted, status)
+
+	require.NoError(t, store.Trust(path, original))
+	status, err = store.Check(path, original)
+	require.NoError(t, err)
+	require.Equal(t, Trusted, status)
+
+	status, err = store.Check(path, []byte("image: two\n"))
+	require.NoError(t, err)
+	require.Equal(t, Changed, status)
+
+	removed, err := store.Untrust(path)
+	require.NoError(t, err)
+	require.True(t, removed)
+	status, err = store.Check(path, original)
+	require.NoError(t, err)
+	require.Equal(t, Untrusted, status)
+
+	removed, err = store.Untrust(path)
+	require.NoError(t, err)
+	require.False(t, removed)
+}
+
+func TestSummaryListsDangerousCapabilities(t *testing.T) {
+	cfg := &configpkg.Config{
+		Resources: map[string]*configpkg.ResourceSet{
+			"global": {
+				Mounts:       []configpkg.Mount{{Source: "/home/dev", Target: "/home/shai", Mode: "rw"}},
+				RootCommands: []string{"modprobe nbd"},
+				Calls:        []configpkg.Call{{Name: "deploy", Command: "./deploy.sh"}},
+				Options:      configpkg.ResourceOptions{Privileged: true},
+			},
+			"secrets": {
+				Vars:      []configpkg.VarMapping{{Source: "HOME"}, {Command: "op read x", Target: "TOKEN"}},
+				HostPorts: []configpkg.HostPort{{Port: 5432}},
+			},
+		},
+	}
+	require.Equal(t, []string{
+		"[global] runs the container privileged",
+		"[global] mounts host path /home/dev read-write at /home/shai",
+		"[global] runs as root in the sandbox: modprobe nbd",
+		`[global] exposes host command "./deploy.sh" as call deploy`,
+		`[secrets] runs host command "op read x" to set TOKEN`,
+		"[secrets] exposes host localhost:5432",
+	}, Summary(cfg))
+}
+
+func TestContentCoversIncludedFiles(t *testing.T) {
+	data := []byte("include: [lib.yaml]\n")
+	same, err := Content(data, nil)
+	require.NoError(t, err)
+	require.Equal(t, data, same)
+
+	lib := filepath.Join(t.TempDir(), "lib.yaml")
+	require.NoError(t, os.WriteFile(lib, []byte("resources: {}\n"), 0o644))
+	before, err := Content(data, []string{lib})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(lib, []byte("resources: {web: {}}\n"), 0o644))
+	after, err := Content(data, []string{lib})
+	require.NoError(t, err)
+	require.NotEqual(t, Hash(before), Hash(after))
+
+	_, err = Content(data, []string{lib + ".missing"})
+	require.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package trust
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+)
+
+// Summary lists the capabilities in cfg that reach outside the sandbox:
+// host mounts, privileged mode, root commands, host commands, host ports and
+// credential forwarding. Every resource set is included because apply rules
+// and --resource-set can activate any of them, except sets defined only in
+// the user's own overlay config, which is not what is being approved.
+func Summary(cfg *configpkg.Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Resources))
+	for name := range cfg.Resources {
+		if files := cfg.Origin("resources." + name); cfg.Overlay() != "" && len(files) == 1 && files[0] == cfg.Overlay() {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []string
+	add := func(res, format string, args ...any) {
+		out = append(out, fmt.Sprintf("[%s] ", res)+fmt.Sprintf(format, args...))
+	}
+	for _, name := range names {
+		res := cfg.Resources[name]
+		if res == nil {
+			continue
+		}
+		if res.Options.Privileged {
+			add(name, "runs the container privileged")
+		}
+		if strings.EqualFold(strings.TrimSpace(res.Options.Hardening), "off") {
+			add(name, "disables container hardening")
+		}
+		for _, m := range res.Mounts {
+			if m.Mode == "rw" {
+				add(name, "mounts host path %s read-write at %s", m.Source, m.Target)
+			} else {
+				add(name, "mounts host path %s read-only at %s", m.Source, m.Target)
+			}
+		}
+		for _, cmd := range res.RootCommands {
+			add(name, "runs as root in the sandbox: %s", cmd)
+		}
+		for _, call := range res.Calls {
+			add(name, "exposes host command %q as call %s", call.Command, call.Name)
+		}
+		for _, vm := range res.Vars {
+			target := strings.TrimSpace(vm.Target)
+			switch {
+			case strings.TrimSpace(vm.Command) != "":
+				add(name, "runs host command %q to set %s", vm.Command, target)
+			case strings.TrimSpace(vm.File) != "":
+				add(name, "reads host file %s into %s", vm.File, target)
+			case strings.TrimSpace(vm.Keychain) != "":
+				add(name, "reads keychain entry %s into %s", vm.Keychain, target)
+			}
+		}
+		for _, g := range res.Git {
+			ops := g.Operations
+			if len(ops) == 0 {
+				ops = []string{"fetch"}
+			}
+			add(name, "runs host command %q for git %s credentials to %s", g.Command, strings.Join(ops, "/"), g.Remote)
+		}
+		if res.SSHAgent != nil {
+			add(name, "forwards ssh-agent keys %s", strings.Join(res.SSHAgent.Keys, ", "))
+		}
+		for _, hp := range res.HostPorts {
+			add(name, "exposes host localhost:%d", hp.Port)
+		}
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package shai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	configpkg "github.com/colony-2/shai/internal/shai/runtime/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTrustPromptsOnNewAndChangedConfigs(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("image: one\n"), 0o644))
+	shaiCfg := &configpkg.Config{Resources: map[string]*configpkg.ResourceSet{
+		"root": {Options: configpkg.ResourceOptions{Privileged: true}},
+	}}
+
+	var requests []TrustRequest
+	approve := true
+	cfg := EphemeralConfig{
+		RequireTrust:  true,
+		TrustStoreDir: filepath.Join(t.TempDir(), "trusted"),
+		ConfirmTrust: func(req TrustRequest) (bool, error) {
+			requests = append(requests, req)
+			return approve, nil
+		},
+	}
+
+	require.NoError(t, checkTrust(cfg, configPath, false, shaiCfg))
+	require.Len(t, requests, 1)
+	require.False(t, requests[0].Changed)
+	require.Equal(t, []string{"[root] runs the container privileged"}, requests[0].Capabilities)
+
+	// Approved content is not asked about again.
+	require.NoError(t, checkTrust(cfg, configPath, false, shaiCfg))
+	require.Len(t, requests, 1)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("image: two\n"), 0o644))
+	approve = false
+	err := checkTrust(cfg, configPath, false, shaiCfg)
+	require.ErrorContains(t, err, "was not trusted")
+	require.Len(t, requests, 2)
+	require.True(t, requests[1].Changed)
+
+	cfg.ConfirmTrust = nil
+	err = checkTrust(cfg, configPath, false, shaiCfg)
+	require.ErrorContains(t, err, "shai trust")
+}
+
+func TestCheckTrustSkipsDefaultConfigAndOptOut(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	cfg := EphemeralConfig{RequireTrust: true, TrustStoreDir: t.TempDir()}
+	require.NoError(t, checkTrust(cfg, missing, true, nil))
+
+	cfg.RequireTrust = false
+	require.NoError(t, checkTrust(cfg, missing, false, nil))
+}
@@ -0,0 +1,236 @@
+// Package worktree gives a sandbox its own checkout of the workspace
+// repository on a new branch, so parallel sessions never share a working
+// tree.
+//
+// The checkout is a clone made with --shared: it borrows the source
+// repository's objects through an alternates file instead of copying them,
+// while its refs, index and config stay separate. Unlike a linked git
+// worktree it needs no write access to the source repository's .git
+// directory, only read access to its object store.
+package worktree
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const metadataFile = "worktree.json"
+
+// Worktree describes a shai-managed checkout.
+type Worktree struct {
+	ID string `json:"id"`
+	// Repo is the top level of the source repository.
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	// Base is the commit the branch started from.
+	Base string `json:"base"`
+	// ObjectsDir is the source object store the checkout borrows from; it
+	// must be readable at the same path wherever git runs in the checkout.
+	ObjectsDir string    `json:"objects_dir"`
+	Created    time.Time `json:"created"`
+
+	dir string
+}
+
+// DefaultDir returns ~/.local/state/shai/worktrees.
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "shai", "worktrees"), nil
+}
+
+// DefaultBranch returns the branch name used when none is given.
+func DefaultBranch() string {
+	return "shai/" + time.Now().Format("20060102-150405")
+}
+
+// Create clones the repository containing workingDir under root and checks
+// out a new branch at its HEAD. Uncommitted changes are not carried over.
+// The branch must not exist in the source repository yet.
+func Create(root, workingDir, branch string) (*Worktree, error) {
+	if branch == "" {
+		branch = DefaultBranch()
+	}
+	if _, err := git(workingDir, "check-ref-format", "--branch", branch); err != nil {
+		return nil, fmt.Errorf("invalid branch name %q", branch)
+	}
+	repo, err := git(workingDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("worktree mode needs a git repository: %w", err)
+	}
+	commonDir, err := git(workingDir, "rev-parse", "--path-format=absolute", "--git-common-dir")
+	if err != nil {
+		return nil, err
+	}
+	base, err := git(repo, "rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("repository %s has no commits: %w", repo, err)
+	}
+	if _, err := git(repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		return nil, fmt.Errorf("branch %q already exists in %s", branch, repo)
+	}
+
+	w := &Worktree{
+		ID:         filepath.Base(repo) + "-" + strings.ReplaceAll(branch, "/", "-"),
+		Repo:       repo,
+		Branch:     branch,
+		Base:       base,
+		ObjectsDir: filepath.Join(commonDir, "objects"),
+		Created:    time.Now().UTC(),
+	}
+	w.dir = filepath.Join(root, w.ID)
+	if _, err := os.Stat(w.dir); err == nil {
+		return nil, fmt.Errorf("worktree %s already exists", w.ID)
+	}
+	if err := os.MkdirAll(w.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create worktree: %w", err)
+	}
+	if _, err := git(root, "clone", "--quiet", "--shared", "--no-checkout", repo, w.Dir()); err != nil {
+		_ = os.RemoveAll(w.dir)
+		return nil, err
+	}
+	if _, err := git(w.Dir(), "checkout", "--quiet", "-b", branch, base); err != nil {
+		_ = os.RemoveAll(w.dir)
+		return nil, err
+	}
+	data, err := json.MarshalIndent(w, "", "  ")
+	if err != nil {
+		_ = os.RemoveAll(w.dir)
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(w.dir, metadataFile), data, 0o600); err != nil {
+		_ = os.RemoveAll(w.dir)
+		return nil, fmt.Errorf("write worktree metadata: %w", err)
+	}
+	return w, nil
+}
+
+// Open loads the worktree id from root.
+func Open(root, id string) (*Worktree, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("invalid worktree id %q", id)
+	}
+	dir := filepath.Join(root, id)
+	data, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("no shai worktree %q", id)
+		}
+		return nil, fmt.Errorf("read worktree metadata: %w", err)
+	}
+	var w Worktree
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("parse worktree %s: %w", id, err)
+	}
+	w.dir = dir
+	return &w, nil
+}
+
+// List returns the worktrees under root, oldest first.
+func List(root string) ([]*Worktree, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []*Worktree
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		w, err := Open(root, e.Name())
+		if err != nil {
+			continue
+		}
+		out = append(out, w)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out, nil
+}
+
+// Dir returns the checkout's top level.
+func (w *Worktree) Dir() string {
+	return filepath.Join(w.dir, "src")
+}
+
+// FetchBranch copies the branch from the checkout into the source
+// repository so it can be reviewed there. It only fast-forwards an existing
+// branch.
+func (w *Worktree) FetchBranch() error {
+	ref := "refs/heads/" + w.Branch
+	if _, err := untrustedGit(w.Repo, "fetch", "--quiet", "--no-tags", w.Dir(), ref+":"+ref); err != nil {
+		return fmt.Errorf("fetch branch %s into %s: %w", w.Branch, w.Repo, err)
+	}
+	return nil
+}
+
+// Dirty reports whether the checkout has uncommitted changes.
+func (w *Worktree) Dirty() (bool, error) {
+	out, err := untrustedGit(w.Dir(), "status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	return out != "", nil
+}
+
+// Remove deletes the checkout. The branch stays in the source repository if
+// it was fetched there.
+func (w *Worktree) Remove() error {
+	if err := os.RemoveAll(w.dir); err != nil {
+		return fmt.Errorf("remove worktree %s: %w", w.ID, err)
+	}
+	return nil
+}
+
+// untrustedConfig overrides the settings through which a repository's own
+// config makes git run commands. The sandbox can write to the checkout, so
+// the host must not act on its config; -c settings also reach the
+// upload-pack that fetch spawns in the checkout.
+var untrustedConfig = []string{
+	"-c", "core.fsmonitor=false",
+	"-c", "core.hooksPath=/dev/null",
+}
+
+// git runs git in dir and returns its trimmed stdout.
+func git(dir string, args ...string) (string, error) {
+	return runGit(dir, nil, args)
+}
+
+// untrustedGit is git for commands that read the checkout, which the
+// sandbox may have tampered with.
+func untrustedGit(dir string, args ...string) (string, error) {
+	return runGit(dir, untrustedConfig, args)
+}
+
+func runGit(dir string, config, args []string) (string, error) {
+	cmd := exec.Command("git", slices.Concat(config, args)...)
+	cmd.Dir = dir
+	if len(config) > 0 {
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,109 @@
+package worktree
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	run := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=shai", "GIT_AUTHOR_EMAIL=shai@example.com",
+			"GIT_COMMITTER_NAME=shai", "GIT_COMMITTER_EMAIL=shai@example.com")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	run(repo, "init", "--quiet")
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, "app"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "app", "main.go"), []byte("package main\n"), 0o644))
+	run(repo, "add", ".")
+	run(repo, "commit", "--quiet", "-m", "init")
+	return repo
+}
+
+func TestCreateFetchAndRemove(t *testing.T) {
+	repo := initRepo(t)
+	root := t.TempDir()
+
+	w, err := Create(root, filepath.Join(repo, "app"), "agent/task-1")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Base(repo)+"-agent-task-1", w.ID)
+	assert.FileExists(t, filepath.Join(w.Dir(), "app", "main.go"))
+	branch, err := git(w.Dir(), "branch", "--show-current")
+	require.NoError(t, err)
+	assert.Equal(t, "agent/task-1", branch)
+
+	dirty, err := w.Dirty()
+	require.NoError(t, err)
+	assert.False(t, dirty)
+	require.NoError(t, os.WriteFile(filepath.Join(w.Dir(), "app", "new.go"), []byte("package main\n"), 0o644))
+	dirty, err = w.Dirty()
+	require.NoError(t, err)
+	assert.True(t, dirty)
+
+	require.NoError(t, w.FetchBranch())
+	head, err := git(repo, "rev-parse", "refs/heads/agent/task-1")
+	require.NoError(t, err)
+	assert.Equal(t, w.Base, head)
+
+	_, err = Create(root, repo, "agent/task-1")
+	assert.ErrorContains(t, err, "already exists")
+
+	listed, err := List(root)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, w.ID, listed[0].ID)
+
+	require.NoError(t, listed[0].Remove())
+	_, err = Open(root, w.ID)
+	assert.ErrorContains(t, err, "no shai worktree")
+}
+
+func TestCreateRejectsNonRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	_, err := Create(t.TempDir(), t.TempDir(), "")
+	assert.ErrorContains(t, err, "git repository")
+
+	_, err = Create(t.TempDir(), initRepo(t), "bad..name")
+	assert.ErrorContains(t, err, "invalid branch name")
+}
+
+func TestHostGitIgnoresCheckoutCommands(t *testing.T) {
+	repo := initRepo(t)
+	w, err := Create(t.TempDir(), repo, "agent/task-2")
+	require.NoError(t, err)
+
+	// What a sandbox could plant in the read-write checkout.
+	marker := filepath.Join(t.TempDir(), "ran")
+	hook := filepath.Join(t.TempDir(), "fsmonitor.sh")
+	require.NoError(t, os.WriteFile(hook, []byte("#!/bin/sh\ntouch "+marker+"\n"), 0o755))
+	_, err = git(w.Dir(), "config", "core.fsmonitor", hook)
+	require.NoError(t, err)
+
+	// Plain git status runs it, so the checks below are meaningful.
+	_, _ = git(w.Dir(), "status", "--porcelain")
+	if _, err := os.Stat(marker); err != nil {
+		t.Skip("git does not run core.fsmonitor commands")
+	}
+	require.NoError(t, os.Remove(marker))
+
+	_, err = w.Dirty()
+	require.NoError(t, err)
+	require.NoError(t, w.FetchBranch())
+	assert.NoFileExists(t, marker)
+}
@@ -0,0 +1,83 @@
+package shai
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/colony-2/shai/internal/shai/runtime/worktree"
+	"github.com/docker/docker/api/types/mount"
+)
+
+// startWorktree clones the workspace repository for cfg.Worktree and returns
+// the clone together with the directory inside it that corresponds to
+// cfg.WorkingDir.
+func startWorktree(cfg EphemeralConfig) (*worktree.Worktree, string, error) {
+	dir := cfg.WorktreeDir
+	if dir == "" {
+		var err error
+		if dir, err = worktree.DefaultDir(); err != nil {
+			return nil, "", err
+		}
+	}
+	wt, err := worktree.Create(dir, cfg.WorkingDir, strings.TrimSpace(cfg.WorktreeBranch))
+	if err != nil {
+		return nil, "", err
+	}
+	workingDir := wt.Dir()
+	if resolved, err := filepath.EvalSymlinks(cfg.WorkingDir); err == nil {
+		if rel, err := filepath.Rel(wt.Repo, resolved); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			workingDir = filepath.Join(wt.Dir(), rel)
+		}
+	}
+	return wt, workingDir, nil
+}
+
+// removeWorktree deletes a worktree created for a runner that failed to
+// start.
+func removeWorktree(wt *worktree.Worktree) {
+	if wt != nil {
+		_ = wt.Remove()
+	}
+}
+
+// worktreeMounts exposes the source repository's object store, which the
+// clone borrows from, read-only at its host path. The clone's config and
+// hooks are read-only too: the host runs git in the clone after the
+// session, and either could otherwise make it run sandbox-chosen commands.
+func (r *EphemeralRunner) worktreeMounts() []mount.Mount {
+	if r.worktree == nil {
+		return nil
+	}
+	mounts := []mount.Mount{{
+		Type:     mount.TypeBind,
+		Source:   r.worktree.ObjectsDir,
+		Target:   r.worktree.ObjectsDir,
+		ReadOnly: true,
+	}}
+	for _, name := range []string{"config", "hooks"} {
+		source := filepath.Join(r.worktree.Dir(), ".git", name)
+		rel, err := filepath.Rel(r.mountBuilder.WorkingDir, source)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			// The sandbox only sees a subdirectory of the clone.
+			continue
+		}
+		if _, err := os.Stat(source); err != nil {
+			continue
+		}
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   source,
+			Target:   path.Join(r.mountBuilder.Target, filepath.ToSlash(rel)),
+			ReadOnly: true,
+		})
+	}
+	return mounts
+}
+
+// Worktree returns the checkout the sandbox runs in when worktree mode is
+// on, otherwise nil.
+func (r *EphemeralRunner) Worktree() *worktree.Worktree {
+	return r.worktree
+}
@@ -0,0 +1,49 @@
+package shai
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/colony-2/shai/internal/shai/runtime/worktree"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorktreeMountsProtectCloneConfigAndHooks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"-c", "user.name=shai", "-c", "user.email=shai@example.com", "commit", "--quiet", "--allow-empty", "-m", "init"},
+	} {
+		out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	wt, err := worktree.Create(t.TempDir(), repo, "agent/mounts")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(wt.Dir(), ".git", "hooks"), 0o755))
+
+	mountBuilder, err := NewMountBuilder(wt.Dir(), "/src", nil)
+	require.NoError(t, err)
+	runner := &EphemeralRunner{worktree: wt, mountBuilder: mountBuilder}
+	byTarget := map[string]mount.Mount{}
+	for _, m := range runner.worktreeMounts() {
+		byTarget[m.Target] = m
+	}
+	for _, name := range []string{"config", "hooks"} {
+		m, ok := byTarget["/src/.git/"+name]
+		require.True(t, ok, "clone .git/%s should be mounted", name)
+		require.True(t, m.ReadOnly)
+		require.Equal(t, filepath.Join(wt.Dir(), ".git", name), m.Source)
+	}
+
+	// A sandbox that only sees a subdirectory of the clone gets no .git.
+	require.NoError(t, os.MkdirAll(filepath.Join(wt.Dir(), "app"), 0o755))
+	runner.mountBuilder, err = NewMountBuilder(filepath.Join(wt.Dir(), "app"), "/src", nil)
+	require.NoError(t, err)
+	require.Len(t, runner.worktreeMounts(), 1)
+}
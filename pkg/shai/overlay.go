@@ -0,0 +1,48 @@
+package shai
+
+import (
+	runtimepkg "github.com/colony-2/shai/internal/shai/runtime"
+	"github.com/colony-2/shai/internal/shai/runtime/overlay"
+)
+
+// Read-write mount modes for SandboxConfig.RWMode.
+const (
+	RWModeBind    = runtimepkg.RWModeBind
+	RWModeOverlay = runtimepkg.RWModeOverlay
+)
+
+// OverlaySession holds the pending changes of a sandbox run in overlay mode.
+// Changes lists them; Apply writes them to the workspace and Discard drops
+// them.
+type OverlaySession = overlay.Session
+
+// Change is one pending change of an OverlaySession.
+type Change = overlay.Change
+
+// ChangeKind classifies a Change.
+type ChangeKind = overlay.ChangeKind
+
+// Change kinds.
+const (
+	ChangeAdded    = overlay.Added
+	ChangeModified = overlay.Modified
+	ChangeDeleted  = overlay.Deleted
+)
+
+// OpenOverlaySession loads a pending overlay session by ID.
+func OpenOverlaySession(id string) (*OverlaySession, error) {
+	dir, err := overlay.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return overlay.Open(dir, id)
+}
+
+// ListOverlaySessions returns the pending overlay sessions, oldest first.
+func ListOverlaySessions() ([]*OverlaySession, error) {
+	dir, err := overlay.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return overlay.List(dir)
+}
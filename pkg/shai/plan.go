@@ -0,0 +1,30 @@
+package shai
+
+import (
+	runtimepkg "github.com/colony-2/shai/internal/shai/runtime"
+)
+
+// SandboxPlan describes the sandbox a config resolves to: image and why it
+// was chosen, resource sets and the apply rules that activated them, mounts,
+// variable names, allowlists, calls, root commands and privilege.
+type SandboxPlan = runtimepkg.Plan
+
+type (
+	PlanResourceSet   = runtimepkg.PlanResourceSet
+	PlanApplyMatch    = runtimepkg.PlanApplyMatch
+	PlanMount         = runtimepkg.PlanMount
+	PlanVar           = runtimepkg.PlanVar
+	PlanHostPort      = runtimepkg.PlanHostPort
+	PlanPublishedPort = runtimepkg.PlanPublishedPort
+	PlanCall          = runtimepkg.PlanCall
+)
+
+// Plan resolves cfg as NewSandbox does without contacting Docker or reading
+// variable values. The config's trust state is reported in the plan instead
+// of being enforced.
+func Plan(cfg SandboxConfig) (*SandboxPlan, error) {
+	if err := cfg.normalize(); err != nil {
+		return nil, err
+	}
+	return runtimepkg.PlanSandbox(cfg.runtimeConfig())
+}
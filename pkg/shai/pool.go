@@ -0,0 +1,93 @@
+package shai
+
+import (
+	"context"
+
+	runtimepkg "github.com/colony-2/shai/internal/shai/runtime"
+)
+
+// PoolConfig describes a pool of sandboxes bootstrapped ahead of demand.
+type PoolConfig struct {
+	// Sandbox is the template every pooled sandbox is created from.
+	// Relative mount sources and vars files resolve against its WorkingDir.
+	// ReadWritePaths and PostSetupExec are ignored, and Worktree and
+	// RWModeOverlay are not supported. MaxDuration and IdleTimeout run from
+	// Acquire, not from warm-up.
+	Sandbox SandboxConfig
+	// Size is the number of sandboxes kept ready.
+	Size int
+	// Dir holds the workspace copies of pooled sandboxes (default
+	// ~/.local/state/shai/pool).
+	Dir string
+}
+
+// PoolStats reports how many pooled sandboxes are ready, warming and in use,
+// how often Acquire had to wait, and the mean warm-up time.
+type PoolStats = runtimepkg.PoolStats
+
+// PoolJob names the workspace a pooled sandbox is acquired for and the paths
+// synced back into it on Release.
+type PoolJob = runtimepkg.PoolJob
+
+// Pool hands out pre-bootstrapped sandboxes so jobs skip container start-up.
+type Pool struct {
+	pool *runtimepkg.Pool
+}
+
+// NewPool checks cfg.Sandbox, including trust, and starts warming cfg.Size
+// sandboxes in the background.
+func NewPool(cfg PoolConfig) (*Pool, error) {
+	if err := cfg.Sandbox.normalize(); err != nil {
+		return nil, err
+	}
+	pool, err := runtimepkg.NewPool(runtimepkg.PoolConfig{
+		Sandbox: cfg.Sandbox.runtimeConfig(),
+		Size:    cfg.Size,
+		Dir:     cfg.Dir,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Pool{pool: pool}, nil
+}
+
+// Acquire returns a ready sandbox with job's working directory copied in,
+// waiting for one if none is ready. Masked paths are not copied.
+func (p *Pool) Acquire(ctx context.Context, job PoolJob) (*PooledSandbox, error) {
+	sandbox, err := p.pool.Acquire(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	return &PooledSandbox{ContainerID: sandbox.ContainerID, sandbox: sandbox}, nil
+}
+
+// Stats returns the pool's current counters.
+func (p *Pool) Stats() PoolStats {
+	return p.pool.Stats()
+}
+
+// Close destroys the ready sandboxes and stops warming new ones. Acquired
+// sandboxes stay usable until released.
+func (p *Pool) Close() error {
+	return p.pool.Close()
+}
+
+// PooledSandbox is a sandbox acquired from a Pool.
+type PooledSandbox struct {
+	ContainerID string
+
+	sandbox *runtimepkg.PooledSandbox
+}
+
+// Exec runs exec in the sandbox as the sandbox user. A non-zero exit status
+// is returned as an *ExitError in the command phase; failing to start the
+// command is one in the setup phase.
+func (s *PooledSandbox) Exec(ctx context.Context, exec SandboxExec) error {
+	return s.sandbox.Exec(ctx, *convertExec(&exec))
+}
+
+// Release copies the job's read-write paths back into its working directory
+// and destroys the sandbox. Later calls do nothing.
+func (s *PooledSandbox) Release() error {
+	return s.sandbox.Release()
+}
@@ -2,6 +2,7 @@ package shai
 
 import (
 	"context"
+	"errors"
 
 	runtimepkg "github.com/colony-2/shai/internal/shai/runtime"
 )
@@ -13,13 +14,70 @@ type Sandbox interface {
 	Close() error
 }
 
+// OverlaySandbox is implemented by sandboxes from NewSandbox. Overlay
+// returns the session holding pending changes when RWMode is RWModeOverlay
+// and read-write paths were given, otherwise nil.
+type OverlaySandbox interface {
+	Overlay() *OverlaySession
+}
+
+// WorktreeSandbox is implemented by sandboxes from NewSandbox. Worktree
+// returns the checkout the sandbox runs in when SandboxConfig.Worktree is
+// set, otherwise nil.
+type WorktreeSandbox interface {
+	Worktree() *Worktree
+}
+
+// ExitError is returned by Run, Wait and Exec when a session ends
+// unsuccessfully. Phase says whether setup, bootstrap or the command failed;
+// Code is the exit status the shai CLI uses.
+type ExitError = runtimepkg.ExitError
+
+// ExecExitError is the error Exec returned for a failing command before
+// ExitError covered every phase. It is the same type.
+//
+// Deprecated: use ExitError.
+type ExecExitError = ExitError
+
+// ExitPhase names the stage of a session that produced an ExitError.
+type ExitPhase = runtimepkg.ExitPhase
+
+const (
+	ExitPhaseSetup     = runtimepkg.ExitPhaseSetup
+	ExitPhaseBootstrap = runtimepkg.ExitPhaseBootstrap
+	ExitPhaseCommand   = runtimepkg.ExitPhaseCommand
+)
+
+// Exit codes the shai CLI reserves for setup and bootstrap failures.
+const (
+	ExitCodeBootstrap = runtimepkg.ExitCodeBootstrap
+	ExitCodeSetup     = runtimepkg.ExitCodeSetup
+)
+
+// SessionLimitError is returned when a session is stopped for exceeding
+// MaxDuration or IdleTimeout.
+type SessionLimitError = runtimepkg.SessionLimitError
+
+// ExitCodeSessionLimit is the exit code the shai CLI uses for a
+// SessionLimitError.
+const ExitCodeSessionLimit = runtimepkg.ExitCodeSessionLimit
+
 // SandboxSession supervises a non-blocking sandbox execution.
 type SandboxSession struct {
 	ContainerID string
+	// Ports lists the host bindings of published sandbox ports.
+	Ports []PortBinding
 
 	session *runtimepkg.Session
 }
 
+// PortBinding reports where a published sandbox port is reachable on the host.
+type PortBinding struct {
+	ContainerPort int
+	HostIP        string
+	HostPort      int
+}
+
 // Wait blocks until the sandbox stops or ctx is cancelled.
 func (s *SandboxSession) Wait(ctx context.Context) error {
 	if s == nil || s.session == nil {
@@ -36,6 +94,17 @@ func (s *SandboxSession) Stop(ctx context.Context) error {
 	return s.session.Stop(ctx)
 }
 
+// Exec runs exec in the sandbox as the sandbox user, with the environment and
+// working directory of the session's own process. A non-zero exit status is
+// returned as an *ExitError in the command phase; failing to start the
+// command is one in the setup phase.
+func (s *SandboxSession) Exec(ctx context.Context, exec SandboxExec) error {
+	if s == nil || s.session == nil {
+		return errors.New("sandbox session is not running")
+	}
+	return s.session.Exec(ctx, *convertExec(&exec))
+}
+
 // Close releases session resources.
 func (s *SandboxSession) Close() error {
 	if s == nil || s.session == nil {
@@ -69,9 +138,37 @@ func (s *sandboxImpl) Start(ctx context.Context) (*SandboxSession, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &SandboxSession{ContainerID: session.ContainerID, session: session}, nil
+	return &SandboxSession{
+		ContainerID: session.ContainerID,
+		Ports:       convertPortBindings(session.Ports),
+		session:     session,
+	}, nil
+}
+
+var (
+	_ OverlaySandbox  = (*sandboxImpl)(nil)
+	_ WorktreeSandbox = (*sandboxImpl)(nil)
+)
+
+func (s *sandboxImpl) Overlay() *OverlaySession {
+	return s.runner.Overlay()
+}
+
+func (s *sandboxImpl) Worktree() *Worktree {
+	return s.runner.Worktree()
 }
 
 func (s *sandboxImpl) Close() error {
 	return s.runner.Close()
 }
+
+func convertPortBindings(bindings []runtimepkg.PortBinding) []PortBinding {
+	if len(bindings) == 0 {
+		return nil
+	}
+	out := make([]PortBinding, 0, len(bindings))
+	for _, b := range bindings {
+		out = append(out, PortBinding{ContainerPort: b.ContainerPort, HostIP: b.HostIP, HostPort: b.HostPort})
+	}
+	return out
+}
@@ -28,14 +28,74 @@ type SandboxConfig struct {
 	HostGID             string
 	Privileged          bool
 	ShowProgress        bool
+	PublishedPorts      []PublishedPort
+	// CPUs and Memory (e.g. "4g") cap the sandbox on top of the config's
+	// limits; the most restrictive value wins. Zero values add no limit.
+	CPUs   float64
+	Memory string
+	// MaxDuration and IdleTimeout stop the session after a wall-clock limit
+	// or a period without terminal input or output while no Exec runs in
+	// it; Run then returns a *SessionLimitError.
+	MaxDuration time.Duration
+	IdleTimeout time.Duration
+	// UserConfig merges the user's own config, ~/.config/shai/config.yaml,
+	// over the workspace config, as the shai CLI does.
+	UserConfig bool
+	// RequireTrust refuses repo configs that have not been approved in the
+	// trust store (~/.config/shai/trusted). ConfirmTrust, when set, is asked
+	// to approve new or changed configs; approvals are recorded.
+	RequireTrust bool
+	ConfirmTrust func(TrustRequest) (bool, error)
+	// RWMode is RWModeBind (default) to write straight into the working
+	// directory or RWModeOverlay to collect writes for review; see
+	// OverlaySandbox.
+	RWMode string
+	// Worktree runs the sandbox read-write in a fresh clone of the workspace
+	// repository on a new branch named WorktreeBranch (default
+	// shai/<timestamp>); see WorktreeSandbox.
+	Worktree       bool
+	WorktreeBranch string
+	// ContainerName names the sandbox container, as shown by ListSessions;
+	// empty picks shai-<random>.
+	ContainerName string
 }
 
-// SandboxExec describes a command to run inside the sandbox after setup.
+// TrustRequest describes a config awaiting approval and the capabilities it
+// grants outside the sandbox.
+type TrustRequest struct {
+	ConfigPath   string
+	Changed      bool
+	Capabilities []string
+}
+
+// PublishedPort publishes a sandbox port on the host's loopback interface.
+// HostPort 0 reuses Port when it is free on the host, otherwise any free port.
+type PublishedPort struct {
+	Port     int
+	HostPort int
+}
+
+// ParsePublishedPort parses a publish spec such as "3000" or "8080:3000" (host:container).
+func ParsePublishedPort(spec string) (PublishedPort, error) {
+	pp, err := runtimepkg.ParsePublishedPort(spec)
+	if err != nil {
+		return PublishedPort{}, err
+	}
+	return PublishedPort{Port: pp.Port, HostPort: pp.HostPort}, nil
+}
+
+// SandboxExec describes a command to run inside the sandbox after setup, or
+// in a running sandbox through SandboxSession.Exec and ExecSession.
 type SandboxExec struct {
 	Command []string
 	Env     map[string]string
 	Workdir string
 	UseTTY  bool
+	// Stdin, Stdout and Stderr apply to Exec. A nil Stdin attaches no input;
+	// nil Stdout and Stderr use the process's streams.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
 }
 
 // SandboxConfigOption mutates a SandboxConfig during construction.
@@ -120,6 +180,13 @@ func WithVerbose(verbose bool) SandboxConfigOption {
 	}
 }
 
+// WithPublishedPorts publishes sandbox ports on the host's loopback interface.
+func WithPublishedPorts(ports []PublishedPort) SandboxConfigOption {
+	return func(cfg *SandboxConfig) {
+		cfg.PublishedPorts = ports
+	}
+}
+
 // WithGracefulStopTimeout overrides the shutdown grace period.
 func WithGracefulStopTimeout(d time.Duration) SandboxConfigOption {
 	return func(cfg *SandboxConfig) {
@@ -133,6 +200,7 @@ func (cfg SandboxConfig) runtimeConfig() runtimepkg.EphemeralConfig {
 	return runtimepkg.EphemeralConfig{
 		WorkingDir:          normalized.WorkingDir,
 		ConfigFile:          normalized.ConfigFile,
+		UserConfig:          normalized.UserConfig,
 		TemplateVars:        normalized.TemplateVars,
 		ReadWritePaths:      normalized.ReadWritePaths,
 		ResourceSets:        normalized.ResourceSets,
@@ -147,7 +215,42 @@ func (cfg SandboxConfig) runtimeConfig() runtimepkg.EphemeralConfig {
 		HostGID:             normalized.HostGID,
 		Privileged:          normalized.Privileged,
 		ShowProgress:        normalized.ShowProgress,
+		PublishedPorts:      convertPublishedPorts(normalized.PublishedPorts),
+		CPUs:                normalized.CPUs,
+		Memory:              normalized.Memory,
+		MaxDuration:         normalized.MaxDuration,
+		IdleTimeout:         normalized.IdleTimeout,
+		RequireTrust:        normalized.RequireTrust,
+		ConfirmTrust:        convertConfirmTrust(normalized.ConfirmTrust),
+		RWMode:              normalized.RWMode,
+		Worktree:            normalized.Worktree,
+		WorktreeBranch:      normalized.WorktreeBranch,
+		ContainerName:       normalized.ContainerName,
+	}
+}
+
+func convertConfirmTrust(confirm func(TrustRequest) (bool, error)) func(runtimepkg.TrustRequest) (bool, error) {
+	if confirm == nil {
+		return nil
+	}
+	return func(req runtimepkg.TrustRequest) (bool, error) {
+		return confirm(TrustRequest{
+			ConfigPath:   req.ConfigPath,
+			Changed:      req.Changed,
+			Capabilities: req.Capabilities,
+		})
+	}
+}
+
+func convertPublishedPorts(ports []PublishedPort) []runtimepkg.PublishedPort {
+	if len(ports) == 0 {
+		return nil
+	}
+	out := make([]runtimepkg.PublishedPort, 0, len(ports))
+	for _, pp := range ports {
+		out = append(out, runtimepkg.PublishedPort{Port: pp.Port, HostPort: pp.HostPort})
 	}
+	return out
 }
 
 func convertExec(exec *SandboxExec) *runtimepkg.ExecSpec {
@@ -159,6 +262,9 @@ func convertExec(exec *SandboxExec) *runtimepkg.ExecSpec {
 		Env:     exec.Env,
 		Workdir: exec.Workdir,
 		UseTTY:  exec.UseTTY,
+		Stdin:   exec.Stdin,
+		Stdout:  exec.Stdout,
+		Stderr:  exec.Stderr,
 	}
 }
 
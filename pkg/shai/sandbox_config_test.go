@@ -2,7 +2,10 @@ package shai
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
+
+	runtimepkg "github.com/colony-2/shai/internal/shai/runtime"
 )
 
 func TestLoadSandboxConfigDefaults(t *testing.T) {
@@ -50,3 +53,73 @@ func TestRuntimeConfigConversion(t *testing.T) {
 		t.Fatalf("useTTY mismatch")
 	}
 }
+
+func TestRuntimeConfigConvertsPublishedPorts(t *testing.T) {
+	cfg := SandboxConfig{
+		WorkingDir:     "/workspace",
+		PublishedPorts: []PublishedPort{{Port: 3000}, {Port: 5173, HostPort: 15173}},
+	}
+	rc := cfg.runtimeConfig()
+	if len(rc.PublishedPorts) != 2 {
+		t.Fatalf("expected 2 published ports, got %d", len(rc.PublishedPorts))
+	}
+	if rc.PublishedPorts[1].Port != 5173 || rc.PublishedPorts[1].HostPort != 15173 {
+		t.Fatalf("unexpected published port %+v", rc.PublishedPorts[1])
+	}
+}
+
+func TestRuntimeConfigConvertsTrustSettings(t *testing.T) {
+	var got TrustRequest
+	cfg := SandboxConfig{
+		WorkingDir:   "/workspace",
+		RequireTrust: true,
+		ConfirmTrust: func(req TrustRequest) (bool, error) {
+			got = req
+			return true, nil
+		},
+	}
+	rc := cfg.runtimeConfig()
+	if !rc.RequireTrust || rc.ConfirmTrust == nil {
+		t.Fatalf("expected trust settings to carry over, got %+v", rc)
+	}
+	ok, err := rc.ConfirmTrust(runtimepkg.TrustRequest{ConfigPath: "/workspace/.shai/config.yaml", Changed: true})
+	if err != nil || !ok {
+		t.Fatalf("unexpected confirm result %v %v", ok, err)
+	}
+	if got.ConfigPath != "/workspace/.shai/config.yaml" || !got.Changed {
+		t.Fatalf("unexpected trust request %+v", got)
+	}
+}
+
+func TestRuntimeConfigCarriesLimits(t *testing.T) {
+	rc := SandboxConfig{WorkingDir: "/workspace", CPUs: 2, Memory: "4g"}.runtimeConfig()
+	if rc.CPUs != 2 || rc.Memory != "4g" {
+		t.Fatalf("expected limits to carry over, got cpus=%v memory=%q", rc.CPUs, rc.Memory)
+	}
+}
+
+func TestRuntimeConfigCarriesCheckoutModes(t *testing.T) {
+	rc := SandboxConfig{WorkingDir: "/workspace", RWMode: RWModeOverlay, Worktree: true, WorktreeBranch: "agent/a"}.runtimeConfig()
+	if rc.RWMode != RWModeOverlay {
+		t.Fatalf("expected rw mode to carry over, got %q", rc.RWMode)
+	}
+	if !rc.Worktree || rc.WorktreeBranch != "agent/a" {
+		t.Fatalf("expected worktree options to carry over, got %v %q", rc.Worktree, rc.WorktreeBranch)
+	}
+}
+
+func TestRuntimeConfigCarriesContainerName(t *testing.T) {
+	rc := SandboxConfig{WorkingDir: "/workspace", ContainerName: "agent-1"}.runtimeConfig()
+	if rc.ContainerName != "agent-1" {
+		t.Fatalf("expected container name to carry over, got %q", rc.ContainerName)
+	}
+}
+
+func TestConvertExecCarriesStreams(t *testing.T) {
+	var out, errOut strings.Builder
+	in := strings.NewReader("input")
+	spec := convertExec(&SandboxExec{Command: []string{"cat"}, Stdin: in, Stdout: &out, Stderr: &errOut})
+	if spec.Stdin != in || spec.Stdout != &out || spec.Stderr != &errOut {
+		t.Fatalf("expected streams to be copied, got %+v", spec)
+	}
+}
@@ -0,0 +1,66 @@
+package shai
+
+import (
+	"context"
+	"time"
+
+	runtimepkg "github.com/colony-2/shai/internal/shai/runtime"
+)
+
+// SessionInfo describes a running sandbox, read from its container labels.
+type SessionInfo = runtimepkg.SessionInfo
+
+// ListSessions returns the running sandboxes, oldest first.
+func ListSessions(ctx context.Context) ([]SessionInfo, error) {
+	return runtimepkg.ListSessions(ctx)
+}
+
+// NewSessionName returns a fresh sandbox name of the form shai-<random>.
+func NewSessionName() string {
+	return runtimepkg.NewSessionName()
+}
+
+// ValidateSessionName reports whether name can be used for a sandbox.
+func ValidateSessionName(name string) error {
+	return runtimepkg.ValidateSessionName(name)
+}
+
+// AttachSession connects the terminal to the running sandbox called name
+// until it exits or the user detaches with ctrl-p ctrl-q.
+func AttachSession(ctx context.Context, name string) error {
+	return runtimepkg.AttachSession(ctx, name)
+}
+
+// StopSession stops the running sandbox called name, giving it timeout to
+// exit before it is killed.
+func StopSession(ctx context.Context, name string, timeout time.Duration) error {
+	return runtimepkg.StopSession(ctx, name, timeout)
+}
+
+// ExecSession runs exec as the sandbox user in the running sandbox called
+// name. An empty command starts the user's login shell.
+func ExecSession(ctx context.Context, name string, exec SandboxExec) error {
+	return runtimepkg.ExecSession(ctx, name, *convertExec(&exec))
+}
+
+// SandboxFingerprint resolves cfg as NewSandbox does, including the trust
+// check, and returns the fingerprint its sandbox is labelled with. It changes
+// whenever the rendered config, image or read-write set does.
+func SandboxFingerprint(cfg SandboxConfig) (string, error) {
+	if err := cfg.normalize(); err != nil {
+		return "", err
+	}
+	return runtimepkg.Fingerprint(cfg.runtimeConfig())
+}
+
+// WaitSessionReady blocks until the sandbox called name has finished
+// bootstrapping and accepts ExecSession.
+func WaitSessionReady(ctx context.Context, name string) error {
+	return runtimepkg.WaitSessionReady(ctx, name)
+}
+
+// RemoveSession kills and removes the sandbox called name, returning once
+// the name can be reused.
+func RemoveSession(ctx context.Context, name string) error {
+	return runtimepkg.RemoveSession(ctx, name)
+}
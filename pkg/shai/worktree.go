@@ -0,0 +1,26 @@
+package shai
+
+import "github.com/colony-2/shai/internal/shai/runtime/worktree"
+
+// Worktree is a shai-managed clone of a repository on its own branch, created
+// when SandboxConfig.Worktree is set. FetchBranch copies the branch back into
+// the source repository and Remove deletes the clone.
+type Worktree = worktree.Worktree
+
+// OpenWorktree loads a shai worktree by ID.
+func OpenWorktree(id string) (*Worktree, error) {
+	dir, err := worktree.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return worktree.Open(dir, id)
+}
+
+// ListWorktrees returns the existing shai worktrees, oldest first.
+func ListWorktrees() ([]*Worktree, error) {
+	dir, err := worktree.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return worktree.List(dir)
+}